@@ -32,7 +32,7 @@ set ("foo", "bar")
 -> literal 5
 "5"
 -> literal "Hello"
-""Hello""
+"\"Hello\""
 -> string 4
 "4"
 -> string true
@@ -79,6 +79,34 @@ func (bi *BuiltInExpression) GetToken() token.Token {
 }
 func (bi *BuiltInExpression) String() string { return "builtin \"" + bi.Name + "\"" }
 
+// A chain of comparisons such as '0 <= x < 10', which means '0 <= x and x < 10' except that x is evaluated only once.
+// There is one more operand than there are operators.
+type ComparisonChain struct {
+	Token     token.Token // The first of the operators.
+	Operands  []Node
+	Operators []token.Token
+}
+
+func (cc *ComparisonChain) GetToken() token.Token { return cc.Token }
+func (cc *ComparisonChain) String() string {
+	var out bytes.Buffer
+	out.WriteString("(")
+	for i, v := range cc.Operands {
+		if i > 0 {
+			out.WriteString(" " + cc.Operators[i-1].Literal + " ")
+		}
+		out.WriteString(v.String())
+	}
+	out.WriteString(")")
+	return out.String()
+}
+
+// The i-th comparison in the chain, as the infix expression it would be on its own.
+func (cc *ComparisonChain) Link(i int) *InfixExpression {
+	return &InfixExpression{Token: cc.Operators[i], Operator: cc.Operators[i].Literal,
+		Args: []Node{cc.Operands[i], &Bling{Value: cc.Operators[i].Literal, Token: cc.Operators[i]}, cc.Operands[i+1]}}
+}
+
 type EmptyTuple struct {
 	Token token.Token
 	Value string
@@ -186,7 +214,7 @@ func (ie *InfixExpression) String() string {
 
 type IntegerLiteral struct {
 	Token token.Token
-	Value int
+	Value int64
 }
 
 func (il *IntegerLiteral) GetToken() token.Token { return il.Token }
@@ -256,6 +284,7 @@ func (le *LogExpression) String() string {
 
 type LoopExpression struct {
 	Token token.Token
+	Label string
 	Code  Node
 }
 
@@ -263,13 +292,44 @@ func (le *LoopExpression) GetToken() token.Token { return le.Token }
 func (le *LoopExpression) String() string {
 	var out bytes.Buffer
 
-	out.WriteString("loop (")
+	out.WriteString("loop ")
+	if le.Label != "" {
+		out.WriteString(le.Label + " ")
+	}
+	out.WriteString("(")
 	out.WriteString(le.Code.String())
 	out.WriteString(")")
 
 	return out.String()
 }
 
+type MatchExpression struct {
+	Token    token.Token
+	Subject  Node
+	Patterns []Node // The patterns and the values of the arms of the match, in order.
+	Values   []Node
+}
+
+func (me *MatchExpression) GetToken() token.Token { return me.Token }
+func (me *MatchExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("match ")
+	out.WriteString(me.Subject.String())
+	out.WriteString(" : (")
+	for i, v := range me.Patterns {
+		out.WriteString(v.String())
+		out.WriteString(" : ")
+		out.WriteString(me.Values[i].String())
+		if i < len(me.Patterns)-1 {
+			out.WriteString(" ; ")
+		}
+	}
+	out.WriteString(")")
+
+	return out.String()
+}
+
 type Nothing struct {
 	Token token.Token
 }
@@ -277,6 +337,14 @@ type Nothing struct {
 func (ne *Nothing) GetToken() token.Token { return ne.Token }
 func (ne *Nothing) String() string        { return "" }
 
+// What's left of a 'when' block whose flag isn't set: it evaluates as an unsatisfied conditional would.
+type OmittedExpression struct {
+	Token token.Token
+}
+
+func (oe *OmittedExpression) GetToken() token.Token { return oe.Token }
+func (oe *OmittedExpression) String() string        { return "" }
+
 type PrefixExpression struct {
 	Token    token.Token
 	Operator string
@@ -410,6 +478,7 @@ func (t *TypeLiteral) String() string        { return t.Value }
 type UnfixExpression struct {
 	Token    token.Token
 	Operator string
+	Label    string // Only used by 'break' and 'continue', to say which loop they apply to.
 }
 
 func (uf *UnfixExpression) GetToken() token.Token { return uf.Token }
@@ -418,6 +487,9 @@ func (uf *UnfixExpression) String() string {
 
 	out.WriteString("(")
 	out.WriteString(uf.Operator)
+	if uf.Label != "" {
+		out.WriteString(" " + uf.Label)
+	}
 	out.WriteString(")")
 
 	return out.String()
@@ -425,13 +497,62 @@ func (uf *UnfixExpression) String() string {
 
 // And other useful stuff.
 
+// Returns the immediate subnodes of a node, for things that need to walk the tree.
+func Children(node Node) []Node {
+	var result []Node
+	switch node := node.(type) {
+	case *ApplicationExpression:
+		result = []Node{node.Left, node.Right}
+	case *AssignmentExpression:
+		result = []Node{node.Left, node.Right}
+	case *ComparisonChain:
+		result = node.Operands
+	case *Expression:
+		result = []Node{node.Node}
+	case *FuncExpression:
+		result = []Node{node.Body, node.Given}
+	case *IndexExpression:
+		result = []Node{node.Left, node.Index}
+	case *InfixExpression:
+		result = node.Args
+	case *LazyInfixExpression:
+		result = []Node{node.Left, node.Right}
+	case *ListExpression:
+		result = []Node{node.List}
+	case *LogExpression:
+		result = []Node{node.Left, node.Right}
+	case *LoopExpression:
+		result = []Node{node.Code}
+	case *MatchExpression:
+		result = append(append([]Node{node.Subject}, node.Patterns...), node.Values...)
+	case *PrefixExpression:
+		result = node.Args
+	case *SetExpression:
+		result = []Node{node.Set}
+	case *StreamingExpression:
+		result = []Node{node.Left, node.Right}
+	case *SuffixExpression:
+		result = node.Args
+	case *TryExpression:
+		result = []Node{node.Right}
+	}
+	children := []Node{}
+	for _, v := range result {
+		if v != nil && !reflect.ValueOf(v).IsNil() {
+			children = append(children, v)
+		}
+	}
+	return children
+}
+
 type Function = struct {
-	Sig     signature.Signature
-	Rets    signature.Signature
-	Body    Node
-	Given   Node
-	Cmd     bool
-	Private bool
+	Sig        signature.Signature
+	Rets       signature.Signature
+	Body       Node
+	Given      Node
+	Cmd        bool
+	Private    bool
+	Deprecated string // The message of the function's '@deprecated' annotation, if it has one.
 }
 
 type FnTreeNode struct {
@@ -92,7 +92,7 @@ func makeStruct(structName string, args []any, tok token.Token, c *Context) obje
 			case *string:
 				charmValue = &object.String{Value: *goValue}
 			case *int:
-				charmValue = &object.Integer{Value: *goValue}
+				charmValue = &object.Integer{Value: int64(*goValue)}
 			case *bool:
 				if *goValue {
 					charmValue = object.TRUE
@@ -5,8 +5,10 @@ package evaluator
 import (
 	"fmt"
 	"os"
+	"runtime"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 	"unicode/utf8"
 
@@ -49,12 +51,18 @@ type Context struct {
 	env     *object.Environment
 	access  Access
 	logging bool
+	depth   int // How many function calls deep we are.
 }
 
 func NewContext(p *parser.Parser, e *object.Environment, a Access, log bool) *Context {
 	return &Context{prsr: p, env: e, access: a, logging: log}
 }
 
+// A context for evaluating something in another environment, e.g. a lambda, at the same depth of function calls.
+func (c *Context) withEnv(env *object.Environment, access Access) *Context {
+	return &Context{prsr: c.prsr, env: env, access: access, logging: c.logging, depth: c.depth}
+}
+
 // A tiny kludge. An Unsatisfied Conditional value gets turned into an error if it meets anything other than a ';'/newline operator.
 // But what if it doesn't meet anything at all, because you wrote false : 42 in the REPL? Then it still has to be converted into an
 // error. This does that.
@@ -106,6 +114,9 @@ func Eval(node ast.Node, c *Context) object.Object {
 	case *ast.LoopExpression:
 		return (evalLoopExpression(node, c))
 
+	case *ast.MatchExpression:
+		return evalMatchExpression(node, c)
+
 	case *ast.AssignmentExpression:
 		variables := signature.Signature{}
 		var err *object.Error
@@ -213,6 +224,9 @@ func Eval(node ast.Node, c *Context) object.Object {
 
 		return evalInfixExpression(node, c)
 
+	case *ast.ComparisonChain:
+		return evalComparisonChain(node, c)
+
 	case *ast.LazyInfixExpression:
 		left := Eval(node.Left, c)
 		if isError(left) {
@@ -229,6 +243,9 @@ func Eval(node ast.Node, c *Context) object.Object {
 			if node.Operator != ";" {
 				return newError("eval/return", node.Token)
 			}
+			if leftEvaluation.(*object.Effects).BreakHappened || leftEvaluation.(*object.Effects).ContinueHappened {
+				return leftEvaluation // We skip the rest of this iteration of the loop.
+			}
 			if leftEvaluation.(*object.Effects).ElseSeeking && node.Right.GetToken().Type == token.COLON {
 				if node.Right.(*ast.LazyInfixExpression).Left.GetToken().Type == token.ELSE {
 					leftEvaluation.(*object.Effects).ElseSeeking = false
@@ -260,6 +277,10 @@ func Eval(node ast.Node, c *Context) object.Object {
 			if right == object.SUCCESS {
 				return left
 			}
+			if right.Type() == object.UNSATISFIED_OBJ { // Then we go on to the next line, which may be an 'else'.
+				left.(*object.Effects).ElseSeeking = false
+				return left
+			}
 			if right.Type() == object.RESPONSE_OBJ {
 				return combineEffects(left.(*object.Effects), right.(*object.Effects))
 			}
@@ -296,7 +317,7 @@ func Eval(node ast.Node, c *Context) object.Object {
 		return &object.List{Elements: []object.Object{list}}
 
 	case *ast.LogExpression:
-		newContext := &Context{prsr: c.prsr, env: c.env, access: c.access, logging: false}
+		newContext := &Context{prsr: c.prsr, env: c.env, access: c.access, logging: false, depth: c.depth}
 		if c.logging {
 			logStr := "Log at line " + text.YELLOW + strconv.Itoa(node.Token.Line) + text.RESET
 			logTime, _ := c.prsr.AllGlobals.Get("$logTime")
@@ -305,7 +326,9 @@ func Eval(node ast.Node, c *Context) object.Object {
 			}
 			logStr = logStr + ":\n"
 			logStr = logStr + text.Pretty(parseLogString(node, newContext), 4, 84) // Note do something about 84, it should be a service variable.
-			emit(logStr, node.GetToken(), newContext)
+			if err := emit(logStr, node.GetToken(), newContext); err != nil {
+				return err
+			}
 		}
 		switch node.Token.Type {
 		case token.IFLOG:
@@ -384,10 +407,12 @@ func Eval(node ast.Node, c *Context) object.Object {
 			params = []object.Object{right}
 		}
 		left.(*object.Func).Env.Ext = c.env
-		newContext := NewContext(c.prsr, left.(*object.Func).Env, c.access, c.logging)
+		newContext := c.withEnv(left.(*object.Func).Env, c.access)
 		return applyFunction(left.(*object.Func).Function, params, node.Token, newContext)
 	case *ast.Nothing:
 		return &object.Tuple{Elements: []object.Object{}}
+	case *ast.OmittedExpression:
+		return UNSATISFIED
 	case *ast.StreamingExpression:
 		left := Eval(node.Left, c)
 		if isError(left) {
@@ -403,7 +428,7 @@ func Eval(node ast.Node, c *Context) object.Object {
 						val = Eval(val.(*object.Lazy).Value, c)
 					}
 					if val.Type() == object.FUNC_OBJ {
-						newContext := NewContext(c.prsr, val.(*object.Func).Env, c.access, c.logging)
+						newContext := c.withEnv(val.(*object.Func).Env, c.access)
 						return applyFunction(val.(*object.Func).Function, []object.Object{left}, node.Token, newContext)
 					}
 				}
@@ -411,7 +436,7 @@ func Eval(node ast.Node, c *Context) object.Object {
 			envWithThat := object.NewEnvironment()
 			envWithThat.HardSet("that", left)
 			envWithThat.Ext = c.env
-			newContext := &Context{prsr: c.prsr, env: envWithThat, access: c.access, logging: c.logging}
+			newContext := c.withEnv(envWithThat, c.access)
 			return Eval(node.Right, newContext)
 		case token.MAP:
 			if left.Type() == object.ERROR_OBJ {
@@ -430,7 +455,7 @@ func Eval(node ast.Node, c *Context) object.Object {
 					}
 					if val.Type() == object.FUNC_OBJ {
 						for _, v := range left.(*object.List).Elements {
-							newContext := NewContext(c.prsr, val.(*object.Func).Env, c.access, c.logging)
+							newContext := c.withEnv(val.(*object.Func).Env, c.access)
 							result := applyFunction(val.(*object.Func).Function, []object.Object{v}, node.Token, newContext)
 							if result.Type() == object.ERROR_OBJ {
 								result.(*object.Error).Trace = append(result.(*object.Error).Trace, node.GetToken())
@@ -450,7 +475,7 @@ func Eval(node ast.Node, c *Context) object.Object {
 			envWithThat.Ext = c.env
 			for _, v := range left.(*object.List).Elements {
 				envWithThat.HardSet("that", v)
-				newContext := &Context{prsr: c.prsr, env: envWithThat, access: c.access, logging: c.logging}
+				newContext := c.withEnv(envWithThat, c.access)
 				result := Eval(node.Right, newContext)
 				if result.Type() == object.ERROR_OBJ {
 					result.(*object.Error).Trace = append(result.(*object.Error).Trace, node.GetToken())
@@ -480,7 +505,7 @@ func Eval(node ast.Node, c *Context) object.Object {
 					}
 					if val.Type() == object.FUNC_OBJ {
 						for _, v := range left.(*object.List).Elements {
-							newContext := NewContext(c.prsr, val.(*object.Func).Env, c.access, c.logging)
+							newContext := c.withEnv(val.(*object.Func).Env, c.access)
 							result := applyFunction(val.(*object.Func).Function, []object.Object{v}, node.Token, newContext)
 							if result.Type() == object.ERROR_OBJ {
 								result.(*object.Error).Trace = append(result.(*object.Error).Trace, node.GetToken())
@@ -501,7 +526,7 @@ func Eval(node ast.Node, c *Context) object.Object {
 			envWithThat.Ext = c.env
 			for _, v := range left.(*object.List).Elements {
 				envWithThat.HardSet("that", v)
-				newContext := &Context{prsr: c.prsr, env: envWithThat, access: c.access, logging: c.logging}
+				newContext := c.withEnv(envWithThat, c.access)
 				result := Eval(node.Right, newContext)
 				if result.Type() == object.ERROR_OBJ {
 					result.(*object.Error).Trace = append(result.(*object.Error).Trace, node.GetToken())
@@ -564,8 +589,14 @@ func parseLogString(node *ast.LogExpression, c *Context) string {
 	return result
 }
 
+// The parser keeps its state while parsing, so since 'pmap' may be evaluating lambdas concurrently, anything parsed at
+// runtime has to take turns.
+var parsing sync.Mutex
+
 func evalText(s string, c *Context) string {
+	parsing.Lock()
 	ast := c.prsr.ParseLine("logger", s)
+	parsing.Unlock()
 	return (c.prsr.Serialize(Eval(*ast, c), parser.LITERAL))
 }
 
@@ -619,6 +650,10 @@ func evalLazyLeftExpression(tok token.Token, left object.Object, c *Context) obj
 func combineEffects(left, right *object.Effects) *object.Effects {
 	left.Elements = append(left.Elements, right.Elements...)
 	left.BreakHappened = left.BreakHappened || right.BreakHappened
+	left.ContinueHappened = left.ContinueHappened || right.ContinueHappened
+	if right.Label != "" {
+		left.Label = right.Label
+	}
 	left.StopHappened = left.StopHappened || right.StopHappened
 	left.ElseSeeking = left.ElseSeeking || right.ElseSeeking
 	return left
@@ -714,7 +749,7 @@ func evalPrefixExpression(node *ast.PrefixExpression, c *Context) object.Object
 			if !c.prsr.ParamsFitSig(variable.(*object.Func).Sig, params) {
 				return newError("eval/sig/lambda", tok, params)
 			}
-			newContext := NewContext(c.prsr, variable.(*object.Func).Env, LAMBDA, c.logging)
+			newContext := c.withEnv(variable.(*object.Func).Env, LAMBDA)
 			lamdbaResult := applyFunction(variable.(*object.Func).Function, params, tok, newContext)
 			return lamdbaResult
 		} // ... or it could contain an outer function.
@@ -752,7 +787,13 @@ func evalUnfixExpression(node *ast.UnfixExpression, c *Context) object.Object {
 		if c.access != CMD {
 			return newError("eval/break", node.Token)
 		}
-		return &object.Effects{BreakHappened: true}
+		return &object.Effects{BreakHappened: true, Label: node.Label}
+	}
+	if node.Operator == "continue" {
+		if c.access != CMD {
+			return newError("eval/continue", node.Token)
+		}
+		return &object.Effects{ContinueHappened: true, Label: node.Label}
 	}
 	if node.Operator == "stop" {
 		if c.access != CMD {
@@ -771,6 +812,40 @@ func evalUnfixExpression(node *ast.UnfixExpression, c *Context) object.Object {
 	return result
 }
 
+// Each operand is evaluated at most once, and we stop as soon as a comparison is false, as 'and' would.
+func evalComparisonChain(node *ast.ComparisonChain, c *Context) object.Object {
+	left := Eval(node.Operands[0], c)
+	for i, operator := range node.Operators {
+		if isError(left) {
+			left.(*object.Error).Trace = append(left.(*object.Error).Trace, operator)
+			return left
+		}
+		if isUnsatisfiedConditional(left) {
+			return newError("eval/unsatisfied/h", operator)
+		}
+		right := Eval(node.Operands[i+1], c)
+		if isError(right) {
+			right.(*object.Error).Trace = append(right.(*object.Error).Trace, operator)
+			return right
+		}
+		if isUnsatisfiedConditional(right) {
+			return newError("eval/unsatisfied/h", operator)
+		}
+		values := []object.Object{left, &object.Bling{Value: operator.Literal}, right}
+		result := functionCallWithValues(c.prsr.FunctionTreeMap[operator.Literal], values, operator, c)
+		switch {
+		case isError(result):
+			return result
+		case result == object.FALSE:
+			return object.FALSE
+		case result != object.TRUE:
+			return newErrorWithVals("eval/bool/chain", operator, []object.Object{result}, result)
+		}
+		left = right
+	}
+	return object.TRUE
+}
+
 func evalInfixExpression(node *ast.InfixExpression, c *Context) object.Object {
 	if c.prsr.Infixes.Contains(node.Operator) {
 		return functionCall(c.prsr.FunctionTreeMap[node.Operator], node.Args, node.Token, c)
@@ -856,6 +931,9 @@ func Assign(variable signature.NameTypePair, right object.Object, tok token.Toke
 	if right.Type() == object.UNSATISFIED_OBJ {
 		return newError("eval/unsatisfied/l", tok)
 	}
+	if variable.VarName == "_" { // Then the value is being ignored.
+		return nil
+	}
 	if right.Type() == object.STRUCTDEF_OBJ {
 		return AssignStructDef(variable.VarName, right.(*object.StructDef).Sig, tok, c)
 	}
@@ -929,6 +1007,14 @@ func Assign(variable signature.NameTypePair, right object.Object, tok token.Toke
 		if strings.HasPrefix(variable.VarName, "$") {
 			return assignSysVar(tok, variable.VarName, right, envToChange)
 		}
+		if _, ok := envToChange.Store[variable.VarName]; !ok && tok.Literal != "=" {
+			// Then it's a compound assignment like 'x += 1' which would otherwise shadow a global constant.
+			for env := envToChange.Ext; env != nil; env = env.Ext {
+				if env.IsConstant(variable.VarName) {
+					return newError("eval/cmd/const", tok, variable.VarName)
+				}
+			}
+		}
 		if !envToChange.Exists(variable.VarName) {
 			envToChange.InitializeLocal(variable.VarName, right, inferredType)
 			return nil
@@ -966,6 +1052,15 @@ func Assign(variable signature.NameTypePair, right object.Object, tok token.Toke
 // their very name into a mockery.
 func AssignStructDef(structName string, sig signature.Signature, tok token.Token, c *Context) *object.Error {
 
+	// Each label may only be used once, or the fields would collapse into one another.
+	for i := range sig {
+		for j := 0; j < i; j++ {
+			if sig[j].VarName == sig[i].VarName {
+				return newError("init/struct/dup-field", tok, structName, sig[i].VarName)
+			}
+		}
+	}
+
 	// So what we're going to do is add the constructors to the builtins,
 	// and add the function name, sig, and body to the parser's
 	// table of functions, and add the labels to the environment.
@@ -997,12 +1092,18 @@ func AssignStructDef(structName string, sig signature.Signature, tok token.Token
 
 	constructor_2 := func(p *parser.Parser, tok token.Token, args ...object.Object) object.Object {
 		result := &object.Struct{Value: make(map[string]object.Object), Namespace: p.NamespacePath}
+		if len(args) == 1 && args[0].Type() == object.TUPLE_OBJ { // Then the first constructor didn't accept the arguments and we get them as a tuple.
+			args = args[0].(*object.Tuple).Elements
+		}
 		for _, v := range args {
-			if v == object.EMPTY_TUPLE && len(sig) == 0 {
-				result.Name = structName
-				return result
-			}
 			if v.Type() != object.PAIR_OBJ {
+				if len(args) == len(sig) { // Then we were probably called positionally with a value of the wrong type.
+					for i, field := range sig {
+						if args[i].Type() != object.PAIR_OBJ && !parser.IsObjectInType(p.TypeSystem, args[i], field.VarType) {
+							return newError("eval/struct/field-type/a", tok, field.VarName, structName, field.VarType, args[i])
+						}
+					}
+				}
 				return newError("eval/pair", tok)
 			}
 			if v.(*object.Pair).Left.Type() != object.LABEL_OBJ {
@@ -1016,10 +1117,10 @@ func AssignStructDef(structName string, sig signature.Signature, tok token.Token
 				}
 			}
 			if positionOfLabelInFields == -1 {
-				return newError("eval/field/struct", tok, v.(*object.Pair).Left.(*object.Label).Value, structName)
+				return newError("eval/struct/unknown-field", tok, v.(*object.Pair).Left.(*object.Label).Value, structName)
 			}
 			if !parser.IsObjectInType(p.TypeSystem, v.(*object.Pair).Right, sig[positionOfLabelInFields].VarType) {
-				return newError("eval/field/type", tok, v.(*object.Pair).Left.(*object.Label).Value,
+				return newError("eval/struct/field-type/b", tok, v.(*object.Pair).Left.(*object.Label).Value,
 					structName, sig[positionOfLabelInFields].VarType,
 					v.(*object.Pair).Right)
 			}
@@ -1029,6 +1130,9 @@ func AssignStructDef(structName string, sig signature.Signature, tok token.Token
 
 		}
 		for _, v := range sig {
+			if _, ok := result.Value[v.VarName]; !ok {
+				return newError("eval/struct/missing-field", tok, v.VarName, structName)
+			}
 			result.Labels = append(result.Labels, v.VarName)
 		}
 		result.Name = structName
@@ -1090,7 +1194,9 @@ func evalEvalExpression(token token.Token, right object.Object, c *Context) obje
 	}
 	if right.Type() == object.STRING_OBJ {
 		source := "string evaluated at line " + strconv.Itoa(token.Line) + " of " + token.Source
+		parsing.Lock()
 		parsedCode := c.prsr.ParseLine(source, right.(*object.String).Value)
+		parsing.Unlock()
 		return Evaluate(*parsedCode, c)
 	}
 	return newError("eval/eval", token)
@@ -1125,16 +1231,53 @@ func evalLoopExpression(loopNode *ast.LoopExpression, c *Context) object.Object
 		if result.QuitHappened {
 			return result
 		}
+		if (result.BreakHappened || result.ContinueHappened) && result.Label != "" && result.Label != loopNode.Label {
+			return result // Then it's meant for an enclosing loop.
+		}
+		result.Label = ""
 		if result.BreakHappened {
 			result.BreakHappened = false
+			result.ElseSeeking = false // Or the conditional we broke out of would make the code after the loop skip its conditionals.
 			return result
 		}
+		result.ContinueHappened = false
 		return evalLoopExpression(loopNode, c)
 
 	}
 	return newError("eval/loop/value", loopNode.Token)
 }
 
+// We try the patterns in order and return the value of the first arm whose pattern matches the subject. A pattern
+// matches if it's 'else', or a type the subject belongs to, or a value equal to the subject.
+func evalMatchExpression(node *ast.MatchExpression, c *Context) object.Object {
+	subject := Eval(node.Subject, c)
+	if isError(subject) {
+		subject.(*object.Error).Trace = append(subject.(*object.Error).Trace, node.Token)
+		return subject
+	}
+	for i, pattern := range node.Patterns {
+		if pattern.GetToken().Type == token.ELSE {
+			return Eval(node.Values[i], c)
+		}
+		value := Eval(pattern, c)
+		if isError(value) {
+			value.(*object.Error).Trace = append(value.(*object.Error).Trace, node.Token)
+			return value
+		}
+		if typeValue, ok := value.(*object.Type); ok && subject.Type() != object.TYPE_OBJ {
+			if parser.IsSameTypeOrSubtype(c.prsr.TypeSystem, object.ConcreteType(subject), typeValue.Value) ||
+				parser.IsSameTypeOrSubtype(c.prsr.TypeSystem, object.InnerType(subject), typeValue.Value) {
+				return Eval(node.Values[i], c)
+			}
+			continue
+		}
+		if object.Equals(subject, value) {
+			return Eval(node.Values[i], c)
+		}
+	}
+	return newError("eval/match/none", node.Token, subject)
+}
+
 func evalReturnExpression(token token.Token, values []object.Object, c *Context) object.Object {
 	for _, v := range values {
 		if v.Type() == object.RESPONSE_OBJ {
@@ -1276,33 +1419,37 @@ func evalIndexExpression(tok token.Token, left, indexNode ast.Node, c *Context)
 		idx := index.Value
 		switch container := container.(type) {
 		case *object.List:
-			if idx < 0 || idx > len(container.Elements)-1 {
+			i := object.FromEnd(idx, len(container.Elements))
+			if i < 0 || i > int64(len(container.Elements))-1 {
 				return newError("eval/range/index/list", tok, idx, len(container.Elements))
 			}
-			return container.Elements[idx]
+			return container.Elements[i]
 		case *object.Tuple:
-			if idx < 0 || idx > len(container.Elements)-1 {
+			i := object.FromEnd(idx, len(container.Elements))
+			if i < 0 || i > int64(len(container.Elements))-1 {
 				return newError("eval/range/index/tuple", tok, idx, len(container.Elements))
 			}
-			return container.Elements[idx]
+			return container.Elements[i]
 		case *object.Pair:
-			if idx < 0 || idx > 1 {
+			i := object.FromEnd(idx, 2)
+			if i < 0 || i > 1 {
 				return newError("eval/range/index/pair", tok, idx, 2)
 			}
-			if idx == 0 {
+			if i == 0 {
 				return container.Left
 			}
 			return container.Right
 		case *object.String:
 			max := utf8.RuneCountInString(container.Value)
-			if idx < 0 || idx >= max {
+			i := object.FromEnd(idx, max)
+			if i < 0 || i >= int64(max) {
 				return newError("eval/range/index/string", tok, idx, max)
 			}
-			result := object.String{Value: string([]rune(container.Value)[idx])}
+			result := object.String{Value: string([]rune(container.Value)[i])}
 			return &result
 		case *object.Type:
 			if c.prsr.TypeSystem.PointsTo(container.Value, "enum") {
-				if idx < 0 || idx >= len(c.prsr.Enums[container.Value]) {
+				if idx < 0 || idx >= int64(len(c.prsr.Enums[container.Value])) {
 					return newError("eval/range/index/enum", tok, idx, container.Value)
 				}
 				return c.prsr.Enums[container.Value][idx]
@@ -1321,7 +1468,7 @@ func evalIndexExpression(tok token.Token, left, indexNode ast.Node, c *Context)
 		idy := index.Right.(*object.Integer).Value
 		switch container := container.(type) {
 		case *object.List:
-			max := len(container.Elements)
+			max := int64(len(container.Elements))
 			idy2 := idy
 			if idy < 0 {
 				idy2 = max + idy
@@ -1335,9 +1482,9 @@ func evalIndexExpression(tok token.Token, left, indexNode ast.Node, c *Context)
 			if (idx < 0) || (idy2 < idx) {
 				return newError("eval/range/slice/list", tok, idx, idy, max)
 			}
-			return container.DeepSlice(idx, idy)
+			return container.DeepSlice(int(idx), int(idy))
 		case *object.Tuple:
-			max := len(container.Elements)
+			max := int64(len(container.Elements))
 			idy2 := idy
 			if idy < 0 {
 				idy2 = max + idy
@@ -1345,9 +1492,9 @@ func evalIndexExpression(tok token.Token, left, indexNode ast.Node, c *Context)
 			if (idx < 0 || idx > max) || (idy2 < 0 || idy2 > max) || (idy2 < idx) {
 				return newError("eval/range/slice/tuple", tok, idx, idy, max)
 			}
-			return container.DeepSlice(idx, idy)
+			return container.DeepSlice(int(idx), int(idy))
 		case *object.String:
-			max := len(container.Value)
+			max := int64(len(container.Value))
 			idy2 := idy
 			if idy < 0 {
 				idy2 = max + idy
@@ -1517,7 +1664,7 @@ func functionCall(functionTree *ast.FnTreeNode, args []ast.Node, tok token.Token
 	values := []object.Object{}
 	newContext := c
 	if c.access == NAMESPACE {
-		newContext = &Context{access: REPL, prsr: c.prsr.RootService.Parser, env: c.env, logging: c.logging}
+		newContext = &Context{access: REPL, prsr: c.prsr.RootService.Parser, env: c.env, logging: c.logging, depth: c.depth}
 	}
 	for {
 		//We try to get the next single object from the list of args, i.e. if an arg evaluates to a tuple we must take it a bit at a time.
@@ -1644,6 +1791,20 @@ func functionCall(functionTree *ast.FnTreeNode, args []ast.Node, tok token.Token
 	}
 }
 
+// Like functionCall, but for when we already have the values of the arguments, including any bling.
+func functionCallWithValues(functionTree *ast.FnTreeNode, values []object.Object, tok token.Token, c *Context) object.Object {
+	treeWalker := newFunctionTreeWalker(functionTree)
+	for _, value := range values {
+		if !treeWalker.followBranch(c.prsr, object.TypeOrBling(value), string(value.Type())) {
+			return newErrorWithVals("eval/args/a", tok, values, values, false)
+		}
+	}
+	if !treeWalker.followBranch(c.prsr, "", "") {
+		return newErrorWithVals("eval/args/a", tok, values, values, false)
+	}
+	return applyFunction(*treeWalker.position.Fn, values, tok, c)
+}
+
 // Having got a Function type out of a lambda or the function tree, we can apply it to the values to get a return value.
 func applyFunction(f ast.Function, params []object.Object, tok token.Token, c *Context) object.Object {
 	if f.Private && c.access == REPL {
@@ -1668,19 +1829,49 @@ func applyFunction(f ast.Function, params []object.Object, tok token.Token, c *C
 	// We punt off the cases where the function body is a builtin or written in Go.
 	switch body := f.Body.(type) {
 	case *ast.BuiltInExpression:
-		newContext := &Context{prsr: c.prsr, logging: c.logging, env: env, access: newAccess}
+		newContext := &Context{prsr: c.prsr, logging: c.logging, env: env, access: newAccess, depth: c.depth + 1}
 		// First we hijack a few things which can't actually be implemented as builtins but are convenient to
 		// treat as such. (Or to put it another way this is a kludge, a shameful kludge. I could at least represent
 		// it as a map somewhere. (TODO.))
 		if body.Name == "for_loop" {
 			return evalForLoop(params, tok, c)
 		}
+		if body.Name == "while_loop" {
+			return evalWhileLoop(params, tok, c)
+		}
 		if body.Name == "get_from_input" {
 			return evalInput(params, tok, c)
 		}
 		if body.Name == "post_to_output" {
 			return evalOutput(params, tok, c)
 		}
+		if body.Name == "stack_depth" {
+			return &object.Integer{Value: int64(c.depth)}
+		}
+		if body.Name == "log_message" {
+			return evalLogMessage(params, tok, c)
+		}
+		if body.Name == "timeit" {
+			return evalTimeit(params, tok, c)
+		}
+		if body.Name == "pmap" {
+			return evalParallelMap(params, tok, c)
+		}
+		if body.Name == "min_by" || body.Name == "max_by" {
+			return evalBestBy(params, body.Name == "max_by", tok, c)
+		}
+		if body.Name == "partition" {
+			return evalPartition(params, tok, c)
+		}
+		if body.Name == "find" {
+			return evalFind(params, tok, c)
+		}
+		if body.Name == "scan" {
+			return evalScan(params, tok, c)
+		}
+		if body.Name == "merge_structs" {
+			return evalMergeStructs(params, tok, c)
+		}
 		if body.Name == "post_to_SQL" {
 			return evalPostSQL(params, tok, c)
 		}
@@ -1702,7 +1893,7 @@ func applyFunction(f ast.Function, params []object.Object, tok token.Token, c *C
 		}
 		return applyBuiltinFunction(f, params, tok, newContext) // Otherwise we can just call the builtin.
 	case *ast.GolangExpression:
-		newContext := &Context{prsr: c.prsr, logging: c.logging, env: env, access: newAccess}
+		newContext := &Context{prsr: c.prsr, logging: c.logging, env: env, access: newAccess, depth: c.depth + 1}
 		return applyGolangFunction(body, params, tok, newContext)
 
 	//So if we've got this far we have a regular old function/command/lambda with its body written in Charm.
@@ -1714,7 +1905,7 @@ func applyFunction(f ast.Function, params []object.Object, tok token.Token, c *C
 		if !f.Cmd {
 			newEnvironment.InitializeConstant("this", &object.Func{Function: f, Env: env}) // Commands aren't meant to be recursive.
 		}
-		newContext := &Context{prsr: c.prsr, logging: c.logging, env: newEnvironment, access: newAccess}
+		newContext := &Context{prsr: c.prsr, logging: c.logging, env: newEnvironment, access: newAccess, depth: c.depth + 1}
 		if f.Given != nil {
 			resultOfGiven := Eval(f.Given, newContext)
 			if resultOfGiven.Type() == object.ERROR_OBJ {
@@ -1746,6 +1937,276 @@ func evalOutput(params []object.Object, tok token.Token, c *Context) object.Obje
 	return evalReturnExpression(tok, params[0:len(params)-2], c)
 }
 
+// Writes a line with the time, the level and the message to wherever $logPath says, if the level is at least
+// $logLevel.
+func evalLogMessage(params []object.Object, tok token.Token, c *Context) object.Object {
+	level := params[0].(*object.String).Value
+	rank, ok := sysvars.LogLevels[level]
+	if !ok {
+		return newError("built/log/level", tok, level)
+	}
+	minimum, _ := c.prsr.AllGlobals.Get("$logLevel")
+	if rank >= sysvars.LogLevels[minimum.(*object.String).Value] {
+		if err := emit(time.Now().UTC().Format(time.RFC3339)+" ["+strings.ToUpper(level)+"] "+params[1].(*object.String).Value+"\n", tok, c); err != nil {
+			return err
+		}
+	}
+	return object.SUCCESS
+}
+
+// Applies a lambda of no arguments, returning how long that took in nanoseconds paired with the result.
+func evalTimeit(params []object.Object, tok token.Token, c *Context) object.Object {
+	lambda := params[0].(*object.Func)
+	newContext := c.withEnv(lambda.Env, LAMBDA)
+	start := time.Now()
+	result := applyFunction(lambda.Function, []object.Object{}, tok, newContext)
+	elapsed := time.Since(start)
+	if result.Type() == object.ERROR_OBJ {
+		result.(*object.Error).Trace = append(result.(*object.Error).Trace, tok)
+		return result
+	}
+	return &object.Pair{Left: &object.Integer{Value: elapsed.Nanoseconds()}, Right: result}
+}
+
+// Applies a lambda to each element of a list, using as many goroutines as there are CPUs. As with the '>>' operator,
+// the results are gathered into a list in order. If any of them are errors, we return the first.
+//
+// The calls share nothing mutable so long as the lambda is pure, and so we refuse a lambda which calls a command by
+// name. We also evaluate beforehand the local constants of any 'given' block the lambda can see, since otherwise the
+// calls would race to evaluate them and store the results. What's still shared is taken care of elsewhere: parsing at
+// runtime and logging each take turns. A command passed to the lambda as a value, or called through a variable, isn't
+// caught, and is not safe.
+func evalParallelMap(params []object.Object, tok token.Token, c *Context) object.Object {
+	elements := params[0].(*object.List).Elements
+	lambda := params[1].(*object.Func)
+	if callsCommand(lambda.Body, c.prsr) || lambda.Given != nil && callsCommand(lambda.Given, c.prsr) {
+		return newError("built/pmap/command", tok)
+	}
+	forceLazyValues(lambda.Env, tok, c)
+	results := make([]object.Object, len(elements))
+	indices := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < runtime.NumCPU() && worker < len(elements); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indices {
+				newContext := c.withEnv(lambda.Env, LAMBDA)
+				results[i] = applyFunction(lambda.Function, []object.Object{elements[i]}, tok, newContext)
+			}
+		}()
+	}
+	for i := range elements {
+		indices <- i
+	}
+	close(indices)
+	wg.Wait()
+	resultList := &object.List{Elements: []object.Object{}}
+	for _, result := range results {
+		if result.Type() == object.ERROR_OBJ {
+			result.(*object.Error).Trace = append(result.(*object.Error).Trace, tok)
+			return result
+		}
+		if result.Type() == object.TUPLE_OBJ {
+			resultList.Elements = append(resultList.Elements, result.(*object.Tuple).Elements...)
+		} else {
+			resultList.Elements = append(resultList.Elements, result)
+		}
+	}
+	return resultList
+}
+
+// Whether the code calls by name something which can only be a command.
+func callsCommand(node ast.Node, prsr *parser.Parser) bool {
+	operator := ""
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		operator = node.Operator
+	case *ast.InfixExpression:
+		operator = node.Operator
+	case *ast.SuffixExpression:
+		operator = node.Operator
+	case *ast.UnfixExpression:
+		operator = node.Operator
+	case *ast.ComparisonChain:
+		for _, operator := range node.Operators {
+			if isOnlyCommand(operator.Literal, prsr) {
+				return true
+			}
+		}
+	}
+	if isOnlyCommand(operator, prsr) {
+		return true
+	}
+	for _, child := range ast.Children(node) {
+		if callsCommand(child, prsr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isOnlyCommand(name string, prsr *parser.Parser) bool {
+	fns, ok := prsr.FunctionTable[name]
+	if !ok || len(fns) == 0 {
+		return false
+	}
+	for _, fn := range fns {
+		if !fn.Cmd {
+			return false
+		}
+	}
+	return true
+}
+
+// Evaluates whatever lazy values the environment can see, as though they had been used.
+func forceLazyValues(env *object.Environment, tok token.Token, c *Context) {
+	for e := env; e != nil; e = e.Ext {
+		names := []string{}
+		for name := range e.Store {
+			names = append(names, name)
+		}
+		for _, name := range names {
+			if val, _ := e.Get(name); val.Type() == object.LAZY_OBJ {
+				Eval(&ast.Identifier{Token: tok, Value: name}, c.withEnv(e, LAMBDA))
+			}
+		}
+	}
+}
+
+// Finds the element of a list for which the lambda returns the least, or if 'most' is set the greatest, number. Where
+// there's a tie, the first such element wins.
+func evalBestBy(params []object.Object, most bool, tok token.Token, c *Context) object.Object {
+	elements := params[0].(*object.List).Elements
+	lambda := params[1].(*object.Func)
+	if len(elements) == 0 {
+		return newError("built/minby/empty", tok)
+	}
+	var best, bestKey object.Object
+	for i, element := range elements {
+		newContext := c.withEnv(lambda.Env, LAMBDA)
+		key := applyFunction(lambda.Function, []object.Object{element}, tok, newContext)
+		switch key := key.(type) {
+		case *object.Error:
+			key.Trace = append(key.Trace, tok)
+			return key
+		case *object.Integer, *object.Float:
+		default:
+			return newErrorWithVals("built/minby/key", tok, []object.Object{key}, key)
+		}
+		if i == 0 || (most && isLess(bestKey, key)) || (!most && isLess(key, bestKey)) {
+			best, bestKey = element, key
+		}
+	}
+	return best
+}
+
+// Compares two numbers, which are compared as integers if they both are, so as not to lose precision.
+func isLess(x, y object.Object) bool {
+	if x, ok := x.(*object.Integer); ok {
+		if y, ok := y.(*object.Integer); ok {
+			return x.Value < y.Value
+		}
+	}
+	return object.AsFloat(x) < object.AsFloat(y)
+}
+
+// Returns the index and value of the first element of the list for which the lambda returns true, as a pair, or
+// NULL if there isn't one. We don't look any further than we have to.
+func evalFind(params []object.Object, tok token.Token, c *Context) object.Object {
+	lambda := params[1].(*object.Func)
+	for i, element := range params[0].(*object.List).Elements {
+		newContext := c.withEnv(lambda.Env, LAMBDA)
+		result := applyFunction(lambda.Function, []object.Object{element}, tok, newContext)
+		switch result := result.(type) {
+		case *object.Boolean:
+			if result.Value {
+				return &object.Pair{Left: &object.Integer{Value: int64(i)}, Right: element}
+			}
+		case *object.Error:
+			result.Trace = append(result.Trace, tok)
+			return result
+		default:
+			return newErrorWithVals("built/find/bool", tok, []object.Object{result}, result)
+		}
+	}
+	return object.NULL
+}
+
+// Splits a list into a pair of lists, of the elements for which the lambda returns true and those for which it
+// returns false, in the order they were in. This is the same as filtering the list twice, but in one pass.
+func evalPartition(params []object.Object, tok token.Token, c *Context) object.Object {
+	lambda := params[1].(*object.Func)
+	yes := &object.List{Elements: []object.Object{}}
+	no := &object.List{Elements: []object.Object{}}
+	for _, element := range params[0].(*object.List).Elements {
+		newContext := c.withEnv(lambda.Env, LAMBDA)
+		result := applyFunction(lambda.Function, []object.Object{element}, tok, newContext)
+		switch result := result.(type) {
+		case *object.Boolean:
+			if result.Value {
+				yes.Elements = append(yes.Elements, element)
+			} else {
+				no.Elements = append(no.Elements, element)
+			}
+		case *object.Error:
+			result.Trace = append(result.Trace, tok)
+			return result
+		default:
+			return newErrorWithVals("built/partition/bool", tok, []object.Object{result}, result)
+		}
+	}
+	return &object.Pair{Left: yes, Right: no}
+}
+
+// Folds the lambda over the list, starting from the initial value, and returns every value of the accumulator along
+// the way. The initial value is included, so the result is one longer than the list.
+func evalScan(params []object.Object, tok token.Token, c *Context) object.Object {
+	lambda := params[2].(*object.Func)
+	accumulator := params[1]
+	result := &object.List{Elements: []object.Object{accumulator}}
+	for _, element := range params[0].(*object.List).Elements {
+		newContext := c.withEnv(lambda.Env, LAMBDA)
+		accumulator = applyFunction(lambda.Function, []object.Object{accumulator, element}, tok, newContext)
+		if accumulator.Type() == object.ERROR_OBJ {
+			accumulator.(*object.Error).Trace = append(accumulator.(*object.Error).Trace, tok)
+			return accumulator
+		}
+		result.Elements = append(result.Elements, accumulator)
+	}
+	return result
+}
+
+// Makes a struct of the same type as the two it's given, each field of which is the lambda applied to their values
+// for that field.
+func evalMergeStructs(params []object.Object, tok token.Token, c *Context) object.Object {
+	a, b := params[0].(*object.Struct), params[1].(*object.Struct)
+	if a.Name != b.Name || a.Namespace != b.Namespace {
+		return newError("built/merge/type", tok, a.Name, b.Name)
+	}
+	lambda := params[2].(*object.Func)
+	result := &object.Struct{Name: a.Name, Labels: a.Labels, Value: make(map[string]object.Object), Namespace: a.Namespace}
+	for _, label := range a.Labels {
+		newContext := c.withEnv(lambda.Env, LAMBDA)
+		value := applyFunction(lambda.Function, []object.Object{a.Value[label], b.Value[label]}, tok, newContext)
+		if value.Type() == object.ERROR_OBJ {
+			value.(*object.Error).Trace = append(value.(*object.Error).Trace, tok)
+			return value
+		}
+		result.Value[label] = value
+	}
+	prsr := c.prsr.ParserOfNamespace(a.Namespace)
+	if prsr == nil {
+		return result
+	}
+	for _, field := range prsr.StructSig[a.Name] {
+		if !parser.IsObjectInType(prsr.TypeSystem, result.Value[field.VarName], field.VarType) {
+			return newError("built/struct/field-type/d", tok, field.VarName, a.Name, field.VarType, result.Value[field.VarName])
+		}
+	}
+	return result
+}
+
 func evalForLoop(params []object.Object, tok token.Token, c *Context) object.Object {
 	refName := params[0].(*object.Ref).VariableName
 	functionToApply := params[4].(*object.Func).Function
@@ -1759,7 +2220,7 @@ func evalForLoop(params []object.Object, tok token.Token, c *Context) object.Obj
 	var values []object.Object
 	switch rng := params[2].(type) {
 	case *object.Integer:
-		for i := 0; i < rng.Value; i++ {
+		for i := int64(0); i < rng.Value; i++ {
 			c.env.HardSet(refName, &object.Integer{Value: i})
 			if val.Type() == object.ERROR_OBJ {
 				val.(*object.Error).Trace = append(val.(*object.Error).Trace, tok)
@@ -1834,6 +2295,45 @@ func evalForLoop(params []object.Object, tok token.Token, c *Context) object.Obj
 	}
 }
 
+// This does what 'p z : while p do f to f z; else : z' would do, but by iterating rather than recursing, so that
+// long loops don't grow the stack. We bind p, f, and z in an environment of their own and evaluate 'p z' and 'f z'
+// in it, so that p and f can be lambdas or named functions just as they could in the Pipefish version.
+func evalWhileLoop(params []object.Object, tok token.Token, c *Context) object.Object {
+	env := object.NewEnvironment()
+	env.Ext = c.env
+	env.HardSet("p", params[0])
+	env.HardSet("f", params[2])
+	newContext := c.withEnv(env, c.access)
+	argToken := token.Token{Type: token.IDENT, Literal: "z", Line: tok.Line, ChStart: tok.ChStart, ChEnd: tok.ChEnd, Source: tok.Source}
+	arg := []ast.Node{&ast.Identifier{Token: argToken, Value: "z"}}
+	conditionToken := argToken
+	conditionToken.Literal = "p"
+	condition := &ast.PrefixExpression{Token: conditionToken, Operator: "p", Args: arg}
+	actionToken := argToken
+	actionToken.Literal = "f"
+	action := &ast.PrefixExpression{Token: actionToken, Operator: "f", Args: arg}
+	val := tuplify(params[4:])
+	for {
+		env.HardSet("z", val)
+		test := Eval(condition, newContext)
+		if test.Type() == object.ERROR_OBJ {
+			test.(*object.Error).Trace = append(test.(*object.Error).Trace, tok)
+			return test
+		}
+		if test.Type() != object.BOOLEAN_OBJ {
+			return newError("eval/while/bool", tok, test)
+		}
+		if test == object.FALSE {
+			return val
+		}
+		val = Eval(action, newContext)
+		if val.Type() == object.ERROR_OBJ {
+			val.(*object.Error).Trace = append(val.(*object.Error).Trace, tok)
+			return val
+		}
+	}
+}
+
 func evalPostContact(params []object.Object, tok token.Token, c *Context) object.Object {
 	result := evalContactExpression(params, tok, c)
 	if result.Type() == object.ERROR_OBJ {
@@ -2056,6 +2556,23 @@ func narrate(conditional ast.Node, c *Context) (bool, string) {
 			}
 			return false, leftStory + " and " + rightStory
 		}
+	case *ast.ComparisonChain:
+		story := ""
+		for i := range conditional.Operators {
+			result, linkStory := narrate(conditional.Link(i), c)
+			switch {
+			case i == 0:
+				story = linkStory
+			case result:
+				story = story + " and " + linkStory
+			default:
+				story = story + ", but " + linkStory
+			}
+			if !result {
+				return false, story
+			}
+		}
+		return true, story
 	case *ast.InfixExpression:
 		if conditional.Operator == "==" || conditional.Operator == "!=" || conditional.Operator == "<" ||
 			conditional.Operator == "<=" || conditional.Operator == ">" || conditional.Operator == ">=" {
@@ -2104,20 +2621,28 @@ func niceReturn(node ast.Node, c *Context) string {
 	return pretty(node.String()) + " = " + c.prsr.Serialize(Eval(node, c), parser.LITERAL) + "."
 }
 
-// Logs things to the appropriate place
-func emit(logStr string, tok token.Token, c *Context) {
+// Since 'pmap' may be evaluating lambdas concurrently, they have to take turns to log things.
+var emitting sync.Mutex
+
+// Logs things to the appropriate place, which is stdout or the file named by $logPath. This returns the error
+// eval/log/file if the file can't be opened, or eval/log/append if it can't be written to. Logging to stdout never
+// returns an error.
+func emit(logStr string, tok token.Token, c *Context) *object.Error {
+	emitting.Lock()
+	defer emitting.Unlock()
 	logPath, _ := c.prsr.AllGlobals.Get("$logPath")
 	logPathStr := logPath.(*object.String).Value
 	if logPathStr == "stdout" {
 		fmt.Print(logStr)
-		return
+		return nil
 	}
 	f, err := os.OpenFile(logPathStr, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
-		c.prsr.Throw("eval/log/file", tok)
+		return newError("eval/log/file", tok)
 	}
 	defer f.Close()
 	if _, err := f.WriteString(logStr); err != nil {
-		c.prsr.Throw("eval/log/append", tok)
+		return newError("eval/log/append", tok)
 	}
+	return nil
 }
@@ -0,0 +1,2059 @@
+package evaluator_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"pipefish/source/evaluator"
+	"pipefish/source/initializer"
+	"pipefish/source/object"
+	"pipefish/source/parser"
+	"pipefish/source/text"
+	"pipefish/source/token"
+)
+
+// Makes a service from the given script. The service gets a scratch directory of its own so that the Go handler
+// doesn't rewrite the repo's 'rsc/go/gotimes.dat', but reads the builtins and such from the repo's 'rsc/pipefish'.
+func makeTestService(t *testing.T, script string) *parser.Service {
+	dir := t.TempDir()
+	resources, err := filepath.Abs("../../rsc/pipefish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Join(dir, "rsc/go"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "rsc/go/gotimes.dat"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(resources, filepath.Join(dir, "rsc/pipefish")); err != nil {
+		t.Fatal(err)
+	}
+	scriptFilepath := filepath.Join(dir, "test.pf")
+	if err = os.WriteFile(scriptFilepath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	service, init := initializer.CreateService(scriptFilepath, nil, map[string]*parser.Service{}, parser.MakeStandardEffectHandler(os.Stdout), &parser.Service{}, "", dir+"/")
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	return service
+}
+
+type evalTest struct {
+	input    string
+	expected string
+}
+
+// Evaluates each input in the service as though it had been typed into the REPL, and checks the literal
+// serialization of the result.
+func runEvalTests(t *testing.T, service *parser.Service, tests []evalTest) {
+	for _, tt := range tests {
+		parsedLine := service.Parser.ParseLine("test", tt.input)
+		if service.Parser.ErrorsExist() {
+			t.Errorf("%s: %s", tt.input, service.Parser.ReturnErrors())
+			service.Parser.ClearErrors()
+			continue
+		}
+		result := evaluator.Evaluate(*parsedLine, evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+		if got := service.Parser.Serialize(result, parser.LITERAL); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEarlyExit(t *testing.T) {
+	service := makeTestService(t, `def
+
+classify(x int) :
+    x < 0 : "negative"
+    x == 0 : "zero"
+    x < 10 :
+        x % 2 == 0 : "small even"
+        else : "small odd"
+    else : "large"
+
+cmd
+
+find(x int) :
+    x < 0 : "negative"
+    y = x * 2
+    y > 10 : "big"
+    "small"
+`)
+	runEvalTests(t, service, []evalTest{
+		{`classify -1`, `"negative"`},
+		{`classify 0`, `"zero"`},
+		{`classify 3`, `"small odd"`},
+		{`classify 4`, `"small even"`},
+		{`classify 20`, `"large"`},
+		{`find -1`, `"negative"`},
+		{`find 7`, `"big"`},
+		{`find 2`, `"small"`},
+	})
+}
+
+func TestWhileLoop(t *testing.T) {
+	service := makeTestService(t, `def
+
+sumTo(n int) :
+    (while (func(i, acc) : i <= n) do (func(i, acc) : i + 1, acc + i) to 1, 0)[1]
+
+recursiveSumTo(n int) :
+    n == 0 : 0
+    else : n + recursiveSumTo(n - 1)
+
+doubleUntilBig(x) :
+    while (func(y) : y < 100) do (func(y) : 2 * y) to x
+
+badLoop(x) :
+    while (func(y) : y) do (func(y) : 2 * y) to x
+`)
+	runEvalTests(t, service, []evalTest{
+		{`sumTo 4`, `10`},
+		{`sumTo 0`, `0`},
+		{`sumTo 1000 == recursiveSumTo 1000`, `true`},
+		{`sumTo 100000`, `5000050000`},
+		{`doubleUntilBig 3`, `192`},
+		{`(badLoop 3)[errorCode]`, `"eval/while/bool"`},
+	})
+}
+
+func TestBreakAndContinue(t *testing.T) {
+	service := makeTestService(t, `cmd
+
+firstOver(L list, n int) :
+    i = 0
+    loop :
+        i == len L : break
+        x = L[i]
+        i = i + 1
+        x > n :
+            post x to Output()
+            break
+        post "skipped " + (string x) to Output()
+
+evens(L list) :
+    i = 0
+    loop :
+        i == len L : break
+        x = L[i]
+        i = i + 1
+        x % 2 == 1 : continue
+        post x to Output()
+
+grid(n int) :
+    i = 0
+    loop :
+        i = i + 1
+        i > n : break
+        j = 0
+        loop :
+            j = j + 1
+            j > n : break
+            j == i : continue
+            post i, j to Output()
+`)
+	var out bytes.Buffer
+	service.Parser.EffHandle = parser.MakeStandardEffectHandler(&out)
+	tests := []evalTest{
+		{`firstOver([1, 5, 3], 4)`, "skipped 1\n5\n"},
+		{`firstOver([1, 2], 4)`, "skipped 1\nskipped 2\n"},
+		{`evens [1, 2, 3, 4, 5, 6]`, "2\n4\n6\n"},
+		{`grid 2`, "1, 2\n2, 1\n"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		result := evaluator.Evaluate(*service.Parser.ParseLine("test", tt.input), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+		if result.Type() == object.ERROR_OBJ {
+			t.Errorf("%s: %s", tt.input, result.(*object.Error).Message)
+			continue
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestLabeledLoops(t *testing.T) {
+	service := makeTestService(t, `cmd
+
+findPair(n int) :
+    i = 0
+    loop outer :
+        i = i + 1
+        j = 0
+        loop :
+            j = j + 1
+            j > 5 : break
+            i * j == n :
+                post i, j to Output()
+                break outer
+        i > 5 : break
+
+skipRows(n int) :
+    i = 0
+    loop rows :
+        i = i + 1
+        i > n : break
+        j = 0
+        loop cols :
+            j = j + 1
+            j > n : break
+            j > i : continue rows
+            post i, j to Output()
+`)
+	var out bytes.Buffer
+	service.Parser.EffHandle = parser.MakeStandardEffectHandler(&out)
+	tests := []evalTest{
+		{`findPair 6`, "2, 3\n"},
+		{`findPair 7`, ""},
+		{`skipRows 2`, "1, 1\n2, 1\n2, 2\n"},
+	}
+	for _, tt := range tests {
+		out.Reset()
+		result := evaluator.Evaluate(*service.Parser.ParseLine("test", tt.input), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+		if result.Type() == object.ERROR_OBJ {
+			t.Errorf("%s: %s", tt.input, result.(*object.Error).Message)
+			continue
+		}
+		if out.String() != tt.expected {
+			t.Errorf("%s: expected output %q, got %q", tt.input, tt.expected, out.String())
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	service := makeTestService(t, `def
+
+Color = enum RED, GREEN, BLUE
+
+describeInt(x int) :
+    match x :
+        0 : "zero"
+        1 : "one"
+        2 : "two"
+        else : "many"
+
+describeString(s string) :
+    match s :
+        "" : "empty"
+        "hello" : "greeting"
+        else : "string of length " + string len s
+
+describe(x) :
+    match x :
+        0 : "zero"
+        int : "integer"
+        string : "string"
+        Color : "color"
+
+hue(c Color) :
+    match c :
+        RED : 0
+        GREEN : 120
+        BLUE : 240
+`)
+	runEvalTests(t, service, []evalTest{
+		{`describeInt 0`, `"zero"`},
+		{`describeInt 2`, `"two"`},
+		{`describeInt 42`, `"many"`},
+		{`describeString ""`, `"empty"`},
+		{`describeString "hello"`, `"greeting"`},
+		{`describeString "abc"`, `"string of length 3"`},
+		{`describe 0`, `"zero"`},
+		{`describe 7`, `"integer"`},
+		{`describe "foo"`, `"string"`},
+		{`describe GREEN`, `"color"`},
+		{`(describe 1.5)[errorCode]`, `"eval/match/none"`},
+		{`hue RED`, `0`},
+		{`hue BLUE`, `240`},
+	})
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	service := makeTestService(t, `var
+
+v = 10
+
+def
+
+c = 5
+
+cmd
+
+add(n int) :
+    x = n
+    x += 3
+    x
+
+subtract(n int) :
+    x = n
+    x -= 3
+    x
+
+multiply(n int) :
+    x = n
+    x *= 3
+    x
+
+concatenate(s string) :
+    x = s
+    x += "!"
+    x
+
+changeConstant :
+    c += 1
+`)
+	runEvalTests(t, service, []evalTest{
+		{`add 4`, `7`},
+		{`subtract 4`, `1`},
+		{`multiply 4`, `12`},
+		{`concatenate "hello"`, `"hello!"`},
+		{`(changeConstant)[errorCode]`, `"eval/cmd/const"`},
+		{`v += 5`, `ok`},
+		{`v`, `15`},
+		{`v -= 1`, `ok`},
+		{`v *= 2`, `ok`},
+		{`v`, `28`},
+		{`(c += 1)[errorCode]`, `"eval/repl/const"`},
+	})
+}
+
+func TestStructUnionFields(t *testing.T) {
+	service := makeTestService(t, `def
+
+Cell = struct(name string, content int/string/bool)
+
+Box = struct(cell Cell, n int)
+
+describe(x int/string) : "int or string"
+
+describe(x) : "something else"
+`)
+	runEvalTests(t, service, []evalTest{
+		{`Cell("a", 1)`, `Cell with (name::"a", content::1)`},
+		{`Cell("a", "b")`, `Cell with (name::"a", content::"b")`},
+		{`Cell("a", true)`, `Cell with (name::"a", content::true)`},
+		{`(Cell("a", true))[content]`, `true`},
+		{`(Cell("a", 1.5))[errorCode]`, `"eval/struct/field-type/a"`},
+		{`(Cell(1, 1))[errorCode]`, `"eval/struct/field-type/a"`},
+		{`Cell with name::"a", content::2`, `Cell with (name::"a", content::2)`},
+		{`(Cell with name::"a", content::2.5)[errorCode]`, `"eval/struct/field-type/b"`},
+		{`Cell("a", 1) with content::"q"`, `Cell with (name::"a", content::"q")`},
+		{`(Cell("a", 1) with content::1.5)[errorCode]`, `"built/struct/field-type/a"`},
+		{`Box(Cell("a", 1), 3) with [cell, content]::"z"`, `Box with (cell::Cell with (name::"a", content::"z"), n::3)`},
+		{`(Box(Cell("a", 1), 3) with [cell, content]::1.5)[errorCode]`, `"built/struct/field-type/a"`},
+		{`describe 1`, `"int or string"`},
+		{`describe "a"`, `"int or string"`},
+		{`describe 1.5`, `"something else"`},
+	})
+}
+
+func TestNamedFieldConstruction(t *testing.T) {
+	service := makeTestService(t, `def
+
+Point = struct(x int, y int)
+
+Person = struct(name string, age int)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`Point(1, 2)`, `Point with (x::1, y::2)`},
+		{`Point(x::1, y::2)`, `Point with (x::1, y::2)`},
+		{`Point(y::2, x::1)`, `Point with (x::1, y::2)`},
+		{`Point(y::2, x::1) == Point(1, 2)`, `true`},
+		{`Person(age::42, name::"Doug")`, `Person with (name::"Doug", age::42)`},
+		{`(Point(x::1))[errorCode]`, `"eval/struct/missing-field"`},
+		{`(Point with y::2)[errorCode]`, `"eval/struct/missing-field"`},
+		{`(Point(x::1, age::2))[errorCode]`, `"eval/struct/unknown-field"`},
+		{`(Point(y::"two", x::1))[errorCode]`, `"eval/struct/field-type/b"`},
+	})
+}
+
+func TestSameFields(t *testing.T) {
+	service := makeTestService(t, `def
+
+Point = struct(x int, y int)
+
+Vector = struct(x int, y int)
+
+Line = struct(start Point, end Point)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`same_fields(Point(1, 2), Point(1, 2))`, `true`},
+		{`same_fields(Point(1, 2), Point(y::2, x::1))`, `true`},
+		{`same_fields(Point(1, 2), Point(2, 1))`, `false`},
+		{`same_fields(Point(1, 2), Vector(1, 2))`, `false`},
+		{`same_fields(Line(Point(0, 0), Point(1, 2)), Line(Point(0, 0), Point(1, 2)))`, `true`},
+		{`same_fields(Line(Point(0, 0), Point(1, 2)), Line(Point(0, 0), Point(1, 3)))`, `false`},
+	})
+}
+
+func TestSameFieldsFromNamespace(t *testing.T) {
+	library := filepath.Join(t.TempDir(), "geometry.pf")
+	if err := os.WriteFile(library, []byte("def\n\nPoint = struct(x int, y int)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	service := makeTestService(t, "import\n\n\""+library+"\"\n\ndef\n\nPoint = struct(x int, y int)\n")
+	runEvalTests(t, service, []evalTest{
+		{`same_fields(geometry.Point(1, 2), geometry.Point(1, 2))`, `true`},
+		{`same_fields(Point(1, 2), geometry.Point(1, 2))`, `false`},
+	})
+}
+
+func TestEnumAsSet(t *testing.T) {
+	service := makeTestService(t, `def
+
+Color = enum RED, GREEN, BLUE
+
+Size = enum SMALL, LARGE
+
+isColor(x) : x in Color
+
+colors : Color as set
+
+sizes : Size as set
+`)
+	runEvalTests(t, service, []evalTest{
+		{`RED in Color`, `true`},
+		{`isColor BLUE`, `true`},
+		{`isColor SMALL`, `false`},
+		{`isColor 1`, `false`},
+		{`Color as set`, `set (RED, GREEN, BLUE)`},
+		{`GREEN in colors`, `true`},
+		{`SMALL in colors`, `false`},
+		{`len sizes`, `2`},
+		{`(Color as list)[errorCode]`, `"built/as/type"`},
+		{`(int as set)[errorCode]`, `"built/as/type"`},
+	})
+}
+
+func TestNegativeIndexing(t *testing.T) {
+	service := makeTestService(t, `def
+
+L = [1, 2, 3]
+
+T = ("a", "b", "c")
+
+P = "x"::"y"
+
+S = "héllo"
+`)
+	runEvalTests(t, service, []evalTest{
+		{`L[0]`, `1`},
+		{`L[-1]`, `3`},
+		{`L[-3]`, `1`},
+		{`(L[-4])[errorCode]`, `"eval/range/index/list"`},
+		{`(L[3])[errorCode]`, `"eval/range/index/list"`},
+		{`T[-1]`, `"c"`},
+		{`T[-3]`, `"a"`},
+		{`(T[-4])[errorCode]`, `"eval/range/index/tuple"`},
+		{`P[-1]`, `"y"`},
+		{`P[-2]`, `"x"`},
+		{`(P[-3])[errorCode]`, `"eval/range/index/pair"`},
+		{`(P[2])[errorCode]`, `"eval/range/index/pair"`},
+		{`S[-1]`, `"o"`},
+		{`S[-4]`, `"é"`},
+		{`(S[-6])[errorCode]`, `"eval/range/index/string"`},
+	})
+}
+
+func TestMultiDimensionalIndexing(t *testing.T) {
+	service := makeTestService(t, `def
+
+Cell = struct(row int, col int)
+
+grid = [[1, 2, 3], [4, 5, 6]]
+
+cube = [[[1, 2], [3, 4]], [[5, 6], [7, 8]]]
+
+people = [map("name"::"Doug", "age"::42), map("name"::"Zaphod", "age"::200)]
+
+cells = [Cell(0, 1), Cell(1, 2)]
+
+at(r, c int) : grid[r, c]
+`)
+	runEvalTests(t, service, []evalTest{
+		{`grid[0, 0]`, `1`},
+		{`grid[1, 2]`, `6`},
+		{`grid[1, -1]`, `6`},
+		{`grid[1, 2] == grid[1][2]`, `true`},
+		{`at(1, 0)`, `4`},
+		{`cube[1, 0, 1]`, `6`},
+		{`people[1, "name"]`, `"Zaphod"`},
+		{`people[0, "age"]`, `42`},
+		{`cells[1, col]`, `2`},
+		{`(grid[2, 0])[errorCode]`, `"eval/range/index/list"`},
+		{`(grid[0, 3])[errorCode]`, `"eval/range/index/list"`},
+		{`(people[0, "height"])[errorCode]`, `"eval/map/key"`},
+	})
+}
+
+func TestCount(t *testing.T) {
+	service := makeTestService(t, `def
+
+isEven(x int) : x % 2 == 0
+`)
+	runEvalTests(t, service, []evalTest{
+		{`count([1, 2, 3, 4], func(x) : x % 2 == 0)`, `2`},
+		{`count([1, 2, 3, 4], isEven)`, `2`},
+		{`count([1, 3, 5], isEven)`, `0`},
+		{`count([], isEven)`, `0`},
+		{`count("banana", "an")`, `2`},
+		{`count("aaaa", "aa")`, `2`},
+		{`count("banana", "x")`, `0`},
+		{`count(map("a"::1, "b"::2, "c"::3))`, `3`},
+		{`count(map())`, `0`},
+	})
+}
+
+func TestListTupleConversion(t *testing.T) {
+	service := makeTestService(t, `def
+
+L = [1, 2, 3]
+
+T = 1, 2, 3
+`)
+	runEvalTests(t, service, []evalTest{
+		{`as_list(1, 2, 3)`, `[1, 2, 3]`},
+		{`as_list 1`, `[1]`},
+		{`as_list()`, `[]`},
+		{`as_tuple [1, 2, 3]`, `1, 2, 3`},
+		{`as_tuple [1]`, `tuple (1)`},
+		{`as_tuple []`, `()`},
+		{`as_list(as_tuple L) == L`, `true`},
+		{`as_tuple(as_list T) == T`, `true`},
+		{`as_list(T, as_tuple L)`, `[1, 2, 3, 1, 2, 3]`},
+		{`[T, L]`, `[1, 2, 3, [1, 2, 3]]`},
+	})
+}
+
+func TestTryDivide(t *testing.T) {
+	service := makeTestService(t, `def
+
+ratioOrZero(a, b int) :
+    result[0] : result[1]
+    else : 0
+given :
+    result = try_divide(a, b)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`try_divide(7, 2)`, `true::3`},
+		{`try_divide(-6, 3)`, `true::-2`},
+		{`try_divide(7, 0)`, `false::0`},
+		{`try_divide(7.0, 2.0)`, `true::3.500000`},
+		{`try_divide(7.0, 0.0)`, `false::0.000000`},
+		{`(try_divide(7, 0))[0]`, `false`},
+		{`(7 / 0)[errorCode]`, `"built/div/int"`},
+		{`ratioOrZero(9, 3)`, `3`},
+		{`ratioOrZero(9, 0)`, `0`},
+	})
+}
+
+func TestFloorDivision(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`floor_div(7, 3)`, `2`},
+		{`floor_div(-7, 3)`, `-3`},
+		{`floor_div(7, -3)`, `-3`},
+		{`floor_div(-7, -3)`, `2`},
+		{`floor_div(6, -3)`, `-2`},
+		{`floor_div(0, -3)`, `0`},
+		{`floor_mod(7, 3)`, `1`},
+		{`floor_mod(-7, 3)`, `2`},
+		{`floor_mod(7, -3)`, `-2`},
+		{`floor_mod(-7, -3)`, `-1`},
+		{`floor_mod(-6, 3)`, `0`},
+		{`-7 % 3`, `-1`},
+		{`-7 / 3`, `-2`},
+		{`(floor_div(7, 0))[errorCode]`, `"built/floordiv/int"`},
+		{`(floor_mod(7, 0))[errorCode]`, `"built/floormod/int"`},
+	})
+}
+
+func TestClampAndLerp(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`clamp(5, 0, 10)`, `5`},
+		{`clamp(-1, 0, 10)`, `0`},
+		{`clamp(11, 0, 10)`, `10`},
+		{`clamp(0, 0, 10)`, `0`},
+		{`clamp(10, 0, 10)`, `10`},
+		{`clamp(3, 7, 7)`, `7`},
+		{`(clamp(5, 10, 0))[errorCode]`, `"built/clamp/range"`},
+		{`clamp(0.5, 0.0, 1.0)`, `0.500000`},
+		{`clamp(-0.5, 0.0, 1.0)`, `0.000000`},
+		{`clamp(1.5, 0.0, 1.0)`, `1.000000`},
+		{`clamp(2.5, 1.0, 1.0)`, `1.000000`},
+		{`(clamp(0.5, 1.0, 0.0))[errorCode]`, `"built/clamp/range"`},
+		{`lerp(2.0, 4.0, 0.0)`, `2.000000`},
+		{`lerp(2.0, 4.0, 1.0)`, `4.000000`},
+		{`lerp(2.0, 4.0, 0.25)`, `2.500000`},
+		{`lerp(2.0, 4.0, 2.0)`, `6.000000`},
+		{`lerp(3.0, 3.0, 0.5)`, `3.000000`},
+	})
+}
+
+func TestSign(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`sign 42`, `1`},
+		{`sign 0`, `0`},
+		{`sign -7`, `-1`},
+		{`sign 0.5`, `1`},
+		{`sign -0.5`, `-1`},
+		{`sign 0.0`, `0`},
+		{`sign -0.0`, `0`},
+		{`(sign float64 "NaN")[errorCode]`, `"built/sign/nan"`},
+		{`copysign(3.0, -1.0)`, `-3.000000`},
+		{`copysign(-3.0, 2.0)`, `3.000000`},
+		{`copysign(3.0, -0.0)`, `-3.000000`},
+		{`copysign(3.0, 0.0)`, `3.000000`},
+	})
+}
+
+func TestTrigonometryAndLogarithms(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`sin 0.0`, `0.000000`},
+		{`cos 0.0`, `1.000000`},
+		{`tan 0.0`, `0.000000`},
+		{`asin 1.0`, `1.570796`},
+		{`asin -1.0`, `-1.570796`},
+		{`acos 1.0`, `0.000000`},
+		{`acos -1.0`, `3.141593`},
+		{`(asin 1.5)[errorCode]`, `"built/trig/domain"`},
+		{`(acos -1.01)[errorCode]`, `"built/trig/domain"`},
+		{`atan 1.0`, `0.785398`},
+		{`atan2(1.0, -1.0)`, `2.356194`},
+		{`exp 0.0`, `1.000000`},
+		{`exp 1.0`, `2.718282`},
+		{`ln 1.0`, `0.000000`},
+		{`ln exp 2.0`, `2.000000`},
+		{`log10 1000.0`, `3.000000`},
+		{`(ln 0.0)[errorCode]`, `"built/log/domain"`},
+		{`(ln -1.0)[errorCode]`, `"built/log/domain"`},
+		{`(log10 0.0)[errorCode]`, `"built/log/domain"`},
+	})
+}
+
+func TestFloatConstants(t *testing.T) {
+	service := makeTestService(t, `def
+
+circumference(r float64) : 2.0 * PI * r
+`)
+	runEvalTests(t, service, []evalTest{
+		{`PI`, `3.141593`},
+		{`E`, `2.718282`},
+		{`ln E`, `1.000000`},
+		{`circumference 1.0`, `6.283185`},
+		{`INF > 1000000.0`, `true`},
+		{`NEG_INF < -1000000.0`, `true`},
+		{`is_inf INF`, `true`},
+		{`is_inf NEG_INF`, `true`},
+		{`is_inf 1.0`, `false`},
+		{`is_inf NAN`, `false`},
+		{`is_nan NAN`, `true`},
+		{`is_nan INF - INF`, `true`},
+		{`is_nan 0.0 * INF`, `true`},
+		{`is_nan 1.0`, `false`},
+		{`is_nan INF`, `false`},
+		{`NAN == NAN`, `false`},
+	})
+}
+
+func TestFloatDivision(t *testing.T) {
+	service := makeTestService(t, `def
+
+half(x int) : x / 2
+`)
+	runEvalTests(t, service, []evalTest{
+		{`5 / 2`, `2`},
+		{`-5 / 2`, `-2`},
+		{`half 5`, `2`},
+		{`5.0 / 2.0`, `2.500000`},
+		{`$floatDivision`, `false`},
+	})
+	service = makeTestService(t, `var
+
+$floatDivision = true
+
+def
+
+half(x int) : x / 2
+`)
+	runEvalTests(t, service, []evalTest{
+		{`5 / 2`, `2.500000`},
+		{`-5 / 2`, `-2.500000`},
+		{`4 / 2`, `2.000000`},
+		{`half 5`, `2.500000`},
+		{`5.0 / 2.0`, `2.500000`},
+		{`floor_div(5, 2)`, `2`},
+		{`(5 / 0)[errorCode]`, `"built/div/int"`},
+		{`$floatDivision = false`, `ok`},
+		{`5 / 2`, `2`},
+		{`($floatDivision = 1)[errorCode]`, `"sys/floatdivision/bool"`},
+	})
+}
+
+func TestCompletions(t *testing.T) {
+	script := `def
+
+Color = enum RED, GREEN
+
+Person = struct(name string, age int)
+
+limit = 10
+
+area(width, height int) : width * height
+
+scale(x int) :
+    x * factor
+given :
+    factor, offset = 2, 1
+
+double(y int) : 2 * y
+`
+	service := makeTestService(t, script)
+	// Each test gives some code, with a '|' at the cursor.
+	for _, tt := range []struct {
+		code     string
+		expected []parser.Completion
+	}{
+		{"area(width, height int) : wid|", []parser.Completion{{Name: "width", Kind: parser.VARIABLE_COMPLETION}}},
+		{"scale(x int) :\n    x * fac|\ngiven :\n    factor, offset = 2, 1", []parser.Completion{{Name: "factor", Kind: parser.VARIABLE_COMPLETION}}},
+		{"scale(x int) :\n    x * off|\ngiven :\n    factor, offset = 2, 1", []parser.Completion{{Name: "offset", Kind: parser.VARIABLE_COMPLETION}}},
+		{"area(width, height int) : width\n\ndouble(y int) : wid|", []parser.Completion{}},
+		{"foo(x int) : lim|", []parser.Completion{{Name: "limit", Kind: parser.VARIABLE_COMPLETION}}},
+		{"foo(x int) : GR|", []parser.Completion{{Name: "GREEN", Kind: parser.ELEMENT_COMPLETION}}},
+		{"foo(p Pers|", []parser.Completion{{Name: "Person", Kind: parser.FUNCTION_COMPLETION}, {Name: "Person", Kind: parser.TYPE_COMPLETION}}},
+		{"foo(p Person) : p[ag|]", []parser.Completion{{Name: "age", Kind: parser.LABEL_COMPLETION}}},
+		{"foo(x int) : dou|", []parser.Completion{{Name: "double", Kind: parser.FUNCTION_COMPLETION}}},
+	} {
+		pos := strings.Index(tt.code, "|")
+		code := tt.code[:pos] + tt.code[pos+1:]
+		got := service.Completions(code, pos)
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: expected %v, got %v", tt.code, tt.expected, got)
+		}
+	}
+}
+
+func TestDefinition(t *testing.T) {
+	script := `def
+
+Color = enum RED, GREEN
+
+Person = struct(name string, age int)
+
+limit = 10
+
+area(width, height int) : width * height
+
+scale(x int) :
+    x * factor + limit
+given :
+    factor = 2
+
+paint(p Person, c Color) : p[name], GREEN, area(1, 2)
+
+newtype Number = int/float64
+
+half(n Number) : n / 2
+`
+	service := makeTestService(t, script)
+	// Each test finds the identifier starting at the first occurrence of the given text in the script.
+	for _, tt := range []struct {
+		at           string
+		expectedLine int
+		expectedCh   int
+	}{
+		{"area(1, 2)", 9, 0},
+		{"factor + limit", 14, 4},
+		{"limit\n", 7, 0},
+		{"width * height", 9, 5},
+		{"height\n", 9, 12},
+		{"GREEN, area", 3, 18},
+		{"name], GREEN", 5, 16},
+		{"Person, c", 5, 0},
+		{"p[name]", 16, 6},
+		{"Color)", 3, 0},
+		{"Number) :", 18, 8},
+	} {
+		tok, ok := service.Definition(script, strings.Index(script, tt.at))
+		if !ok {
+			t.Errorf("%q: found no definition", tt.at)
+		} else if tok.Line != tt.expectedLine || tok.ChStart != tt.expectedCh {
+			t.Errorf("%q: expected definition at %d:%d, got %d:%d", tt.at, tt.expectedLine, tt.expectedCh, tok.Line, tok.ChStart)
+		}
+	}
+	if tok, ok := service.Definition("x = sum L", 4); !ok || !strings.HasSuffix(tok.Source, "builtins.pf") {
+		t.Errorf("expected to find 'sum' in the builtins, got %v", tok)
+	}
+	if _, ok := service.Definition("zort troz", 1); ok {
+		t.Errorf("expected to find no definition of 'zort'")
+	}
+}
+
+func TestReturnTypeOf(t *testing.T) {
+	service := makeTestService(t, `def
+
+double(x int) -> int : 2 * x
+
+divmod(x, y int) -> int, int : x / y, x % y
+
+parse(s string) -> int/bool :
+    s == "" :
+        false
+    else :
+        int s
+
+untyped(x) : x
+
+describe(x int) -> string : "int"
+
+describe(x bool) -> string : "bool"
+
+describe(x string) -> int : 0
+`)
+	runEvalTests(t, service, []evalTest{
+		{`return_type_of double`, `"int"`},
+		{`return_type_of(double)`, `"int"`},
+		{`return_type_of divmod`, `"(int, int)"`},
+		{`return_type_of parse`, `"int/bool"`},
+		{`parse ""`, `false`},
+		{`parse "42"`, `42`},
+		{`return_type_of untyped`, `"tuple"`},
+		{`return_type_of describe`, `"string/int"`},
+		{`return_type_of func(x) : x`, `"tuple"`},
+	})
+}
+
+func TestTypeOf(t *testing.T) {
+	service := makeTestService(t, `var
+
+counter = 0
+
+cmd
+
+bump :
+    counter = counter + 1
+
+def
+
+describe(x int) -> string : "int"
+
+describe(x bool) -> bool : x
+
+divmod(x, y int) -> int, int : x / y, x % y
+
+parse(s string) -> int/bool :
+    s == "" :
+        false
+    else :
+        int s
+`)
+	for _, tt := range []evalTest{
+		{`1 + 2`, `int`},
+		{`1.5 * 2.0`, `float64`},
+		{`"a" + "b"`, `string`},
+		{`1 + 2 < 4`, `bool`},
+		{`counter`, `int`},
+		{`describe 1`, `string`},
+		{`describe true`, `bool`},
+		{`describe(1 + 2)`, `string`},
+		{`divmod(7, 2)`, `(int, int)`},
+		{`parse "3"`, `int/bool`},
+		{`describe parse "3"`, `string/bool`},
+	} {
+		got, err := service.TypeOf(tt.input)
+		if err != nil {
+			t.Errorf("%s: %s", tt.input, err)
+		} else if got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+	if _, err := service.TypeOf(`describe "x"`); err == nil {
+		t.Errorf("expected an error finding the type of a call with no matching overload")
+	}
+	if _, err := service.TypeOf(`bump`); err != nil {
+		t.Error(err)
+	}
+	runEvalTests(t, service, []evalTest{
+		{`counter`, `0`},
+	})
+}
+
+func TestDescribe(t *testing.T) {
+	service := makeTestService(t, `def
+`)
+	for _, tt := range []evalTest{
+		{`[1, 2]`, `[1, 2]`},
+		{`[1, 2, 3]`, `[1, 2, 3]`},
+		{`[1, 2, 3, 4, 5]`, `[1, 2, 3, ... (2 more)]`},
+		{`set(1, 2, 3, 4)`, `set (1, 2, 3, ... (1 more))`},
+		{`1, 2, 3, 4`, `1, 2, 3, ... (1 more)`},
+		{`map(1::2, 3::4, 5::6, 7::8)`, `map(... (1 more))`},
+		{`[[1, 2, 3, 4], [5, 6], [7], [8]]`, `[[1, 2, 3, ... (1 more)], [5, 6], [7], ... (1 more)]`},
+	} {
+		parsedLine := service.Parser.ParseLine("test", tt.input)
+		result := evaluator.Evaluate(*parsedLine, evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+		got := service.Parser.Describe(result, parser.LITERAL, 3)
+		if tt.input[0:3] == "map" {
+			got = got[0:4] + got[len(got)-len("... (1 more))"):] // Because the order of the shown pairs is undefined.
+		}
+		if got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+		if full := service.Parser.Serialize(result, parser.LITERAL); strings.Contains(full, "more)") {
+			t.Errorf("%s: expected serialization not to be cut short, got %s", tt.input, full)
+		}
+	}
+	runEvalTests(t, service, []evalTest{
+		{`$maxElements`, `100`},
+		{`$maxElements = 0`, `ok`},
+		{`($maxElements = -1)[errorCode]`, `"sys/maxelements/int"`},
+		{`($maxElements = "ten")[errorCode]`, `"sys/maxelements/int"`},
+	})
+}
+
+func TestIgnoredNames(t *testing.T) {
+	service := makeTestService(t, `var
+
+a, _, _ = 1, 2, 3
+_, b = 4, 5
+
+def
+
+third(_, _, z) : z
+
+second(_ int, y int) : y
+
+f = func(_, y) : y
+
+cmd
+
+grab :
+    c, _ = 6, 7
+    c
+`)
+	runEvalTests(t, service, []evalTest{
+		{`third 1, 2, 3`, `3`},
+		{`second 1, 2`, `2`},
+		{`(second "x", 2)[errorCode]`, `"eval/args/a"`},
+		{`f 1, 2`, `2`},
+		{`a`, `1`},
+		{`b`, `5`},
+		{`grab`, `6`},
+		{`a, _ = 8, 9`, `ok`},
+		{`a`, `8`},
+		{`_[errorCode]`, `"eval/repl/var"`},
+	})
+}
+
+func TestDebugType(t *testing.T) {
+	service := makeTestService(t, `def
+
+Person = struct(name string, age int)
+
+Color = enum RED, GREEN
+
+double(x int) : 2 * x
+`)
+	runEvalTests(t, service, []evalTest{
+		{`debug_type 42`, `"int (*object.Integer)"`},
+		{`debug_type map(1::2)`, `"map (*object.Hash)"`},
+		{`debug_type Person "Joe", 42`, `"struct (*object.Struct)"`},
+		{`type Person "Joe", 42`, `Person`},
+		{`debug_type RED`, `"label (*object.Label)"`},
+		{`debug_type double`, `"outer function (*object.OuterFunc)"`},
+		{`debug_type NULL`, `"null (*object.Null)"`},
+	})
+}
+
+func TestSetField(t *testing.T) {
+	service := makeTestService(t, `var
+
+joe = Person "Joe", 42
+
+def
+
+Person = struct(name string, age int)
+
+Cat = struct(name string, pink bool)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`set_field joe, age, 43`, `Person with (name::"Joe", age::43)`},
+		{`(set_field joe, name, "Jim")[name]`, `"Jim"`},
+		{`joe[age]`, `42`},
+		{`(set_field joe, pink, true)[errorCode]`, `"built/field/missing"`},
+		{`(set_field joe, age, "old")[errorCode]`, `"built/struct/field-type/b"`},
+	})
+}
+
+func TestSetFieldFromNamespace(t *testing.T) {
+	library := filepath.Join(t.TempDir(), "shop.pf")
+	if err := os.WriteFile(library, []byte("def\n\nStock = struct(apples, pears int)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	service := makeTestService(t, "import\n\n\""+library+"\"\n")
+	runEvalTests(t, service, []evalTest{
+		{`set_field shop.Stock(1, 2), shop.apples, 3`, `shop.Stock with (apples::3, pears::2)`},
+		{`(set_field shop.Stock(1, 2), shop.apples, "lots")[errorCode]`, `"built/struct/field-type/b"`},
+		{`shop.Stock(1, 2) with shop.pears::3`, `shop.Stock with (apples::1, pears::3)`},
+		{`(shop.Stock(1, 2) with shop.pears::"few")[errorCode]`, `"built/struct/field-type/a"`},
+	})
+}
+
+func TestFlags(t *testing.T) {
+	service := makeTestService(t, `def
+
+Perm = flags READ, WRITE, EXEC
+
+Mode = flags BINARY, APPEND
+
+RW = READ | WRITE
+
+canWrite(p Perm) : has_flag p, WRITE
+`)
+	runEvalTests(t, service, []evalTest{
+		{`(int READ), (int WRITE), (int EXEC)`, `1, 2, 4`},
+		{`RW`, `READ | WRITE`},
+		{`int RW`, `3`},
+		{`type RW`, `Perm`},
+		{`WRITE | READ == RW`, `true`},
+		{`RW | EXEC`, `READ | WRITE | EXEC`},
+		{`RW & WRITE`, `WRITE`},
+		{`READ & WRITE`, `no_flags Perm`},
+		{`(READ & WRITE) == no_flags Perm`, `true`},
+		{`has_flag RW, READ`, `true`},
+		{`has_flag RW, EXEC`, `false`},
+		{`canWrite RW`, `true`},
+		{`canWrite EXEC`, `false`},
+		{`RW in Perm`, `true`},
+		{`Perm[2]`, `EXEC`},
+		{`(READ | APPEND)[errorCode]`, `"built/flags/mix"`},
+		{`(no_flags int)[errorCode]`, `"built/flags/type"`},
+	})
+}
+
+func TestMultilineStrings(t *testing.T) {
+	service := makeTestService(t, "def\n\n"+
+		"query(table string) :\n    \"\"\"\n    SELECT *\n      FROM \"\"\" + table + \"\"\"\n    \"\"\"\n\n"+
+		"greeting = \"\"\"He said \"hi\".\"\"\"\n\n"+
+		"x = 5\n")
+	runEvalTests(t, service, []evalTest{
+		{`query "t" == "SELECT *\n  FROM t"`, `true`},
+		{`greeting == "He said \"hi\"."`, `true`},
+		{`x`, `5`},
+	})
+}
+
+func TestStringInterpolation(t *testing.T) {
+	service := makeTestService(t, "def\n\n"+
+		"card = \"\"\"\n    Name: {name}\n    Next year: {age + 1}\n    \"\"\"\n\n"+
+		"name = \"Joe\"\n\n"+
+		"age = 43\n\n"+
+		"greet(n string) : \"Hello, {n}!\"\n")
+	runEvalTests(t, service, []evalTest{
+		{`"Hello, {name}! You are {age} years old"`, `"Hello, Joe! You are 43 years old"`},
+		{`"{age}{age}"`, `"4343"`},
+		{`type "{age}"`, `string`},
+		{`"{[1, 2] + [3]}, {{1, 2}}"`, `"[1, 2, 3], set (1, 2)"`},
+		{`"{2.5} {true} {1, 2}"`, `"2.500000 true 1, 2"`},
+		{`"{name + \"!\"}"`, `"Joe!"`},
+		{`"{\"<{name}>\"}"`, `"<Joe>"`},
+		{`"\{name}"`, `"\{name}"`},
+		{`"\\{name}"`, `"\\Joe"`},
+		{"`{name}`", `"\{name}"`},
+		{`greet "Jim"`, `"Hello, Jim!"`},
+		{`card == "Name: Joe\nNext year: 44"`, `true`},
+	})
+	for input, errorID := range map[string]string{`"a{}b"`: "parse/template/empty", `"a{b"`: "parse/template/brace"} {
+		service.Parser.ParseLine("test", input)
+		if !service.Parser.ErrorsExist() || service.Parser.Errors[0].ErrorId != errorID {
+			t.Errorf("%s: expected error %q, got %s", input, errorID, service.Parser.ReturnErrors())
+		}
+		service.Parser.ClearErrors()
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	service := makeTestService(t, "def\n\npath = `C:\\new\\table`\n")
+	runEvalTests(t, service, []evalTest{
+		{"len `a\\nb`", `4`},
+		{"path == \"C:\\\\new\\\\table\"", `true`},
+		{"`say \"hi\"` == \"say \\\"hi\\\"\"", `true`},
+		{"`\\d+{2}` == \"\\\\d+\\{2}\"", `true`},
+		{"count path, `\\`", `2`},
+	})
+}
+
+func TestEscapes(t *testing.T) {
+	service := makeTestService(t, "def\n\nx = 1\n")
+	runEvalTests(t, service, []evalTest{
+		{`"caf\u00e9" == "café"`, `true`},
+		{`len "a\tb"`, `3`},
+		{`len "\\\"\{"`, `3`},
+		{`"\{x\}" == ` + "`{x}`", `true`},
+	})
+}
+
+func TestLiteralRoundTrip(t *testing.T) {
+	service := makeTestService(t, "def\n\ns = \"say \\\"hi\\\"\\n\\\\ {1 + 1} \\{x}\\t\"\n")
+	runEvalTests(t, service, []evalTest{
+		{`s`, `"say \"hi\"\n\\ 2 \{x}\t"`},
+		{`eval literal s`, `"say \"hi\"\n\\ 2 \{x}\t"`},
+		{`(eval literal s) == s`, `true`},
+		{`(eval literal [s, "\{"]) == [s, "\{"]`, `true`},
+	})
+}
+
+func TestCommentsInContinuations(t *testing.T) {
+	service := makeTestService(t, `def
+
+Person = struct(name string, // The person's name.
+             .. age int)     // Their age in years.
+
+Color = enum RED,  // The default.
+          // Not to be confused with blue.
+          .. GREEN
+
+add(a int, // The first summand.
+ .. b int) : a + b
+
+total = 1 + ..  // Comments can follow '..' too.
+     .. 2
+`)
+	runEvalTests(t, service, []evalTest{
+		{`Person "Joe", 43`, `Person with (name::"Joe", age::43)`},
+		{`Color[1]`, `GREEN`},
+		{`add 1, 2`, `3`},
+		{`total`, `3`},
+	})
+}
+
+func TestTrailingCommas(t *testing.T) {
+	service := makeTestService(t, `def
+
+Person = struct(name string, age int,)
+
+add(a int, b int,) : a + b
+
+L = [1,
+  .. 2,
+  .. ]
+`)
+	runEvalTests(t, service, []evalTest{
+		{`[1, 2,]`, `[1, 2]`},
+		{`{1, 2, }`, `set (1, 2)`},
+		{`len map(1::2, 3::4,)`, `2`},
+		{`(map(1::2, 3::4,))[3]`, `4`},
+		{`(1, 2,)`, `1, 2`},
+		{`add 1, 2`, `3`},
+		{`add(1, 2,)`, `3`},
+		{`Person "Joe", 43`, `Person with (name::"Joe", age::43)`},
+		{`L`, `[1, 2]`},
+	})
+}
+
+func TestSemicolons(t *testing.T) {
+	service := makeTestService(t, `def
+
+sumUp(x int) : y + z
+given :
+    y = x + 1; z = 2
+
+classify(x int) : x == 1 : a; else : b
+given : a = "one"; b = "many"
+
+cmd
+
+count :
+    x = 1; y = 2
+    x + y
+
+countInline : x = 1; y = x + 1; y * 10
+`)
+	runEvalTests(t, service, []evalTest{
+		{`sumUp 1`, `4`},
+		{`classify 1`, `"one"`},
+		{`classify 2`, `"many"`},
+		{`count`, `3`},
+		{`countInline`, `20`},
+	})
+}
+
+func TestFormatSource(t *testing.T) {
+	service := makeTestService(t, "def\n\nmessy = \"add(x, y int):x+y\\n\"\n")
+	runEvalTests(t, service, []evalTest{
+		{`format_source messy`, `"add(x, y int) : x + y\n"`},
+		{`format_source "Point=struct(x int,\n.. y int)"`, `"Point = struct(x int,\n            .. y int)\n"`},
+		{`format_source "x = \"zort"`, `error "can't format code, line 1: string unterminated by end of line"`},
+	})
+}
+
+func TestTimeit(t *testing.T) {
+	service := makeTestService(t, `def
+
+nap(ms int) : builtin "test_nap"
+`)
+	service.Parser.BuiltinFunctions["test_nap"] = func(p *parser.Parser, tok token.Token, args ...object.Object) object.Object {
+		time.Sleep(time.Duration(args[0].(*object.Integer).Value) * time.Millisecond)
+		return args[0]
+	}
+	result := evaluator.Evaluate(*service.Parser.ParseLine("test", "timeit func() : nap 20"), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+	pair, ok := result.(*object.Pair)
+	if !ok {
+		t.Fatalf("expected a pair, got %s", service.Parser.Serialize(result, parser.LITERAL))
+	}
+	if nanos := pair.Left.(*object.Integer).Value; nanos < int64(20*time.Millisecond) {
+		t.Errorf("expected at least %d nanoseconds, got %d", 20*time.Millisecond, nanos)
+	}
+	if got := service.Parser.Serialize(pair.Right, parser.LITERAL); got != "20" {
+		t.Errorf("expected the result of the lambda to be 20, got %s", got)
+	}
+	runEvalTests(t, service, []evalTest{
+		{`(timeit func() : 1 + 2)[1]`, `3`},
+		{`(timeit func() : 1 / 0)`, `error "division by zero"`},
+	})
+}
+
+func TestParallelMap(t *testing.T) {
+	service := makeTestService(t, `def
+
+L = [1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20]
+
+square(x) : x * x
+
+pair(x) : x, x
+
+cmd
+
+scaled(M list) :
+    pmap(M, func(x) : x * k)
+given :
+    k = 3
+
+shout(x) :
+    post x
+`)
+	runEvalTests(t, service, []evalTest{
+		{`pmap([], func(x) : x)`, `[]`},
+		{`pmap([1, 2, 3], func(x) : square x)`, `[1, 4, 9]`},
+		{`pmap(L, func(x) : square x) == (L >> square that)`, `true`},
+		{`pmap(L, func(x) : pair x) == (L >> pair that)`, `true`},
+		{`pmap([1, 0, 2], func(x) : 1 / x)`, `error "division by zero"`},
+		{`scaled(L) == (L >> 3 * that)`, `true`},
+		{`(pmap([1, 2], func(x) : shout x))[errorCode]`, `"built/pmap/command"`},
+	})
+}
+
+func TestChannels(t *testing.T) {
+	service := makeTestService(t, "def\n")
+	evaluate := func(line string) object.Object {
+		return evaluator.Evaluate(*service.Parser.ParseLine("test", line), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+	}
+	ch, ok := evaluate("new_channel 1").(*object.Channel)
+	if !ok {
+		t.Fatalf("expected a channel")
+	}
+	service.Env.InitializeConstant("ch", ch)
+	sent := make(chan object.Object)
+	go func() {
+		sent <- evaluate(`send(ch, "hello")`)
+	}()
+	if result := <-sent; result.Type() == object.ERROR_OBJ {
+		t.Errorf("expected sending to succeed, got %s", service.Parser.Serialize(result, parser.LITERAL))
+	}
+	if got := service.Parser.Serialize(evaluate("receive ch"), parser.LITERAL); got != `"hello"` {
+		t.Errorf(`expected to receive "hello", got %s`, got)
+	}
+	unbuffered, ok := evaluate("new_channel 0").(*object.Channel)
+	if !ok {
+		t.Fatalf("expected a channel")
+	}
+	service.Env.InitializeConstant("unbuffered", unbuffered)
+	// Sending and receiving never wait, so they're errors unless something else is waiting on the other end.
+	runEvalTests(t, service, []evalTest{
+		{`type new_channel 1`, `channel`},
+		{`new_channel -1`, `error "can't make a channel with negative capacity '-1'"`},
+		{`send(ch, 1)`, `ok`},
+		{`(send(ch, 2))[errorCode]`, `"built/channel/full"`},
+		{`receive ch`, `1`},
+		{`(receive ch)[errorCode]`, `"built/channel/empty"`},
+		{`(send(unbuffered, 1))[errorCode]`, `"built/channel/full"`},
+		{`(receive unbuffered)[errorCode]`, `"built/channel/empty"`},
+	})
+}
+
+func TestClonesInParallel(t *testing.T) {
+	service := makeTestService(t, `var
+
+x = 0
+
+cmd
+
+setX(n int) :
+    global x
+    x = n
+`)
+	results := make([]string, 50)
+	done := make(chan bool)
+	for i := range results {
+		go func(i int) {
+			clone := service.Clone()
+			for _, line := range []string{"setX " + strconv.Itoa(i), "x"} {
+				result := evaluator.Evaluate(*clone.Parser.ParseLine("test", line), evaluator.NewContext(clone.Parser, clone.Env, evaluator.REPL, false))
+				results[i] = clone.Parser.Serialize(result, parser.LITERAL)
+			}
+			done <- true
+		}(i)
+	}
+	for range results {
+		<-done
+	}
+	for i, result := range results {
+		if result != strconv.Itoa(i) {
+			t.Errorf("expected clone %d to have x = %d, got %s", i, i, result)
+		}
+	}
+	runEvalTests(t, service, []evalTest{{`x`, `0`}})
+}
+
+func TestClonesHaveTheirOwnNamespaces(t *testing.T) {
+	library := filepath.Join(t.TempDir(), "counter.pf")
+	if err := os.WriteFile(library, []byte("var\n\nx = 0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	service := makeTestService(t, "import\n\n\""+library+"\"\n")
+	clone := service.Clone()
+	runEvalTests(t, clone, []evalTest{{`counter.x = 5`, `ok`}, {`counter.x`, `5`}})
+	runEvalTests(t, service, []evalTest{{`counter.x`, `0`}})
+}
+
+func TestStackDepth(t *testing.T) {
+	service := makeTestService(t, `def
+
+fail(n int) :
+    n == 0 :
+        1 / 0
+    else :
+        fail(n - 1)
+
+var
+
+depth = 0
+
+cmd
+
+probe(n int) :
+    global depth
+    n == 0 :
+        depth = stack_depth
+    else :
+        probe(n - 1)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`stack_depth`, `0`},
+		{`probe 0`, ``},
+		{`depth`, `1`},
+		{`probe 3`, ``},
+		{`depth`, `4`},
+		// The depth belongs to the evaluation, so one that fails deep in a call doesn't leave any behind.
+		{`(fail 3)[errorCode]`, `"built/div/int"`},
+		{`stack_depth`, `0`},
+		{`probe 2`, ``},
+		{`depth`, `3`},
+	})
+}
+
+func TestSubtypesAndSupertypes(t *testing.T) {
+	service := makeTestService(t, `def
+
+Color = enum RED, GREEN, BLUE
+
+Suit = enum CLUBS, HEARTS
+
+Person = struct(name string, age int)
+
+Pet = struct(name string)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`subtypes enum`, `[Color, Suit]`},
+		{`subtypes label`, `[Color, Suit, field]`},
+		{`subtypes int`, `[int]`},
+		{`subtypes Person`, `[Person]`},
+		{`subtypes Color?`, `[Color, null]`},
+		{`supertypes Color`, `[Color?, enum, enum?, label, label?, single, single?, tuple]`},
+		{`int? in (supertypes int)`, `true`},
+		{`Person in (supertypes Pet)`, `false`},
+	})
+}
+
+func TestCast(t *testing.T) {
+	service := makeTestService(t, `def
+
+Color = enum RED, GREEN
+`)
+	runEvalTests(t, service, []evalTest{
+		{`cast(3, float64)`, `3.000000`},
+		{`cast(3.9, int)`, `3`},
+		{`cast(-3.9, int)`, `-3`},
+		{`cast(3, int)`, `3`},
+		{`cast(2.5, float64)`, `2.500000`},
+		{`cast(RED, Color)`, `RED`},
+		{`cast("3", string)`, `"3"`},
+		{`cast(INF, int)`, `error "can't cast '+Inf' to 'int'"`},
+		{`cast(2.0 ** 63.0, int)`, `error "can't cast '9.223372036854776e+18' to 'int'"`},
+		{`cast(-(2.0 ** 63.0), int)`, `-9223372036854775808`},
+		{`cast([1], int)`, `error "can't cast value of type 'list' to 'int'"`},
+		{`cast(true, float64)`, `error "can't cast value of type 'bool' to 'float64'"`},
+		{`cast(3, single)`, `error "can't cast to abstract type 'single'"`},
+	})
+}
+
+func TestEntries(t *testing.T) {
+	service := makeTestService(t, `def
+
+Person = struct(name string, age int)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`entries Person "Joe", 22`, `[name::"Joe", age::22]`},
+		{`entries ["a", "b"]`, `[0::"a", 1::"b"]`},
+		{`entries []`, `[]`},
+		{`entries map("a"::1)`, `["a"::1]`},
+		{`len entries map("a"::1, "b"::2)`, `2`},
+		{`("b"::2) in entries map("a"::1, "b"::2)`, `true`},
+		{`entries 3`, `error "can't find implementation of function 'entries' accepting parameters of the given types '<int>'"`},
+	})
+}
+
+func TestHasKey(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`has_key map("a"::1, "b"::2), "a"`, `true`},
+		{`has_key map("a"::1, "b"::2), "c"`, `false`},
+		{`has_key map("a"::NULL), "a"`, `true`},
+		{`has_key map(), 1`, `false`},
+		{`(has_key map("a"::1), [1])[errorCode]`, `"built/map/hashable"`},
+	})
+}
+
+func TestMergeStructs(t *testing.T) {
+	service := makeTestService(t, `def
+
+Stock = struct(apples, pears int)
+
+Person = struct(name string, age int)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`merge_structs Stock(1, 2), Stock(3, 4), func(x, y) : x + y`, `Stock with (apples::4, pears::6)`},
+		{`merge_structs Stock(1, 5), Stock(3, 4), func(x, y) : x * y`, `Stock with (apples::3, pears::20)`},
+		{`(merge_structs Stock(1, 2), Person("Joe", 22), func(x, y) : x)[errorCode]`, `"built/merge/type"`},
+		{`(merge_structs Stock(1, 2), Stock(3, 4), func(x, y) : "no")[errorCode]`, `"built/struct/field-type/d"`},
+		{`(merge_structs Stock(1, 2), Stock(3, 4), func(x, y) : x / 0)[errorCode]`, `"built/div/int"`},
+	})
+}
+
+func TestMergeStructsFromNamespace(t *testing.T) {
+	library := filepath.Join(t.TempDir(), "shop.pf")
+	if err := os.WriteFile(library, []byte("def\n\nStock = struct(apples, pears int)\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	service := makeTestService(t, "import\n\n\""+library+"\"\n")
+	runEvalTests(t, service, []evalTest{
+		{`merge_structs shop.Stock(1, 2), shop.Stock(3, 4), func(x, y) : x + y`, `shop.Stock with (apples::4, pears::6)`},
+		{`(merge_structs shop.Stock(1, 2), shop.Stock(3, 4), func(x, y) : "no")[errorCode]`, `"built/struct/field-type/d"`},
+	})
+}
+
+func TestSerialize(t *testing.T) {
+	service := makeTestService(t, `def
+
+Color = enum RED, GREEN, BLUE
+
+Perm = flags READ, WRITE, EXEC
+
+Person = struct(name string, age int)
+
+Wrapper = struct(contents single)
+`)
+	runEvalTests(t, service, []evalTest{
+		{`serialize 42`, `"42"`},
+		{`serialize -7`, `"-7"`},
+		{`serialize 2.0`, `"2.0"`},
+		{`serialize 0.1`, `"0.1"`},
+		{`serialize 1.0 / 3.0`, `"0.3333333333333333"`},
+		{`serialize "a \"b\"\n"`, `"\"a \\\"b\\\"\\n\""`},
+		{`serialize true`, `"true"`},
+		{`serialize NULL`, `"NULL"`},
+		{`serialize GREEN`, `"GREEN"`},
+		{`serialize READ | EXEC`, `"READ | EXEC"`},
+		{`serialize int`, `"int"`},
+		{`serialize [1, "a"]`, `"[1, \"a\"]"`},
+		{`serialize set(3, 1, 2)`, `"set(1, 2, 3)"`},
+		{`serialize map("b"::2, "a"::1)`, `"map(\"a\"::1, \"b\"::2)"`},
+		{`serialize((1::2)::3)`, `"(1::2)::3"`},
+		{`serialize 1, 2`, `"tuple(1, 2)"`},
+		{`serialize Person("Joe", 22)`, `"Person with (name::\"Joe\", age::22)"`},
+		{`serialize set(3, 1, 2) == serialize set(2, 3, 1)`, `true`},
+		{`(serialize func(x) : x)[errorCode]`, `"built/serialize/type"`},
+		{`deserialize "[1, 2.5, \"a\"]"`, `[1, 2.500000, "a"]`},
+		{`deserialize "tuple(1, 2)"`, `1, 2`},
+		{`deserialize "  map( \"a\" :: 1 ) "`, `map("a"::1)`},
+		{`(deserialize "[1, 2")[errorCode]`, `"built/deserialize"`},
+		{`(deserialize "foo")[errorCode]`, `"built/deserialize"`},
+		{`(deserialize "Person with (name::\"Joe\")")[errorCode]`, `"built/deserialize"`},
+		{`(deserialize "Person with (name::\"Joe\", age::\"old\")")[errorCode]`, `"built/deserialize"`},
+		{`(deserialize "map([1]::2)")[errorCode]`, `"built/deserialize"`},
+		{`(deserialize "set(1, 1)")[errorCode]`, `"built/deserialize"`},
+		{`(deserialize "map(1::2, 1::3)")[errorCode]`, `"built/deserialize"`},
+		{`(deserialize "Person with (name::\"Joe\", name::\"Jim\", age::3)")[errorCode]`, `"built/deserialize"`},
+	})
+	roundTrips := []string{`42`, `-7`, `0.1`, `1.0 / 3.0`, `-2.5`, `"tab\tbrace\{ quote\" unicode é"`, `""`, `true`,
+		`false`, `NULL`, `GREEN`, `READ`, `READ | EXEC`, `READ & WRITE`, `int`, `Person`, `name`, `[]`, `[1, [2, 3]]`,
+		`set()`, `set(3, "a", 1)`, `1::2`, `(1::2)::(3::4)`,
+		`Person("Joe", 22)`, `Wrapper(Wrapper([Person("Joe", 22)]))`, `Wrapper(1::RED)`}
+	for _, value := range roundTrips {
+		runEvalTests(t, service, []evalTest{
+			{`deserialize(serialize(` + value + `)) == ` + value, `true`},
+		})
+	}
+	runEvalTests(t, service, []evalTest{
+		{`is_nan deserialize serialize float64 "NaN"`, `true`},
+		{`deserialize(serialize(float64 "Inf")) == float64 "Inf"`, `true`},
+		{`serialize float64 "-Inf"`, `"-Inf"`},
+		{`deserialize(serialize(float64 "-Inf")) == float64 "-Inf"`, `true`},
+		{`deserialize(serialize(1, "a")) == (1, "a")`, `true`},
+		// There's no '==' for maps, so we check that they serialize the same after the round trip.
+		{`serialize(deserialize(serialize(map()))) == serialize(map())`, `true`},
+		{`serialize(deserialize(serialize(map("b"::2, "a"::[1], 3::set(4))))) == serialize(map("b"::2, "a"::[1], 3::set(4)))`, `true`},
+		{`(deserialize(serialize(map("a"::1, "b"::2))))["b"]`, `2`},
+	})
+}
+
+func TestIsSame(t *testing.T) {
+	service := makeTestService(t, `def
+
+Person = struct(name string, age int)
+
+sharing(L list) :
+    is_same L, L
+
+copying(L list) :
+    is_same L, L + []
+
+var
+
+M = [1, 2, 3]
+`)
+	runEvalTests(t, service, []evalTest{
+		{`sharing [1, 2, 3]`, `true`},
+		{`copying [1, 2, 3]`, `false`},
+		{`M == M + []`, `true`},
+		{`is_same M, M + []`, `false`},
+		{`is_same M, M`, `true`},
+		{`is_same [1, 2], [1, 2]`, `false`},
+		{`is_same map("a"::1), map("a"::1)`, `false`},
+		{`is_same Person("Joe", 22), Person("Joe", 22)`, `false`},
+		{`is_same 3, 3`, `true`},
+		{`is_same "a", "a"`, `true`},
+		{`is_same 3, "3"`, `false`},
+		{`is_same NULL, NULL`, `true`},
+	})
+}
+
+func TestRepeatListAndCycle(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`repeat_list "a", 0`, `[]`},
+		{`repeat_list "a", 1`, `["a"]`},
+		{`repeat_list [0, 0], 3`, `[[0, 0], [0, 0], [0, 0]]`},
+		{`cycle [1, 2], 0`, `[]`},
+		{`cycle [1, 2], 1`, `[1, 2]`},
+		{`cycle [1, 2], 3`, `[1, 2, 1, 2, 1, 2]`},
+		{`cycle [], 5`, `[]`},
+		{`cycle [], 4611686018427387904`, `[]`},
+		{`(repeat_list "a", -1)[errorCode]`, `"built/repeat/count"`},
+		{`(cycle [1, 2], -2)[errorCode]`, `"built/repeat/count"`},
+	})
+}
+
+func TestMapIndexing(t *testing.T) {
+	service := makeTestService(t, `var
+
+M = map("a"::1, "b"::NULL, 3::[4])
+`)
+	runEvalTests(t, service, []evalTest{
+		{`M["a"]`, `1`},
+		{`M["b"]`, `NULL`},
+		{`M[3][0]`, `4`},
+		{`(M["c"])[errorCode]`, `"eval/map/key"`},
+		{`has_key(M, "c") : M["c"] ; else : 0`, `0`},
+		{`(M[[1]])[errorCode]`, `"eval/map/hashable"`},
+	})
+}
+
+func TestFlatten(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`flatten_list []`, `[]`},
+		{`flatten_list [[1, 2], [], [3]]`, `[1, 2, 3]`},
+		{`flatten_list [1, [2, 3], "a"]`, `[1, 2, 3, "a"]`},
+		{`flatten_list [1, [2, [3, [4]]]]`, `[1, 2, [3, [4]]]`},
+		{`flatten_list chunks [1, 2, 3, 4, 5], 2`, `[1, 2, 3, 4, 5]`},
+		{`flatten_deep []`, `[]`},
+		{`flatten_deep [1, [2, [3, [4]]]]`, `[1, 2, 3, 4]`},
+		{`flatten_deep [[[]], [[1], 2], set(3)]`, `[1, 2, set (3)]`},
+	})
+}
+
+func TestComparisonChains(t *testing.T) {
+	service := makeTestService(t, `def
+
+Temperature = struct(degrees float64)
+
+(a Temperature) < (b Temperature) : a[degrees] < b[degrees]
+
+inRange(x) : 0 <= x < 10
+`)
+	runEvalTests(t, service, []evalTest{
+		{`0 <= 5 < 10`, `true`},
+		{`0 <= 10 < 10`, `false`},
+		{`0 <= -1 < 10`, `false`},
+		{`1 < 2 < 3 < 4`, `true`},
+		{`1 < 2 < 2 < 4`, `false`},
+		{`3 > 2 >= 2 > 1`, `true`},
+		{`1 < 3 > 2`, `true`},
+		{`0.5 < 1.5 <= 1.5`, `true`},
+		{`inRange 3`, `true`},
+		{`inRange 30`, `false`},
+		{`1 < 2 < 3 and 3 < 2`, `false`},
+		{`not 1 < 2 < 3`, `false`},
+		{`Temperature(1.0) < Temperature(2.0) < Temperature(3.0)`, `true`},
+		{`Temperature(1.0) < Temperature(2.0) < Temperature(0.0)`, `false`},
+		// Once a comparison is false we stop, so the error in the last operand is never reached.
+		{`2 < 1 < 1 / 0`, `false`},
+		{`(1 < 2 < 1 / 0)[errorCode]`, `"built/div/int"`},
+		{`(1 < "a" < 3)[errorCode]`, `"eval/args/a"`},
+		// A comparison in parentheses isn't part of the chain.
+		{`((0 < 1) < 2)[errorCode]`, `"eval/args/a"`},
+	})
+	ch, ok := evaluator.Evaluate(*service.Parser.ParseLine("test", "new_channel 2"),
+		evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false)).(*object.Channel)
+	if !ok {
+		t.Fatalf("expected a channel")
+	}
+	service.Env.InitializeConstant("ch", ch)
+	// If the middle operand were evaluated twice, the second evaluation would receive 20.
+	runEvalTests(t, service, []evalTest{
+		{`send(ch, 5)`, `ok`},
+		{`send(ch, 20)`, `ok`},
+		{`0 <= receive(ch) < 10`, `true`},
+		{`receive ch`, `20`},
+	})
+}
+
+func TestFind(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`find [3, 8, 5, 10], func(x) : x % 2 == 0`, `1::8`},
+		{`find [4, 8], func(x) : x % 2 == 0`, `0::4`},
+		{`find [1, 3, 5], func(x) : x % 2 == 0`, `NULL`},
+		{`find [], func(x) : true`, `NULL`},
+		// We stop at the first match, so the division by zero is never reached.
+		{`find [1, 0], func(x) : 1 / x == 1`, `0::1`},
+		{`(find [1, 2], func(x) : x)[errorCode]`, `"built/find/bool"`},
+	})
+}
+
+func TestOverloadingConversions(t *testing.T) {
+	service := makeTestService(t, `def
+
+Temperature = struct(degrees float64)
+
+string(t Temperature) : string(t[degrees]) + " degrees"
+
+int(t Temperature) : int(t[degrees])
+
+float64(t Temperature) : t[degrees]
+`)
+	runEvalTests(t, service, []evalTest{
+		{`string(Temperature(3.5))`, `"3.500000 degrees"`},
+		{`int(Temperature(3.5))`, `3`},
+		{`float64(Temperature(3.5))`, `3.500000`},
+		{`string(3)`, `"3"`},
+		{`int("42")`, `42`},
+		{`string(Temperature(1.0)) + "!"`, `"1.000000 degrees!"`},
+	})
+}
+
+func TestDumpDispatchTree(t *testing.T) {
+	service := makeTestService(t, `def
+
+foo(x int) : 1
+
+foo(x string, y int) : 2
+
+foo(x single) : 3
+
+(x int) ++ (y int) : x + y
+`)
+	for _, test := range []struct{ keyword, expected string }{
+		{"foo", `int
+    -> foo (x int)
+    -> foo (x single)
+string
+    int
+        -> foo (x string, y int)
+    -> foo (x single)
+single
+    -> foo (x single)
+`},
+		{"++", `int
+    ++
+        int
+            -> ++ (x int, ++ bling, y int)
+`},
+		{"nonexistent", ""},
+	} {
+		if got := service.DumpDispatchTree(test.keyword); got != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.keyword, test.expected, got)
+		}
+	}
+}
+
+func TestPower(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`2 ** 10`, `1024`},
+		{`(-3) ** 3`, `-27`},
+		{`7 ** 0`, `1`},
+		{`(2 ** -1)[errorCode]`, `"built/exp/neg"`},
+		{`2.0 ** 0.5`, `1.414214`},
+		{`4.0 ** -0.5`, `0.500000`},
+		// It binds more tightly than '*' and associates to the right.
+		{`2 * 3 ** 2`, `18`},
+		{`2 ** 3 ** 2`, `512`},
+		// But less tightly than '-' as a prefix, like every other infix.
+		{`-2 ** 2`, `4`},
+		{`-(2 ** 2)`, `-4`},
+	})
+}
+
+// A function in the 'given' block is a lambda assigned to a local constant, so it can see the parameters of the
+// function it belongs to and call itself, but nothing outside the function can see it.
+func TestGivenHelpers(t *testing.T) {
+	service := makeTestService(t, `def
+
+fib(n int) :
+    step(n)
+given :
+    step(k int) :
+        k < 2 : k
+        else : step(k - 1) + step(k - 2)
+
+sumTo(n int) :
+    step(1, 0)
+given :
+    step(k int, acc int) :
+        k > n : acc
+        else : step(k + 1, acc + k)
+
+fibOf(x single) :
+    step(x)
+given :
+    step(k int) : fib k
+`)
+	runEvalTests(t, service, []evalTest{
+		{`fib 10`, `55`},
+		{`sumTo 4`, `10`},
+		{`(step 3)[errorCode]`, `"eval/unknown/prefix"`},
+		{`(fibOf 2.0)[errorCode]`, `"eval/sig/lambda"`},
+	})
+}
+
+func TestRangeWithStep(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`range 0::10, 3`, `[0, 3, 6, 9]`},
+		{`range 5::0, -2`, `[5, 3, 1]`},
+		{`range 0::0, 1`, `[]`},
+		{`range 9223372036854775806::9223372036854775807, 2`, `[9223372036854775806]`},
+		{`range -9223372036854775806::-9223372036854775807, -3`, `[-9223372036854775806]`},
+		{`range 0.0::1.0, 0.25`, `[0.000000, 0.250000, 0.500000, 0.750000]`},
+		{`range 1::0, -0.5`, `[1.000000, 0.500000]`},
+		{`len range 0.0::1.0, 0.1`, `10`},
+		{`len range 0.0::0.3, 0.1`, `3`},
+		{`(range 0.0::1.0, 0.1)[9]`, `0.900000`},
+		{`range 0::10, 0`, `error "the step of a range can't be zero"`},
+	})
+}
+
+func TestMinByAndMaxBy(t *testing.T) {
+	service := makeTestService(t, `def
+
+Person = struct(name string, age int)
+
+People = [Person("Joe", 22), Person("Ann", 40), Person("Sue", 22), Person("Bob", 40)]
+`)
+	runEvalTests(t, service, []evalTest{
+		{`(min_by People, func(p) : p[age])[name]`, `"Joe"`},
+		{`(max_by People, func(p) : p[age])[name]`, `"Ann"`},
+		{`min_by [3, -5, 4], func(x) : x * x`, `3`},
+		{`max_by [0.5, 2, -3.0], func(x) : x`, `2`},
+		{`max_by [9007199254740992, 9007199254740993], func(x) : x`, `9007199254740993`},
+		{`min_by [], func(x) : x`, `error "can't find the least or greatest element of an empty list"`},
+		{`max_by ["a"], func(x) : x`, `error "the function given to 'min_by' or 'max_by' should return a number, not something of type 'string'"`},
+	})
+}
+
+func TestPartition(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`partition [1, 2, 3, 4, 5], func(x) : x % 2 == 1`, `[1, 3, 5]::[2, 4]`},
+		{`partition [1, 2, 3], func(x) : x > 0`, `[1, 2, 3]::[]`},
+		{`partition [1, 2, 3], func(x) : x > 5`, `[]::[1, 2, 3]`},
+		{`partition [], func(x) : true`, `[]::[]`},
+		{`partition [1], func(x) : x`, `error "the function given to 'partition' should return a boolean, not something of type 'int'"`},
+	})
+}
+
+func TestScan(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`scan [1, 2, 3, 4], 0, func(a, x) : a + x`, `[0, 1, 3, 6, 10]`},
+		{`scan [3, 1, 4, 1, 5], 0, func(a, x) : (x > a : x; else : a)`, `[0, 3, 3, 4, 4, 5]`},
+		{`scan [], "z", func(a, x) : a + x`, `["z"]`},
+		{`scan ["b", "c"], "a", func(a, x) : a + x`, `["a", "ab", "abc"]`},
+		{`scan [1, 0], 1, func(a, x) : a / x`, `error "division by zero"`},
+	})
+}
+
+func TestChunksAndWindows(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`chunks [1, 2, 3, 4, 5, 6], 2`, `[[1, 2], [3, 4], [5, 6]]`},
+		{`chunks [1, 2, 3, 4, 5], 2`, `[[1, 2], [3, 4], [5]]`},
+		{`chunks [1, 2], 5`, `[[1, 2]]`},
+		{`chunks [], 3`, `[]`},
+		{`windows [1, 2, 3, 4], 2`, `[[1, 2], [2, 3], [3, 4]]`},
+		{`windows [1, 2, 3, 4], 4`, `[[1, 2, 3, 4]]`},
+		{`windows [1, 2, 3], 4`, `[]`},
+		{`chunks [1, 2], 0`, `error "can't split a list into pieces of size '0'"`},
+		{`windows [1, 2], -1`, `error "can't split a list into pieces of size '-1'"`},
+	})
+}
+
+func TestShowTypes(t *testing.T) {
+	service := makeTestService(t, `def
+
+divmod(x, y int) -> int, int : x / y, x % y
+`)
+	if got := service.Annotate(`1 + 2`, `3`); got != `3` {
+		t.Errorf("expected no types to be shown by default, got %s", got)
+	}
+	runEvalTests(t, service, []evalTest{
+		{`$showTypes = true`, `ok`},
+		{`($showTypes = 1)[errorCode]`, `"sys/showtypes/bool"`},
+	})
+	for _, tt := range []struct {
+		input       string
+		description string
+		expected    string
+	}{
+		{`1 + 2`, `3`, `3 : int`},
+		{`"a" + "b"`, `"ab"`, `"ab" : string`},
+		{`1 < 2`, `true`, `true : bool`},
+		{`divmod(7, 2)`, `(3, 1)`, `(3, 1) : (int, int)`},
+	} {
+		if got := service.Annotate(tt.input, tt.description); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+	runEvalTests(t, service, []evalTest{
+		{`$showTypes = false`, `ok`},
+	})
+	if got := service.Annotate(`1 + 2`, `3`); got != `3` {
+		t.Errorf("expected no types to be shown once turned off, got %s", got)
+	}
+}
+
+func TestBuiltins(t *testing.T) {
+	service := makeTestService(t, `def
+
+double(x int) : 2 * x
+`)
+	found := map[string]parser.BuiltinInfo{}
+	for _, info := range service.Builtins() {
+		found[info.Builtin] = info
+		if info.Name == "double" {
+			t.Errorf("found a function implemented in Pipefish among the builtins")
+		}
+	}
+	for _, expected := range []parser.BuiltinInfo{
+		{Name: "+", Builtin: "add_integers", Signature: "(x int, + bling, y int)", Returns: "int"},
+		{Name: "chunks", Builtin: "chunks", Signature: "(L list, n int)", Returns: "list"},
+		{Name: "range", Builtin: "range", Signature: "(p pair)", Returns: "tuple"},
+		{Name: "new_channel", Builtin: "new_channel", Signature: "(capacity int)", Returns: "channel", Cmd: true},
+	} {
+		if got, ok := found[expected.Builtin]; !ok {
+			t.Errorf("couldn't find builtin %s", expected.Builtin)
+		} else if got != expected {
+			t.Errorf("%s: expected %v, got %v", expected.Builtin, expected, got)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	service := makeTestService(t, `def
+
+Point = struct(x, y int)
+
+Person = struct(name string, home Point, tags list)
+
+Joe = Person("Joe", Point(1, 2), ["a", "b"])
+`)
+	runEvalTests(t, service, []evalTest{
+		{`diff Joe, Joe`, `[]`},
+		{`diff 1, 1`, `[]`},
+		{`diff 1, 2`, `[[]::1::2]`},
+		{`diff 1, "1"`, `[[]::1::"1"]`},
+		{`diff Joe, Joe with name::"Ann"`, `[[name]::"Joe"::"Ann"]`},
+		{`diff Joe, Joe with [home, y]::3`, `[[home, y]::2::3]`},
+		{`diff Joe, Joe with tags::["a", "c", "d"]`, `[[tags, 1]::"b"::"c", [tags, 2]::NULL::"d"]`},
+		{`diff [1, [2, 3]], [1, [2, 4]]`, `[[1, 1]::3::4]`},
+		{`diff map("a"::1, "b"::2), map("b"::5, "c"::3)`, `[["a"]::1::NULL, ["b"]::2::5, ["c"]::NULL::3]`},
+	})
+}
+
+func TestIntegerBounds(t *testing.T) {
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`9223372036854775807`, `9223372036854775807`},
+		{`-9223372036854775807 - 1`, `-9223372036854775808`},
+		{`9223372036854775807 + 1`, `-9223372036854775808`},
+		{`-9223372036854775807 - 2`, `9223372036854775807`},
+		{`4294967296 * 4294967296`, `0`},
+		{`int "9223372036854775807"`, `9223372036854775807`},
+		{`int "-9223372036854775808"`, `-9223372036854775808`},
+		{`(int "9223372036854775808")[errorCode]`, `"built/int"`},
+		{`len([1, 2, 3]) + 9223372036854775804`, `9223372036854775807`},
+		{`[1, 2, 3][9223372036854775807]`, `error "index '9223372036854775807' is out of bounds for a list of length '3'"`},
+		{`[1, 2, 3][-9223372036854775807]`, `error "index '-9223372036854775807' is out of bounds for a list of length '3'"`},
+	})
+}
+
+func TestGetOrElse(t *testing.T) {
+	service := makeTestService(t, `def
+
+L = ["a", "b", "c"]
+`)
+	runEvalTests(t, service, []evalTest{
+		{`get_or_else L, 0, "z"`, `"a"`},
+		{`get_or_else L, 2, "z"`, `"c"`},
+		{`get_or_else L, 3, "z"`, `"z"`},
+		{`get_or_else L, -1, "z"`, `"c"`},
+		{`get_or_else L, -3, "z"`, `"a"`},
+		{`get_or_else L, -4, "z"`, `"z"`},
+		{`get_or_else [], 0, NULL`, `NULL`},
+		{`get_or_else L, 9223372036854775807, 0`, `0`},
+	})
+}
+
+func TestLogLevels(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "log.txt")
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`$logLevel`, `"info"`},
+		{`$logPath = ` + strconv.Quote(logPath), `ok`},
+		{`log "debug", "not shown"`, `ok`},
+		{`log "info", "starting"`, `ok`},
+		{`$logLevel = "warn"`, `ok`},
+		{`log "info", "not shown either"`, `ok`},
+		{`log "error", "stopping"`, `ok`},
+		{`(log "loud", "x")[errorCode]`, `"built/log/level"`},
+		{`($logLevel = "loud")[errorCode]`, `"sys/loglevel/vals"`},
+		{`($logLevel = 1)[errorCode]`, `"sys/loglevel/string"`},
+	})
+	contents, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(contents), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines to be logged, got %q", contents)
+	}
+	for i, expected := range []string{" [INFO] starting", " [ERROR] stopping"} {
+		stamp, message, _ := strings.Cut(lines[i], " ")
+		if _, err := time.Parse(time.RFC3339, stamp); err != nil {
+			t.Errorf("expected line %d to start with a timestamp, got %q", i, lines[i])
+		}
+		if " "+message != expected {
+			t.Errorf("expected line %d to end %q, got %q", i, expected, lines[i])
+		}
+	}
+}
+
+func TestLogToUnwritablePath(t *testing.T) {
+	logPath := t.TempDir() // A directory, which exists but can't be opened for writing.
+	service := makeTestService(t, "")
+	runEvalTests(t, service, []evalTest{
+		{`$logPath = ` + strconv.Quote(logPath), `ok`},
+		{`(log "error", "lost")[errorCode]`, `"eval/log/file"`},
+	})
+}
+
+func TestAutologComparisonChain(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "log.txt")
+	service := makeTestService(t, `def
+
+size(x int) :
+    0 <= x < 10 : \\
+        "small"
+    else :
+        "big"
+`)
+	runEvalTests(t, service, []evalTest{
+		{`$logPath = ` + strconv.Quote(logPath), `ok`},
+	})
+	for _, input := range []string{"size 5", "size 12"} {
+		evaluator.Evaluate(*service.Parser.ParseLine("test", input), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, true))
+	}
+	contents, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := strings.ReplaceAll(string(contents), text.RESET, "")
+	for _, expected := range []string{"x is 5 and x is 5, so the condition is met.", "x is 12, but x is 12, so the condition fails."} {
+		if !strings.Contains(log, expected) {
+			t.Errorf("expected the log to say %q, got %q", expected, log)
+		}
+	}
+}
+
+func TestStructOf(t *testing.T) {
+	service := makeTestService(t, `def
+
+Person = struct(name string, age int)
+
+Color = enum RED, GREEN
+`)
+	runEvalTests(t, service, []evalTest{
+		{`struct_of Person, map(name::"Joe", age::22)`, `Person with (name::"Joe", age::22)`},
+		{`struct_of Person, map("age"::22, "name"::"Joe")`, `Person with (name::"Joe", age::22)`},
+		{`struct_of(Person, map(name::"Joe", age::22, "height"::180)) == Person("Joe", 22)`, `true`},
+		{`struct_of Person, map(name::"Joe")`, `error "can't make a struct of type 'Person' from a map with no value for field 'age'"`},
+		{`struct_of Person, map(name::"Joe", age::"old")`, `error "field 'age' of struct type 'Person' should have type <int>, not 'string'"`},
+		{`(struct_of Person, map(name::"Joe", age::"old"))[errorCode]`, `"built/struct/field-type/c"`},
+		{`(struct_of Color, map(name::"Joe"))[errorCode]`, `"built/struct/of"`},
+		{`(struct_of int, map())[errorCode]`, `"built/struct/of"`},
+	})
+}
@@ -282,7 +282,7 @@ func (gh *GoHandler) CharmToGo(ch object.Object) any {
 	case *object.Hash:
 		return errors.New("passing maps to gocodefunctions is not yet supported")
 	case *object.Integer:
-		return ch.Value
+		return int(ch.Value) // Since that's what the Go code is written in terms of.
 	case *object.Label:
 		return ch.Value
 	case *object.List:
@@ -356,9 +356,9 @@ func (gh *GoHandler) goToCharm(goval any) object.Object {
 	case float64:
 		return &object.Float{Value: goval}
 	case int:
-		return &object.Integer{Value: goval}
+		return &object.Integer{Value: int64(goval)}
 	case int64:
-		return &object.Integer{Value: int(goval)}
+		return &object.Integer{Value: goval}
 	case string:
 		return &object.String{Value: goval}
 	default:
@@ -52,6 +52,7 @@ type Hub struct {
 	path, port             string
 	hot                    bool
 	directory              string
+	ColorOutput            bool // If this is false, we strip the color codes from anything we write.
 }
 
 // Most initialization is done in the Open method.
@@ -64,10 +65,20 @@ func New(in io.Reader, out io.Writer) *Hub {
 		out:                out,
 		lastRun:            []string{},
 		hot:                true,
-		directory:          cwd + "/"}
+		directory:          cwd + "/",
+		ColorOutput:        isTerminal(out)}
 	return &hub
 }
 
+func isTerminal(out io.Writer) bool {
+	file, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := file.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
 // This takes the input from the REPL, interprets it as a hub command if it begins with 'hub';
 // as an instruction to the os if it begins with 'os,
 // and as an expression to be passed to the current service if none of the above hold.
@@ -198,7 +209,11 @@ func (hub *Hub) Do(line, username, password, passedServiceName string) (string,
 		hub.WriteString("\n")
 		hub.ers = []*object.Error{obj.(*object.Error)}
 	} else {
-		hub.WriteString(objToString(service, obj))
+		if obj.Type() == object.RESPONSE_OBJ || obj.Type() == object.SUCCESSFUL_OBJ {
+			hub.WriteString(objToDescription(service, obj))
+		} else {
+			hub.WriteString(service.Annotate(line, objToDescription(service, obj)))
+		}
 		for k, v := range service.Env.Pending {
 			service.Env.HardSet(k, v)
 		}
@@ -772,6 +787,9 @@ func (hub *Hub) WriteError(s string) {
 }
 
 func (hub *Hub) WriteString(s string) {
+	if !hub.ColorOutput {
+		s = text.StripColor(s)
+	}
 	io.WriteString(hub.out, s)
 }
 
@@ -849,7 +867,7 @@ func (hub *Hub) tryMain() { // Guardedly tries to run the `main` command.
 				hub.WriteString("\n")
 				hub.ers = []*object.Error{obj.(*object.Error)}
 			} else {
-				hub.WriteString(objToString(hub.services[hub.currentServiceName], obj))
+				hub.WriteString(objToDescription(hub.services[hub.currentServiceName], obj))
 			}
 		}
 	}
@@ -886,6 +904,9 @@ func (hub *Hub) createService(name, scriptFilepath string) bool {
 		hub.GetAndReportErrors(init.Parser)
 		return false
 	}
+	if len(init.Parser.Warnings) > 0 {
+		hub.WritePretty(object.GetWarningList(init.Parser.Warnings))
+	}
 	recursivelySetRootService(newService, newService, "")
 
 	return true
@@ -1185,13 +1206,24 @@ func (hub *Hub) playTest(testFilepath string, diffOn bool) {
 }
 
 func objToString(service *parser.Service, obj object.Object) string {
+	return describe(service, obj, 0)
+}
+
+// Like objToString, except that long collections are cut short as specified by the service variable $maxElements,
+// for showing values in the REPL.
+func objToDescription(service *parser.Service, obj object.Object) string {
+	maxElements, _ := service.Parser.AllGlobals.Get("$maxElements")
+	return describe(service, obj, int(maxElements.(*object.Integer).Value))
+}
+
+func describe(service *parser.Service, obj object.Object, maxElements int) string {
 
 	value, _ := service.Parser.AllGlobals.Get("$view")
 	switch value.(*object.String).Value {
 	case "":
-		return service.Parser.Serialize(obj, parser.LITERAL)
+		return service.Parser.Describe(obj, parser.LITERAL, maxElements)
 	case "plain":
-		return service.Parser.Serialize(obj, parser.PLAIN)
+		return service.Parser.Describe(obj, parser.PLAIN, maxElements)
 	default:
 		panic("I don't know what's going on any more.")
 	}
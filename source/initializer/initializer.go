@@ -21,7 +21,9 @@ package initializer
 import (
 	"bufio"
 	"database/sql"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 
 	"pipefish/source/ast"
@@ -30,6 +32,7 @@ import (
 	"pipefish/source/object"
 	"pipefish/source/parser"
 	"pipefish/source/relexer"
+	"pipefish/source/set"
 
 	"pipefish/source/signature"
 	"pipefish/source/sysvars"
@@ -77,16 +80,21 @@ var tokenTypeToSection = map[token.TokenType]Section{
 }
 
 type Initializer struct {
-	rl      relexer.Relexer
-	Parser  *parser.Parser
-	Sources map[string][]string
+	rl          relexer.Relexer
+	Parser      *parser.Parser
+	Sources     map[string][]string
+	fixities    []token.Token // The operators whose precedence the user has declared, so we can check they're infixes.
+	deprecation *token.Token  // The message of an '@deprecated' annotation waiting for the declaration it applies to.
+	// The messages of the '@deprecated' annotations, by the declarations they apply to.
+	deprecations map[*tokenized_code_chunk.TokenizedCodeChunk]string
 }
 
 func New(source, input string, db *sql.DB, dir string) *Initializer {
 	uP := &Initializer{
-		rl:      *relexer.New(source, input),
-		Parser:  parser.New(dir),
-		Sources: make(map[string][]string),
+		rl:           *relexer.New(source, input),
+		Parser:       parser.New(dir),
+		Sources:      make(map[string][]string),
+		deprecations: make(map[*tokenized_code_chunk.TokenizedCodeChunk]string),
 	}
 	uP.GetSource(source)
 	uP.Parser.Database = db
@@ -120,6 +128,11 @@ func CreateService(scriptFilepath string, db *sql.DB, services map[string]*parse
 
 	init := New(scriptFilepath, code, db, dir)
 	newService.Parser = init.Parser
+	if root.Parser != nil {
+		for flag, value := range root.Parser.Flags {
+			init.Parser.Flags[flag] = value
+		}
+	}
 	init.GetSource(scriptFilepath)
 	init.Parser.Database = db
 	init.Parser.Services = services
@@ -217,11 +230,15 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 	expressionIsStruct := false
 	expressionIsFunction := false
 	expressionIsEnum := false
+	expressionIsFixity := false
+	expressionIsUnion := false
 	isPrivate := false
 	var (
 		tok           token.Token
 		definingToken token.Token
 	)
+	docLine := 0      // The line the current declaration starts on, so we can find any doc-comment above it.
+	headwordLine := 0 // The line of the last headword, since a doc-comment may follow straight on from it.
 
 	tok = uP.rl.NextToken()    // note that we've already removed leading newlines.
 	if tok.Type == token.EOF { // An empty file should still initiate a service, but one with no data.
@@ -233,9 +250,24 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 	}
 
 	currentSection = tokenTypeToSection[tok.Type]
+	headwordLine = tok.Line
 
 	line := tokenized_code_chunk.New()
 
+	// The body of a function or command on the same line as its signature, or a 'given' block on the same line
+	// as the 'given', may consist of several expressions separated by semicolons, in which case we bracket it as
+	// though it were an indented block.
+	inlineBodyStart := -1
+	inlineBodyHasSemicolon := false
+	closeInlineBody := func(tok token.Token) {
+		if inlineBodyStart >= 0 && inlineBodyHasSemicolon {
+			line.Insert(inlineBodyStart, token.Token{Type: token.LPAREN, Literal: "|->", Line: tok.Line, Source: tok.Source})
+			line.Append(token.Token{Type: token.RPAREN, Literal: "<-|", Line: tok.Line, Source: tok.Source})
+		}
+		inlineBodyStart = -1
+		inlineBodyHasSemicolon = false
+	}
+
 	for tok = uP.rl.NextToken(); tok.Type != token.EOF; tok = uP.rl.NextToken() {
 
 		// if tok.Source != "rsc/pipefish/world.pf" && tok.Source != "rsc/pipefish/builtins.pf" && tok.Source != "rsc/pipefish/hub.pf" {
@@ -247,12 +279,21 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 				uP.Throw("init/import/first", tok)
 			}
 			currentSection = tokenTypeToSection[tok.Type]
+			headwordLine = tok.Line
 			isPrivate = false
 			lastTokenWasColon = false
 			colonMeansFunctionOrCommand = true
 			continue
 		}
 
+		if tok.Type == token.IDENT && tok.Literal == "@" && line.Length() == 0 {
+			if docLine == 0 {
+				docLine = tok.Line
+			}
+			uP.readAnnotation(tok)
+			continue
+		}
+
 		if tok.Type == token.PRIVATE {
 			if isPrivate {
 				uP.Throw("init/private", tok)
@@ -267,13 +308,26 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 			definingToken = tok
 		}
 
-		if tok.Type == token.IDENT && tok.Literal == "enum" && expressionIsAssignment {
+		if tok.Type == token.IDENT && (tok.Literal == "infix" || tok.Literal == "infixl" || tok.Literal == "infixr") &&
+			line.Length() == 0 && currentSection == DefSection {
+			expressionIsFixity = true
+		}
+
+		if tok.Type == token.IDENT && tok.Literal == "newtype" && line.Length() == 0 && currentSection == DefSection {
+			expressionIsUnion = true
+		}
+
+		if tok.Type == token.IDENT && (tok.Literal == "enum" || tok.Literal == "flags" && line.Length() == 2) && expressionIsAssignment {
 			expressionIsAssignment = false
 			expressionIsEnum = true
 			definingToken = tok
 		}
 
-		if tok.Literal == "=" && !(tok.Type == token.GVN_ASSIGN || tok.Type == token.STRING) {
+		if tok.Type == token.ASSIGN && tok.Literal != "=" && currentSection != CmdSection {
+			uP.Throw("init/assign/compound", tok) // Since there's nothing to add to, multiply by, etc.
+		}
+
+		if (tok.Literal == "=" || tok.Type == token.ASSIGN) && !(tok.Type == token.GVN_ASSIGN || tok.Type == token.STRING) {
 			if currentSection != CmdSection {
 				colonMeansFunctionOrCommand = false
 				expressionIsAssignment = true
@@ -312,14 +366,25 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 			}
 		}
 
+		if tok.Type == token.SEMICOLON && beginCount == 0 && inlineBodyStart >= 0 {
+			inlineBodyHasSemicolon = true
+		}
+
+		if tok.Type == token.GIVEN && beginCount == 0 {
+			closeInlineBody(tok)
+			inlineBodyStart = line.Length() + 1 // Since the 'given' block may also be inline.
+		}
+
 		if (tok.Type == token.NEWLINE) &&
 			!lastTokenWasColon && indentCount == 0 && line.Length() != 0 {
+			closeInlineBody(tok)
 			if beginCount != 0 {
 				uP.Throw("init/close", tok)
 				beginCount = 0 // Prevents error storm.
 				expressionIsAssignment = false
 				expressionIsStruct = false
 				expressionIsEnum = false
+				expressionIsFixity = false
 				expressionIsFunction = false
 				colonMeansFunctionOrCommand = true
 
@@ -400,6 +465,9 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 						append(uP.Parser.TokenizedDeclarations[golangDeclaration], line)
 				} else {
 					switch {
+					case expressionIsUnion && expressionIsAssignment: // Otherwise it's a function called 'newtype'.
+						uP.Parser.TokenizedDeclarations[typeDeclaration] =
+							append(uP.Parser.TokenizedDeclarations[typeDeclaration], line)
 					case expressionIsAssignment:
 						uP.Parser.TokenizedDeclarations[constantDeclaration] =
 							append(uP.Parser.TokenizedDeclarations[constantDeclaration], line)
@@ -409,6 +477,8 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 					case expressionIsEnum:
 						uP.Parser.TokenizedDeclarations[enumDeclaration] =
 							append(uP.Parser.TokenizedDeclarations[enumDeclaration], line)
+					case expressionIsFixity && !expressionIsFunction: // Otherwise it's a function called e.g. 'infix'.
+						uP.addFixity(line)
 					default:
 						if isPrivate {
 							uP.Parser.TokenizedDeclarations[privateFunctionDeclaration] =
@@ -420,10 +490,15 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 					}
 				}
 			}
+			uP.addDoc(line, docLine, headwordLine)
+			docLine = 0
+			uP.addDeprecation(line)
 			line = tokenized_code_chunk.New()
 			expressionIsAssignment = false
 			expressionIsStruct = false
 			expressionIsEnum = false
+			expressionIsFixity = false
+			expressionIsUnion = false
 			expressionIsFunction = false
 			colonMeansFunctionOrCommand = true
 			continue
@@ -438,11 +513,17 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 		if (lastTokenWasColon || tok.Type == token.PIPE) && colonMeansFunctionOrCommand {
 			colonMeansFunctionOrCommand = false
 			uP.addWordsToParser(line)
+			if lastTokenWasColon && (currentSection == DefSection || currentSection == CmdSection) {
+				inlineBodyStart = line.Length() + 1
+			}
 			if currentSection == DefSection {
 				expressionIsFunction = true
 				definingToken = tok
 			}
 		}
+		if docLine == 0 {
+			docLine = tok.Line
+		}
 		line.Append(tok)
 	}
 	if lastTokenWasColon {
@@ -451,6 +532,122 @@ func (uP *Initializer) MakeParserAndTokenizedProgram() {
 	uP.Parser.Errors = object.MergeErrors(uP.rl.GetErrors(), uP.Parser.Errors)
 }
 
+// A run of comments at column 0 immediately above a declaration is its doc-comment, which we keep under the name of
+// the thing declared: that is, the first identifier outside of any parentheses. If a function is overloaded, the first
+// of its doc-comments is the one we keep. The run must follow a blank line, a headword, or the start of the file,
+// since otherwise it's more likely to be a note on the end of whatever came before.
+func (uP *Initializer) addDoc(line *tokenized_code_chunk.TokenizedCodeChunk, docLine, headwordLine int) {
+	comments := uP.rl.Comments()
+	doc := []string{}
+	i := docLine - 1
+	for ; ; i-- {
+		comment, ok := comments[i]
+		if !ok {
+			break
+		}
+		doc = append([]string{strings.TrimSpace(comment)}, doc...)
+	}
+	if len(doc) == 0 {
+		return
+	}
+	if i > 0 && i != headwordLine && !uP.rl.BlankLines()[i] {
+		return
+	}
+	depth := 0
+	line.ToStart()
+	for tok := line.NextToken(); tok.Type != token.EOF; tok = line.NextToken() {
+		switch tok.Type {
+		case token.LPAREN:
+			depth++
+		case token.RPAREN:
+			depth--
+		case token.IDENT:
+			if depth == 0 {
+				if _, ok := uP.Parser.Docs[tok.Literal]; !ok {
+					uP.Parser.Docs[tok.Literal] = strings.Join(doc, "\n")
+				}
+				return
+			}
+		}
+	}
+}
+
+// An annotation is a line of the form '@deprecated "<message>"', and applies to the function or command declared on
+// the line after.
+func (uP *Initializer) readAnnotation(at token.Token) {
+	annotation := []token.Token{}
+	for tok := uP.rl.NextToken(); tok.Type != token.NEWLINE && tok.Type != token.EOF; tok = uP.rl.NextToken() {
+		annotation = append(annotation, tok)
+	}
+	if len(annotation) != 2 || annotation[0].Literal != "deprecated" || annotation[1].Type != token.STRING {
+		uP.Throw("init/deprecated/form", at)
+		return
+	}
+	uP.deprecation = &annotation[1]
+}
+
+func (uP *Initializer) addDeprecation(line *tokenized_code_chunk.TokenizedCodeChunk) {
+	if uP.deprecation == nil {
+		return
+	}
+	for j := functionDeclaration; j <= privateCommandDeclaration; j++ {
+		declarations := uP.Parser.TokenizedDeclarations[j]
+		if len(declarations) > 0 && declarations[len(declarations)-1] == line {
+			uP.deprecations[line] = uP.deprecation.Literal
+			uP.deprecation = nil
+			return
+		}
+	}
+	uP.Throw("init/deprecated/target", *uP.deprecation)
+	uP.deprecation = nil
+}
+
+// The operators whose precedence is fixed by the parser and which the user can't redeclare.
+var infixesWithBuiltinPrecedence = set.MakeFromSlice([]string{"+", "-", "*", "/", "%", "**", "<", "<=", ">", ">=", "in", "with", "without"})
+
+// A declaration of the precedence of an infix looks like 'infix 6 <op>'. 'infixl' means the same thing, and 'infixr'
+// makes the infix right-associative. We can't check yet that the operator is an infix, since the function defining
+// it may come later, so we leave that to checkFixities.
+func (uP *Initializer) addFixity(line *tokenized_code_chunk.TokenizedCodeChunk) {
+	line.ToStart()
+	keyword := line.NextToken()
+	levelTok := line.NextToken()
+	opTok := line.NextToken()
+	if levelTok.Type != token.INT || opTok.Type != token.IDENT || line.NextToken().Type != token.EOF {
+		uP.Throw("init/infix/form", keyword)
+		return
+	}
+	level, _ := strconv.Atoi(levelTok.Literal)
+	precedence, ok := parser.UserPrecedences[level]
+	if !ok {
+		uP.Throw("init/infix/level", levelTok)
+		return
+	}
+	if infixesWithBuiltinPrecedence.Contains(opTok.Literal) {
+		uP.Throw("init/infix/builtin", opTok)
+		return
+	}
+	isRight := keyword.Literal == "infixr"
+	if oldPrecedence, ok := uP.Parser.InfixPrecedences[opTok.Literal]; ok &&
+		(oldPrecedence != precedence || uP.Parser.RightAssociative.Contains(opTok.Literal) != isRight) {
+		uP.Throw("init/infix/conflict", opTok)
+		return
+	}
+	uP.Parser.InfixPrecedences[opTok.Literal] = precedence
+	if isRight {
+		uP.Parser.RightAssociative.Add(opTok.Literal)
+	}
+	uP.fixities = append(uP.fixities, opTok)
+}
+
+func (uP *Initializer) checkFixities() {
+	for _, tok := range uP.fixities {
+		if !uP.Parser.Infixes.Contains(tok.Literal) {
+			uP.Throw("init/infix/infix", tok)
+		}
+	}
+}
+
 func (uP *Initializer) ParseImports() {
 	uP.Parser.ParsedDeclarations[importDeclaration] = parser.ParsedCodeChunks{}
 	for chunk := 0; chunk < len(uP.Parser.TokenizedDeclarations[importDeclaration]); chunk++ {
@@ -469,11 +666,17 @@ func (uP *Initializer) ParseEnumDefs(env *object.Environment) {
 		if !(tok1.Type == token.IDENT && tok2.Type == token.DEF_ASSIGN) {
 			uP.Throw("init/enum/lhs", tok1)
 		}
-		uP.Parser.TypeSystem.AddTransitiveArrow(tok1.Literal+"?", "enum")
+		// This says "enum" or "flags" or we wouldn't be here. The elements of a flags type are enum elements which
+		// can be combined, so we give each of them a bit of its own.
+		isFlags := uP.Parser.TokenizedDeclarations[enumDeclaration][chunk].NextToken().Literal == "flags"
+		if isFlags {
+			uP.Parser.TypeSystem.AddTransitiveArrow(tok1.Literal+"?", "flags")
+		} else {
+			uP.Parser.TypeSystem.AddTransitiveArrow(tok1.Literal+"?", "enum")
+		}
 		uP.Parser.TypeSystem.AddTransitiveArrow("null", tok1.Literal+"?")
 		uP.Parser.TypeSystem.AddTransitiveArrow(tok1.Literal, tok1.Literal+"?")
 		uP.Parser.Enums[tok1.Literal] = []*object.Label{}
-		uP.Parser.TokenizedDeclarations[enumDeclaration][chunk].NextToken() // This says "enum" or we wouldn't be here.
 		for tok := uP.Parser.TokenizedDeclarations[enumDeclaration][chunk].NextToken(); tok.Type != token.EOF; {
 			if tok.Type != token.IDENT {
 				uP.Throw("init/enum/ident", tok)
@@ -482,6 +685,12 @@ func (uP *Initializer) ParseEnumDefs(env *object.Environment) {
 				uP.Throw("init/enum/free", tok)
 			}
 			labelConst := &object.Label{Value: tok.Literal, Name: tok1.Literal, Namespace: uP.Parser.NamespacePath}
+			if isFlags {
+				if len(uP.Parser.Enums[tok1.Literal]) == object.MAX_FLAGS {
+					uP.Throw("init/enum/flags", tok, tok1.Literal)
+				}
+				labelConst.Bits = 1 << len(uP.Parser.Enums[tok1.Literal])
+			}
 			env.InitializeConstant(tok.Literal, labelConst)
 
 			uP.Parser.Enums[tok1.Literal] = append(uP.Parser.Enums[tok1.Literal], labelConst)
@@ -498,6 +707,19 @@ func (uP *Initializer) ParseEnumDefs(env *object.Environment) {
 }
 
 func (uP *Initializer) ParseTypeDefs() {
+	// The abstract types declared with 'newtype' need nothing from the parser or evaluator, so we take them out of
+	// the type declarations and add them to the type system after the structs, which they may have as members.
+	unions := []*tokenized_code_chunk.TokenizedCodeChunk{}
+	structs := []*tokenized_code_chunk.TokenizedCodeChunk{}
+	for _, chunk := range uP.Parser.TokenizedDeclarations[typeDeclaration] {
+		chunk.ToStart()
+		if chunk.NextToken().Literal == "newtype" {
+			unions = append(unions, chunk)
+		} else {
+			structs = append(structs, chunk)
+		}
+	}
+	uP.Parser.TokenizedDeclarations[typeDeclaration] = structs
 	// First we need to make the struct types into types so the parser parses them properly.
 	for chunk := 0; chunk < len(uP.Parser.TokenizedDeclarations[typeDeclaration]); chunk++ {
 		uP.Parser.TokenizedDeclarations[typeDeclaration][chunk].ToStart()
@@ -517,6 +739,9 @@ func (uP *Initializer) ParseTypeDefs() {
 			uP.Parser.Structs.Add(tok1.Literal)
 		}
 	}
+	for _, chunk := range unions {
+		uP.addUnionType(chunk)
+	}
 
 	// Now we can parse them.
 
@@ -527,11 +752,52 @@ func (uP *Initializer) ParseTypeDefs() {
 	}
 }
 
+// A declaration such as 'newtype Number = int/float64' adds an abstract type to the type system with the given types
+// as its members.
+func (uP *Initializer) addUnionType(chunk *tokenized_code_chunk.TokenizedCodeChunk) {
+	chunk.ToStart()
+	keyword := chunk.NextToken()
+	nameTok := chunk.NextToken()
+	if nameTok.Type != token.IDENT || chunk.NextToken().Type != token.DEF_ASSIGN {
+		uP.Throw("init/newtype/form", keyword)
+		return
+	}
+	if parser.TypeExists(nameTok.Literal, uP.Parser.TypeSystem) {
+		uP.Throw("init/newtype/exists", nameTok)
+		return
+	}
+	members := []string{}
+	for tok := chunk.NextToken(); ; tok = chunk.NextToken() {
+		if tok.Type != token.IDENT {
+			uP.Throw("init/newtype/form", keyword)
+			return
+		}
+		if !parser.TypeExists(tok.Literal, uP.Parser.TypeSystem) {
+			uP.Throw("init/newtype/type", tok)
+			return
+		}
+		members = append(members, tok.Literal)
+		if tok = chunk.NextToken(); tok.Type == token.EOF {
+			break
+		}
+		if tok.Literal != "/" {
+			uP.Throw("init/newtype/form", keyword)
+			return
+		}
+	}
+	name := nameTok.Literal
+	uP.Parser.AddUnionType(name, members)
+	uP.Parser.TypeSystem.AddTransitiveArrow(name, name+"?")
+	uP.Parser.TypeSystem.AddTransitiveArrow("null", name+"?")
+	uP.Parser.Suffixes.Add(name)
+	uP.Parser.Suffixes.Add(name + "?")
+}
+
 func (uP *Initializer) EvaluateTypeDefs(env *object.Environment) {
 	for _, v := range uP.Parser.ParsedDeclarations[typeDeclaration] {
 		result := evaluator.Evaluate(*v, evaluator.NewContext(uP.Parser, env, evaluator.DEF, false))
 		if result.Type() == object.ERROR_OBJ {
-			uP.Throw(result.(*object.Error).ErrorId, result.(*object.Error).Token)
+			uP.Throw(result.(*object.Error).ErrorId, result.(*object.Error).Token, result.(*object.Error).Args...)
 		}
 	}
 }
@@ -621,6 +887,7 @@ func (uP *Initializer) MakeLanguagesAndContacts() {
 
 func (uP *Initializer) ParseEverything() {
 	uP.Parser.Unfixes.Add("break")
+	uP.Parser.Unfixes.Add("continue")
 	uP.Parser.Unfixes.Add("stop")
 	for declarations := languageDeclaration; declarations <= privateCommandDeclaration; declarations++ {
 		for chunk := 0; chunk < len(uP.Parser.TokenizedDeclarations[declarations]); chunk++ {
@@ -652,23 +919,45 @@ func (uP *Initializer) InitializeEverything(env *object.Environment, sourceName
 	}
 	uP.makeFunctions(sourceName)
 	uP.makeFunctionTrees()
+	uP.checkOverloads()
+	uP.checkFixities()
+	uP.checkPurity()
+	uP.checkLoops()
+	uP.checkMatches()
+	uP.checkDeprecations(env, sourceName)
+	if uP.ErrorsExist() {
+		return
+	}
 	env.InitializeConstant("NULL", object.NULL)
 	env.InitializeConstant("ok", object.SUCCESS)
 	env.InitializeConstant("errorMessage", &object.Label{Value: "errorMessage"})
 	env.InitializeConstant("errorCode", &object.Label{Value: "errorCode"})
+	env.InitializeConstant("PI", &object.Float{Value: math.Pi})
+	env.InitializeConstant("E", &object.Float{Value: math.E})
+	env.InitializeConstant("INF", &object.Float{Value: math.Inf(1)})
+	env.InitializeConstant("NEG_INF", &object.Float{Value: math.Inf(-1)})
+	env.InitializeConstant("NAN", &object.Float{Value: math.NaN()})
 	// Initialize the user-declared constants and variables
 	for declarations := constantDeclaration; declarations <= variableDeclaration; declarations++ {
 		assignmentOrder := uP.returnOrderOfAssignments(declarations)
-		for k := range *assignmentOrder {
+		if uP.ErrorsExist() {
+			return
+		}
+		for _, k := range *assignmentOrder {
+			uP.Parser.InitOrder = append(uP.Parser.InitOrder, uP.assignedNames(declarations, k)...)
 			result := evaluator.Evaluate(*uP.Parser.ParsedDeclarations[declarations][k], evaluator.NewContext(uP.Parser, env, evaluator.INIT, false))
 			if result.Type() == object.ERROR_OBJ {
 				uP.Parser.Errors = object.AddErr(result.(*object.Error), uP.Parser.Errors, result.(*object.Error).Token)
 			}
 		}
 		if declarations == constantDeclaration {
-			// We copy the constants to the global constants map.
+			// We copy the constants to the global constants map. The copies are deep, so that no part of a constant
+			// is shared with anything made while evaluating it which could change it, and the REPL sees the same
+			// copies as the functions do.
 			for k, v := range env.Store {
-				uP.Parser.GlobalConstants.Store[k] = v
+				frozen := v.DeepCopy()
+				env.Store[k] = frozen
+				uP.Parser.GlobalConstants.Store[k] = frozen
 			}
 		}
 
@@ -775,15 +1064,51 @@ func (uP *Initializer) returnOrderOfAssignments(declarations declarationType) *[
 	}
 	// And then we use the topological sort method of the digraph and return the result of the sort:
 	result, _ := digraph.Ordering(D)
+	// The sort strips the leaf nodes out of D as it goes, so anything left over is either in a cycle or depends on
+	// something that is. Since D is transitively closed, the ones in a cycle are the ones that point to themselves.
+	for i := range uP.Parser.TokenizedDeclarations[declarations] {
+		if D[i].Contains(i) {
+			if declarations == constantDeclaration {
+				uP.Throw("init/const/self-reference", (*uP.Parser.ParsedDeclarations[declarations][i]).GetToken(), strings.Join(uP.assignedNames(declarations, i), ", "))
+			} else {
+				uP.Throw("init/var/self-reference", (*uP.Parser.ParsedDeclarations[declarations][i]).GetToken(), strings.Join(uP.assignedNames(declarations, i), ", "))
+			}
+		}
+	}
 	return result
 }
 
+// Returns the names on the left hand side of an assignment in the 'def' or 'var' section.
+func (uP *Initializer) assignedNames(declarations declarationType, i int) []string {
+	assignment, ok := (*uP.Parser.ParsedDeclarations[declarations][i]).(*ast.AssignmentExpression)
+	if !ok {
+		return []string{(*uP.Parser.ParsedDeclarations[declarations][i]).String()}
+	}
+	sig, err := uP.Parser.RecursivelySlurpSignature(assignment.Left, "*")
+	if err != nil {
+		return []string{assignment.Left.String()}
+	}
+	names := []string{}
+	for _, v := range sig {
+		names = append(names, v.VarName)
+	}
+	return names
+}
+
 // At this point we have our functions as parsed code chunks in the uP.Parser.ParsedDeclarations(functionDeclaration)
 // slice. We want to read their signatures and order them according to specificity for the purposes of
 // implementing overloading.
 func (uP *Initializer) makeFunctions(sourceName string) {
 	// Some of our functions may be written in Go, so we have a GoHandler standing by just in case.
 	goHandler := evaluator.NewGoHandler(uP.Parser)
+	globals := make(set.Set[string])
+	for declarations := constantDeclaration; declarations <= variableDeclaration; declarations++ {
+		for i := range uP.Parser.ParsedDeclarations[declarations] {
+			for _, name := range uP.assignedNames(declarations, i) {
+				globals.Add(name)
+			}
+		}
+	}
 	for j := functionDeclaration; j <= privateCommandDeclaration; j++ {
 		for i := 0; i < len(uP.Parser.ParsedDeclarations[j]); i++ {
 			functionName, sig, rTypes, body, given := uP.Parser.ExtractPartsOfFunction(*uP.Parser.ParsedDeclarations[j][i])
@@ -793,12 +1118,17 @@ func (uP *Initializer) makeFunctions(sourceName string) {
 			if uP.Parser.ErrorsExist() {
 				return
 			}
+			uP.checkParameterNames(functionName, sig, globals, (*uP.Parser.ParsedDeclarations[j][i]).GetToken(), sourceName)
+			if uP.Parser.ErrorsExist() {
+				return
+			}
 			ok := uP.Parser.FunctionTable.Add(uP.Parser.TypeSystem, functionName,
 				ast.Function{Sig: sig, Rets: rTypes, Body: body, Given: given,
-					Cmd:     j == commandDeclaration || j == privateCommandDeclaration,
-					Private: j == privateCommandDeclaration || j == privateFunctionDeclaration})
+					Cmd:        j == commandDeclaration || j == privateCommandDeclaration,
+					Private:    j == privateCommandDeclaration || j == privateFunctionDeclaration,
+					Deprecated: uP.deprecations[uP.Parser.TokenizedDeclarations[j][i]]})
 			if !ok {
-				uP.Throw("init/overload", token.Token{}, functionName)
+				uP.Throw("init/overload", (*uP.Parser.ParsedDeclarations[j][i]).GetToken(), functionName)
 			}
 			if body.GetToken().Type == token.GOLANG {
 				body.(*ast.GolangExpression).Raw = []bool{}
@@ -845,6 +1175,267 @@ func (uP *Initializer) makeFunctions(sourceName string) {
 	goHandler.CleanUp()
 }
 
+// Two parameters of the same function with the same name is an error, except for '_', which ignores the argument
+// passed to it. A parameter with the same name as a global constant or variable hides it from the body of the
+// function, which is legal but suspicious, so we warn about it if the function was declared in the script we're
+// initializing.
+func (uP *Initializer) checkParameterNames(functionName string, sig signature.Signature, globals set.Set[string], tok token.Token, sourceName string) {
+	params := make(set.Set[string])
+	for _, param := range sig {
+		if param.VarType == "bling" || param.VarName == "_" {
+			continue
+		}
+		if params.Contains(param.VarName) {
+			uP.Throw("init/sig/dup-param", tok, param.VarName, functionName)
+			return
+		}
+		params.Add(param.VarName)
+		if globals.Contains(param.VarName) && tok.Source == sourceName {
+			uP.Warn("init/sig/shadow", tok, param.VarName, functionName)
+		}
+	}
+}
+
+// Functions are meant to be pure, so we complain if the body or 'given' block of a function calls something which
+// can only be a command. (The evaluator would stop it at runtime anyway, but only if that branch was ever taken.)
+// Commands can return values, but a constant mustn't get its value from one, so we check those too.
+func (uP *Initializer) checkPurity() {
+	for functionName, fns := range uP.Parser.FunctionTable {
+		for _, fn := range fns {
+			if fn.Cmd {
+				continue
+			}
+			for _, node := range []ast.Node{fn.Body, fn.Given} {
+				if node == nil {
+					continue
+				}
+				if tok, commandName, ok := uP.findCommandCall(node); ok {
+					uP.Throw("check/purity", tok, functionName, commandName)
+				}
+			}
+		}
+	}
+	for i, node := range uP.Parser.ParsedDeclarations[constantDeclaration] {
+		if tok, commandName, ok := uP.findCommandCall(*node); ok {
+			uP.Throw("check/purity/const", tok, strings.Join(uP.assignedNames(constantDeclaration, i), ", "), commandName)
+		}
+	}
+}
+
+func (uP *Initializer) findCommandCall(node ast.Node) (token.Token, string, bool) {
+	operator := ""
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		operator = node.Operator
+	case *ast.InfixExpression:
+		operator = node.Operator
+	case *ast.SuffixExpression:
+		operator = node.Operator
+	case *ast.UnfixExpression:
+		operator = node.Operator
+	case *ast.ComparisonChain:
+		for _, operator := range node.Operators {
+			if uP.isOnlyCommand(operator.Literal) {
+				return operator, operator.Literal, true
+			}
+		}
+	}
+	if uP.isOnlyCommand(operator) {
+		return node.GetToken(), operator, true
+	}
+	for _, child := range ast.Children(node) {
+		if tok, commandName, ok := uP.findCommandCall(child); ok {
+			return tok, commandName, ok
+		}
+	}
+	return token.Token{}, "", false
+}
+
+// We warn about calls to a deprecated function in the script we're initializing, if every overload of the function
+// which might accept the arguments is deprecated. If we can't tell which overloads might accept them, then that
+// means all of them.
+func (uP *Initializer) checkDeprecations(env *object.Environment, sourceName string) {
+	for _, fns := range uP.Parser.FunctionTable {
+		for _, fn := range fns {
+			for _, node := range []ast.Node{fn.Body, fn.Given} {
+				if node != nil {
+					uP.checkDeprecatedCalls(node, env, sourceName)
+				}
+			}
+		}
+	}
+	for declarations := constantDeclaration; declarations <= variableDeclaration; declarations++ {
+		for _, node := range uP.Parser.ParsedDeclarations[declarations] {
+			uP.checkDeprecatedCalls(*node, env, sourceName)
+		}
+	}
+}
+
+func (uP *Initializer) checkDeprecatedCalls(node ast.Node, env *object.Environment, sourceName string) {
+	operator := ""
+	args := []ast.Node{}
+	switch node := node.(type) {
+	case *ast.PrefixExpression:
+		operator, args = node.Operator, node.Args
+	case *ast.InfixExpression:
+		operator, args = node.Operator, node.Args
+	case *ast.SuffixExpression:
+		operator, args = node.Operator, node.Args
+	case *ast.UnfixExpression:
+		operator = node.Operator
+	case *ast.ComparisonChain:
+		for i := range node.Operators {
+			link := node.Link(i)
+			uP.checkDeprecatedCall(link.Operator, link.Args, link.Token, env, sourceName)
+		}
+	}
+	if operator != "" {
+		uP.checkDeprecatedCall(operator, args, node.GetToken(), env, sourceName)
+	}
+	for _, child := range ast.Children(node) {
+		uP.checkDeprecatedCalls(child, env, sourceName)
+	}
+}
+
+func (uP *Initializer) checkDeprecatedCall(operator string, args []ast.Node, tok token.Token, env *object.Environment, sourceName string) {
+	if tok.Source != sourceName {
+		return
+	}
+	overloads := uP.Parser.PossibleOverloads(operator, args, env)
+	deprecated := len(overloads) > 0
+	for _, fn := range overloads {
+		deprecated = deprecated && fn.Deprecated != ""
+	}
+	if deprecated {
+		uP.Warn("check/deprecated", tok, operator, overloads[0].Deprecated)
+	}
+}
+
+// 'break' and 'continue' only make sense inside a 'loop', and if they're given a label, inside a loop with that
+// label, so we complain about any that aren't. A lambda can't break out of a loop it's defined in, so it counts as
+// being outside.
+func (uP *Initializer) checkLoops() {
+	for _, fns := range uP.Parser.FunctionTable {
+		for _, fn := range fns {
+			if fn.Body != nil {
+				uP.checkLoopControl(fn.Body, []string{})
+			}
+			if fn.Given != nil {
+				uP.checkLoopControl(fn.Given, []string{})
+			}
+		}
+	}
+}
+
+// The labels are those of the loops we're inside, with "" for an unlabeled loop.
+func (uP *Initializer) checkLoopControl(node ast.Node, labels []string) {
+	switch node := node.(type) {
+	case *ast.UnfixExpression:
+		if node.Operator == "break" || node.Operator == "continue" {
+			if len(labels) == 0 {
+				uP.Throw("check/break/outside-loop", node.Token)
+			} else if node.Label != "" && !labelIn(node.Label, labels) {
+				uP.Throw("check/break/unknown-label", node.Token, node.Label)
+			}
+		}
+	case *ast.LoopExpression:
+		labels = append(labels, node.Label)
+	case *ast.FuncExpression:
+		labels = []string{}
+	}
+	for _, child := range ast.Children(node) {
+		uP.checkLoopControl(child, labels)
+	}
+}
+
+// A 'match' whose patterns are all elements of the same enum should either have an arm for every element of the
+// enum or an 'else', so we check that here.
+func (uP *Initializer) checkMatches() {
+	for _, fns := range uP.Parser.FunctionTable {
+		for _, fn := range fns {
+			if fn.Body != nil {
+				uP.checkMatchesIn(fn.Body)
+			}
+			if fn.Given != nil {
+				uP.checkMatchesIn(fn.Given)
+			}
+		}
+	}
+}
+
+func (uP *Initializer) checkMatchesIn(node ast.Node) {
+	if node, ok := node.(*ast.MatchExpression); ok {
+		uP.checkEnumMatch(node)
+	}
+	for _, child := range ast.Children(node) {
+		uP.checkMatchesIn(child)
+	}
+}
+
+func (uP *Initializer) checkEnumMatch(node *ast.MatchExpression) {
+	enumName := ""
+	found := map[string]bool{}
+	for _, pattern := range node.Patterns {
+		identifier, ok := pattern.(*ast.Identifier)
+		if !ok { // Which includes the case where it's an 'else'.
+			return
+		}
+		name := uP.enumOf(identifier.Value)
+		if name == "" || (enumName != "" && name != enumName) {
+			return
+		}
+		enumName = name
+		found[identifier.Value] = true
+	}
+	if enumName == "" {
+		return
+	}
+	missing := []string{}
+	for _, label := range uP.Parser.Enums[enumName] {
+		if !found[label.Value] {
+			missing = append(missing, "'"+label.Value+"'")
+		}
+	}
+	if len(missing) > 0 {
+		uP.Throw("check/match/exhaustive", node.Token, enumName, strings.Join(missing, ", "))
+	}
+}
+
+// Returns the name of the enum the label belongs to, or "" if there isn't one.
+func (uP *Initializer) enumOf(label string) string {
+	for name, labels := range uP.Parser.Enums {
+		for _, l := range labels {
+			if l.Value == label {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func labelIn(label string, labels []string) bool {
+	for _, l := range labels {
+		if l == label {
+			return true
+		}
+	}
+	return false
+}
+
+// Whether there's a command by that name and no function it could be instead.
+func (uP *Initializer) isOnlyCommand(name string) bool {
+	fns, ok := uP.Parser.FunctionTable[name]
+	if !ok || len(fns) == 0 {
+		return false
+	}
+	for _, fn := range fns {
+		if !fn.Cmd {
+			return false
+		}
+	}
+	return true
+}
+
 func flatten(s string) string {
 	return strings.ReplaceAll(s, ".", "_")
 }
@@ -902,6 +1493,53 @@ func (uP *Initializer) addSigToTree(tree *ast.FnTreeNode, fn *ast.Function, pos
 	return tree
 }
 
+// An overload can't be reached if every path through the function tree which leads to it is cut off by an earlier
+// branch of a node whose type is the same as or a supertype of the type of a later one, since the treewalker takes the
+// first branch that matches. Likewise when two leaves hang off the same node only the first can be reached. We warn
+// about such overloads, since the author presumably meant them to be called.
+func (uP *Initializer) checkOverloads() {
+	for functionName, fns := range uP.Parser.FunctionTable {
+		reached := map[*ast.Function]bool{}
+		uP.findReachableOverloads(uP.Parser.FunctionTreeMap[functionName], reached)
+		for i := range fns {
+			if !reached[&fns[i]] {
+				uP.Warn("check/overload/unreachable", fns[i].Body.GetToken(), functionName, fns[i].Sig.String())
+			}
+		}
+	}
+}
+
+func (uP *Initializer) findReachableOverloads(node *ast.FnTreeNode, reached map[*ast.Function]bool) {
+	if node == nil {
+		return
+	}
+	if node.Fn != nil {
+		reached[node.Fn] = true
+	}
+	for i, branch := range node.Branch {
+		if uP.isShadowed(node.Branch[:i], branch.TypeName) {
+			continue
+		}
+		uP.findReachableOverloads(branch.Node, reached)
+	}
+}
+
+// Whether a branch of the function tree with the given type can never be taken because of the branches before it.
+func (uP *Initializer) isShadowed(earlier []*ast.TypeNodePair, typeName string) bool {
+	for _, branch := range earlier {
+		if typeName == "" || branch.TypeName == "" || typeName == "tuple" || branch.TypeName == "tuple" {
+			if typeName == branch.TypeName {
+				return true
+			}
+			continue
+		}
+		if parser.IsSameTypeOrSubtype(uP.Parser.TypeSystem, typeName, branch.TypeName) {
+			return true
+		}
+	}
+	return false
+}
+
 /////////////////////////////////////////////////////////////////////////////////////////////////
 
 // This extracts the words from a function definition and decides on their "grammatical" role:
@@ -995,6 +1633,11 @@ func (uP *Initializer) Throw(errorID string, tok token.Token, args ...any) {
 	uP.Parser.Throw(errorID, tok, args...)
 }
 
+// Warnings are kept alongside the errors, but don't stop the service from being made.
+func (uP *Initializer) Warn(errorID string, tok token.Token, args ...any) {
+	uP.Parser.Warnings = append(uP.Parser.Warnings, object.CreateErr(errorID, tok, args...))
+}
+
 func (uP *Initializer) addError(err *object.Error) {
 	uP.Parser.Errors = append(uP.Parser.Errors, err)
 }
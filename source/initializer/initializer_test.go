@@ -0,0 +1,569 @@
+package initializer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"pipefish/source/evaluator"
+	"pipefish/source/object"
+	"pipefish/source/parser"
+)
+
+// Makes a service from the given script. The service gets a scratch directory of its own so that the Go handler
+// doesn't rewrite the repo's 'rsc/go/gotimes.dat', but reads the builtins and such from the repo's 'rsc/pipefish'.
+func makeTestService(t *testing.T, script string) (*parser.Service, *Initializer) {
+	return makeTestServiceWithRoot(t, script, &parser.Service{})
+}
+
+// Likewise, but with a root service which may e.g. have flags set on it.
+func makeTestServiceWithRoot(t *testing.T, script string, root *parser.Service) (*parser.Service, *Initializer) {
+	dir := t.TempDir()
+	resources, err := filepath.Abs("../../rsc/pipefish")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.MkdirAll(filepath.Join(dir, "rsc/go"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.WriteFile(filepath.Join(dir, "rsc/go/gotimes.dat"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(resources, filepath.Join(dir, "rsc/pipefish")); err != nil {
+		t.Fatal(err)
+	}
+	scriptFilepath := filepath.Join(dir, "test.pf")
+	if err = os.WriteFile(scriptFilepath, []byte(script), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return CreateService(scriptFilepath, nil, map[string]*parser.Service{}, parser.MakeStandardEffectHandler(os.Stdout), root, "", dir+"/")
+}
+
+// Checks that initializing the script produces errors with the given identifiers, in order.
+func expectErrors(t *testing.T, script string, expected []string) {
+	_, init := makeTestService(t, script)
+	if len(init.Parser.Errors) != len(expected) {
+		t.Fatalf("script %q: expected %d errors, got %d: %s", script, len(expected), len(init.Parser.Errors), init.ReturnErrors())
+	}
+	for i, err := range init.Parser.Errors {
+		if err.ErrorId != expected[i] {
+			t.Errorf("script %q: expected error %q, got %q", script, expected[i], err.ErrorId)
+		}
+	}
+}
+
+func TestSelfReferentialConstants(t *testing.T) {
+	tests := []struct {
+		script   string
+		expected []string
+	}{
+		{"def\n\na = b + 1\n\nb = 2\n", []string{}},
+		{"def\n\nx = x + 1\n", []string{"init/const/self-reference"}},
+		{"def\n\np = q\n\nq = p\n", []string{"init/const/self-reference", "init/const/self-reference"}},
+		{"var\n\nx = x + 1\n", []string{"init/var/self-reference"}},
+	}
+	for _, tt := range tests {
+		expectErrors(t, tt.script, tt.expected)
+	}
+}
+
+func TestInitOrder(t *testing.T) {
+	service, init := makeTestService(t, "var\n\nz = c\n\ndef\n\nc = b + 1\n\nb = a + 1\n\na = 1\n")
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	expected := []string{"a", "b", "c", "z"}
+	if !reflect.DeepEqual(service.InitOrder(), expected) {
+		t.Errorf("expected initialization order %v, got %v", expected, service.InitOrder())
+	}
+}
+
+func TestPurity(t *testing.T) {
+	tests := []struct {
+		script   string
+		expected []string
+	}{
+		{"def\n\nfoo(x int) : x + 1\n\ncmd\n\nbar(x int) :\n    return foo x\n", []string{}},
+		{"def\n\nfoo(x int) : bar x\n\ncmd\n\nbar(x int) :\n    return x\n", []string{"check/purity"}},
+		{"def\n\nfoo(x int) :\n    x == 0 : 0\n    else : y\ngiven :\n    y = bar x\n\ncmd\n\nbar(x int) :\n    return x\n", []string{"check/purity"}},
+	}
+	for _, tt := range tests {
+		expectErrors(t, tt.script, tt.expected)
+	}
+}
+
+func TestCommandReturnValues(t *testing.T) {
+	script := "cmd\n\nfoo(n int) -> int :\n    n + 1\n\nbar(n int) -> string :\n    n + 1\n\nbaz :\n    x = foo 3\n    x\n"
+	service, init := makeTestService(t, script)
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"foo 1", "2"},
+		{"baz", "4"},
+		{"(bar 1)[errorCode]", "\"eval/rets/match\""},
+	}
+	for _, tt := range tests {
+		result := evaluator.Evaluate(*service.Parser.ParseLine("test", tt.input), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+		if got := service.Parser.Serialize(result, parser.LITERAL); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+	expectErrors(t, "def\n\nx = foo 3\n\ncmd\n\nfoo(n int) -> int :\n    n + 1\n", []string{"check/purity/const"})
+	expectErrors(t, "var\n\nx = foo 3\n\ncmd\n\nfoo(n int) -> int :\n    n + 1\n", []string{})
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	expectErrors(t, "cmd\n\nfoo :\n    loop :\n        continue\n        break\n", []string{})
+	expectErrors(t, "cmd\n\nfoo :\n    break\n", []string{"check/break/outside-loop"})
+	expectErrors(t, "cmd\n\nfoo :\n    x = 1\n    x == 1 : continue\n", []string{"check/break/outside-loop"})
+	expectErrors(t, "cmd\n\nfoo :\n    loop outer :\n        loop :\n            break outer\n", []string{})
+	expectErrors(t, "cmd\n\nfoo :\n    loop outer :\n        loop :\n            continue inner\n", []string{"check/break/unknown-label"})
+	expectErrors(t, "cmd\n\nfoo :\n    loop outer :\n        break\n    loop :\n        break outer\n", []string{"check/break/unknown-label"})
+}
+
+func TestMatch(t *testing.T) {
+	expectErrors(t, "def\n\nColor = enum RED, GREEN, BLUE\n\nhue(c Color) :\n    match c :\n        RED : 0\n        GREEN : 120\n        BLUE : 240\n", []string{})
+	expectErrors(t, "def\n\nColor = enum RED, GREEN, BLUE\n\nhue(c Color) :\n    match c :\n        RED : 0\n        else : 120\n", []string{})
+	expectErrors(t, "def\n\nColor = enum RED, GREEN, BLUE\n\nhue(c Color) :\n    match c :\n        RED : 0\n        BLUE : 240\n", []string{"check/match/exhaustive"})
+	_, init := makeTestService(t, "def\n\nfoo(x) :\n    match x :\n        1 : 2\n        3\n")
+	if len(init.Parser.Errors) == 0 || init.Parser.Errors[0].ErrorId != "parse/match/arm" {
+		t.Errorf("expected error \"parse/match/arm\", got %s", init.ReturnErrors())
+	}
+}
+
+func TestInfixPrecedence(t *testing.T) {
+	ops := "(x int) plus (y int) : x + y\n\n(x int) times (y int) : x * y\n"
+	tests := []struct {
+		declarations string
+		input        string
+		expected     string
+	}{
+		{"", "a plus b times c", "((a plus b) times c)"},
+		{"infix 6 plus\n\ninfix 7 times\n\n", "a plus b times c", "(a plus (b times c))"},
+		{"infix 7 plus\n\ninfix 6 times\n\n", "a plus b times c", "((a plus b) times c)"},
+		{"infix 7 plus\n\ninfix 6 times\n\n", "a times b plus c", "(a times (b plus c))"},
+		{"infix 8 plus\n\n", "a * b plus c", "(a * (b plus c))"},
+		{"infix 1 plus\n\n", "a == b plus c == d", "((a == b) plus (c == d))"},
+	}
+	for _, tt := range tests {
+		service, init := makeTestService(t, "def\n\n"+tt.declarations+ops)
+		if init.ErrorsExist() {
+			t.Fatal(init.ReturnErrors())
+		}
+		parsedLine := service.Parser.ParseLine("test", tt.input)
+		if got := (*parsedLine).String(); got != tt.expected {
+			t.Errorf("with declarations %q, %s: expected %s, got %s", tt.declarations, tt.input, tt.expected, got)
+		}
+	}
+	service, _ := makeTestService(t, "def\n\ninfix 6 plus\n\ninfix 7 times\n\n"+ops)
+	result := evaluator.Evaluate(*service.Parser.ParseLine("test", "2 plus 3 times 4"), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+	if got := service.Parser.Serialize(result, parser.LITERAL); got != "14" {
+		t.Errorf("2 plus 3 times 4: expected 14, got %s", got)
+	}
+	expectErrors(t, "def\n\ninfix 6 plus\n\ninfix 7 plus\n\n"+ops, []string{"init/infix/conflict"})
+	expectErrors(t, "def\n\ninfix 6 plus\n\ninfix 6 plus\n\n"+ops, []string{})
+	expectErrors(t, "def\n\ninfix 9 plus\n\n"+ops, []string{"init/infix/level"})
+	expectErrors(t, "def\n\ninfix 6 +\n\n"+ops, []string{"init/infix/builtin"})
+	expectErrors(t, "def\n\ninfix 6 minus\n\n"+ops, []string{"init/infix/infix"})
+	expectErrors(t, "def\n\ninfix plus\n\n"+ops, []string{"init/infix/form"})
+}
+
+func TestInfixAssociativity(t *testing.T) {
+	ops := "(x int) ^^ (y int) :\n    y == 0 : 1\n    else : x * x ^^ (y - 1)\n\n(x int) minus (y int) : x - y\n"
+	tests := []struct {
+		declarations string
+		input        string
+		expected     string
+	}{
+		{"", "a ^^ b ^^ c", "((a ^^ b) ^^ c)"},
+		{"infixl 8 ^^\n\n", "a ^^ b ^^ c", "((a ^^ b) ^^ c)"},
+		{"infixr 8 ^^\n\n", "a ^^ b ^^ c", "(a ^^ (b ^^ c))"},
+		{"infixr 8 ^^\n\n", "a * b ^^ c ^^ d", "(a * (b ^^ (c ^^ d)))"},
+		{"infixr 8 ^^\n\n", "a ^^ b * c", "((a ^^ b) * c)"},
+		{"infixr 6 minus\n\n", "a minus b minus c", "(a minus (b minus c))"},
+		{"infixr 6 minus\n\n", "a minus b + c", "(a minus (b + c))"},
+		{"infixr 6 minus\n\n", "a + b minus c", "((a + b) minus c)"},
+	}
+	for _, tt := range tests {
+		service, init := makeTestService(t, "def\n\n"+tt.declarations+ops)
+		if init.ErrorsExist() {
+			t.Fatal(init.ReturnErrors())
+		}
+		parsedLine := service.Parser.ParseLine("test", tt.input)
+		if got := (*parsedLine).String(); got != tt.expected {
+			t.Errorf("with declarations %q, %s: expected %s, got %s", tt.declarations, tt.input, tt.expected, got)
+		}
+	}
+	service, _ := makeTestService(t, "def\n\ninfixr 8 ^^\n\n"+ops)
+	result := evaluator.Evaluate(*service.Parser.ParseLine("test", "2 ^^ 3 ^^ 2"), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+	if got := service.Parser.Serialize(result, parser.LITERAL); got != "512" {
+		t.Errorf("2 ^^ 3 ^^ 2: expected 512, got %s", got)
+	}
+	expectErrors(t, "def\n\ninfixl 8 ^^\n\ninfixr 8 ^^\n\n"+ops, []string{"init/infix/conflict"})
+	expectErrors(t, "def\n\ninfix 8 ^^\n\ninfixl 8 ^^\n\n"+ops, []string{})
+	expectErrors(t, "def\n\ninfixl 8 **\n\n"+ops, []string{"init/infix/builtin"})
+}
+
+func TestCompoundAssignment(t *testing.T) {
+	expectErrors(t, "cmd\n\nfoo(n int) :\n    x = n\n    x += 1\n    x -= 1\n    x *= 2\n", []string{})
+	expectErrors(t, "var\n\nx += 1\n", []string{"init/assign/compound"})
+	expectErrors(t, "def\n\nx *= 1\n", []string{"init/assign/compound"})
+	_, init := makeTestService(t, "def\n\nfoo(n int) : x\ngiven :\n    x += n\n")
+	if len(init.Parser.Errors) == 0 || init.Parser.Errors[0].ErrorId != "parse/assign/compound" {
+		t.Errorf("expected error \"parse/assign/compound\", got %s", init.ReturnErrors())
+	}
+}
+
+func TestUnionTypes(t *testing.T) {
+	expectErrors(t, "def\n\nCell = struct(name string, content int/string/bool)\n\nfoo(x int/bool) : x\n", []string{})
+	_, init := makeTestService(t, "def\n\nCell = struct(content int/5)\n")
+	if len(init.Parser.Errors) == 0 || init.Parser.Errors[0].ErrorId != "parse/sig/union" {
+		t.Errorf("expected error \"parse/sig/union\", got %s", init.ReturnErrors())
+	}
+}
+
+func TestOverloadingBuiltins(t *testing.T) {
+	expectErrors(t, "def\n\nTemperature = struct(degrees float64)\n\nstring(t Temperature) : \"hot\"\n", []string{})
+	expectErrors(t, "def\n\nint(x string) : 42\n", []string{"init/overload"})
+	expectErrors(t, "def\n\n(x int) + (y int) : 7\n", []string{"init/overload"})
+	_, init := makeTestService(t, "def\n\nfoo(x int) : x\n\nfoo(y int) : y + 1\n")
+	if len(init.Parser.Errors) != 1 || init.Parser.Errors[0].Token.Line != 5 {
+		t.Errorf("expected error \"init/overload\" at line 5, got %s", init.ReturnErrors())
+	}
+}
+
+func TestParameterNamedAsFunction(t *testing.T) {
+	expectErrors(t, "def\n\nsquare(exp float64) : exp * exp\n", []string{})
+	expectErrors(t, "def\n\ncapture (exp ast) : exp\n", []string{})
+}
+
+func TestParameterNames(t *testing.T) {
+	expectErrors(t, "def\n\nfoo(x int, x string) : x\n", []string{"init/sig/dup-param"})
+	expectErrors(t, "def\n\n(x int) ++ (x int) : x\n", []string{"init/sig/dup-param"})
+	expectErrors(t, "def\n\nthird(_, _, z) : z\n", []string{})
+	_, init := makeTestService(t, "var\n\ncount = 0\n\ndef\n\nLIMIT = 10\n\nbump(count int) : count + 1\n\ncap(n int, LIMIT int) : n\n\nsafe(n int) : n + LIMIT\n")
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	if len(init.Parser.Warnings) != 2 || init.Parser.Warnings[0].ErrorId != "init/sig/shadow" || init.Parser.Warnings[1].ErrorId != "init/sig/shadow" {
+		t.Errorf("expected two warnings \"init/sig/shadow\", got %s", object.GetWarningList(init.Parser.Warnings))
+	}
+}
+
+func TestStructDuplicateFields(t *testing.T) {
+	expectErrors(t, "def\n\nPerson = struct(name string, name int)\n", []string{"init/struct/dup-field"})
+	expectErrors(t, "def\n\nPerson = struct(name string, age int)\n", []string{})
+}
+
+func TestFlagsSize(t *testing.T) {
+	elements := []string{}
+	for i := 0; i <= object.MAX_FLAGS; i++ {
+		elements = append(elements, "F"+strconv.Itoa(i))
+	}
+	expectErrors(t, "def\n\nBig = flags "+strings.Join(elements[:object.MAX_FLAGS], ", ")+"\n", []string{})
+	expectErrors(t, "def\n\nTooBig = flags "+strings.Join(elements, ", ")+"\n", []string{"init/enum/flags"})
+}
+
+func TestSemicolonsAsNewlines(t *testing.T) {
+	withSemicolons, _ := makeTestService(t, "cmd\n\nfoo : x = 1; y = x + 1; y * 10\n")
+	withNewlines, _ := makeTestService(t, "cmd\n\nfoo :\n    x = 1\n    y = x + 1\n    y * 10\n")
+	got := withSemicolons.Parser.FunctionTable["foo"][0].Body.String()
+	expected := withNewlines.Parser.FunctionTable["foo"][0].Body.String()
+	if got != expected {
+		t.Errorf("expected %s, got %s", expected, got)
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	service, init := makeTestService(t, `def
+
+// The ratio of a circle's circumference
+// to its diameter, roughly.
+TAU = 6.28
+
+// A person.
+Person = struct(name string)
+
+// Says hello.
+greet(p Person) : "Hello, " + p[name] + "!"
+
+// Not the doc-comment of 'shout', since there's a blank line.
+
+shout(s string) : s + "!" // Nor is this.
+
+// Doubles an integer.
+double(x int) : 2 * x
+
+double(s string) : s + s
+
+// Adds things.
+(x int) +++ (y int) : x + y
+
+whisper(s string) :
+    s + "..."
+    // Nor is this, being in the body of 'whisper'.
+// Nor this, being squashed up against it.
+mutter(s string) : s + "..."
+
+cmd
+// Says goodbye.
+bye : post "Goodbye!"
+`)
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"TAU", "The ratio of a circle's circumference\nto its diameter, roughly."},
+		{"Person", "A person."},
+		{"greet", "Says hello."},
+		{"shout", ""},
+		{"double", "Doubles an integer."},
+		{"+++", "Adds things."},
+		{"mutter", ""},
+		{"bye", "Says goodbye."},
+		{"zort", ""},
+	}
+	for _, tt := range tests {
+		if got := service.Doc(tt.name); got != tt.expected {
+			t.Errorf("%s: expected doc %q, got %q", tt.name, tt.expected, got)
+		}
+	}
+}
+
+func TestDeprecation(t *testing.T) {
+	service, init := makeTestService(t, `def
+
+@deprecated "use 'area' instead"
+oldArea(w, h int) : w * h
+
+area(w, h int) : w * h
+
+@deprecated "use 'describe' on strings"
+describe(x int) : "int"
+
+describe(s string) : "string"
+
+a = oldArea(2, 3)
+
+b = area(2, 3)
+
+c = describe "x"
+
+d = describe 1
+`)
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	expected := []string{"use 'area' instead", "use 'describe' on strings"}
+	if len(init.Parser.Warnings) != len(expected) {
+		t.Fatalf("expected %d warnings, got %d: %v", len(expected), len(init.Parser.Warnings), init.Parser.Warnings)
+	}
+	for i, warning := range init.Parser.Warnings {
+		if warning.ErrorId != "check/deprecated" || !strings.Contains(warning.Message, expected[i]) {
+			t.Errorf("expected a deprecation warning saying %q, got %s: %s", expected[i], warning.ErrorId, warning.Message)
+		}
+	}
+	if service.Parser.FunctionTable["oldArea"][0].Deprecated != "use 'area' instead" {
+		t.Errorf("expected 'oldArea' to be deprecated")
+	}
+}
+
+func TestDeprecatedComparisonInChain(t *testing.T) {
+	_, init := makeTestService(t, `def
+
+@deprecated "compare with the length instead"
+(n int) < (s string) : n < len s
+
+x = 0 < 1 < "ab"
+`)
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	if len(init.Parser.Warnings) != 1 {
+		t.Fatalf("expected 1 warning, got %d: %v", len(init.Parser.Warnings), init.Parser.Warnings)
+	}
+	if warning := init.Parser.Warnings[0]; warning.ErrorId != "check/deprecated" ||
+		!strings.Contains(warning.Message, "compare with the length instead") {
+		t.Errorf("expected a deprecation warning, got %s: %s", warning.ErrorId, warning.Message)
+	}
+}
+
+func TestUnreachableOverloads(t *testing.T) {
+	// The treewalker takes the 'single' branch for the first argument before it ever looks at the 'int' branch.
+	_, init := makeTestService(t, "def\n\nfoo(x single) : 1\n\nfoo(x int, y int) : 2\n")
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	if len(init.Parser.Warnings) != 1 || init.Parser.Warnings[0].ErrorId != "check/overload/unreachable" {
+		t.Fatalf("expected one warning that an overload is unreachable, got %v", init.Parser.Warnings)
+	}
+	if !strings.Contains(init.Parser.Warnings[0].Message, "foo (x int, y int)") || init.Parser.Warnings[0].Token.Line != 5 {
+		t.Errorf("expected the warning to point to the second overload, got %s at line %d",
+			init.Parser.Warnings[0].Message, init.Parser.Warnings[0].Token.Line)
+	}
+	_, init = makeTestService(t, "def\n\nfoo(x int, y int) : 2\n\nfoo(x single) : 1\n")
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	if len(init.Parser.Warnings) != 0 {
+		t.Errorf("expected no warnings, got %v", init.Parser.Warnings)
+	}
+}
+
+func TestWhenFlags(t *testing.T) {
+	script := `def
+
+mode(x int) :
+    when debug :
+        x < 0 : "negative"
+    when verbose : "verbose"
+    "ordinary"
+`
+	root := parser.NewService()
+	root.SetFlag("debug", true)
+	root.SetFlag("verbose", false)
+	service, init := makeTestServiceWithRoot(t, script, root)
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	body := service.Parser.FunctionTable["mode"][0].Body.String()
+	if !strings.Contains(body, "negative") {
+		t.Errorf("expected the body of 'mode' to include the block guarded by a set flag, got %q", body)
+	}
+	if strings.Contains(body, "verbose") {
+		t.Errorf("expected the body of 'mode' to omit the block guarded by an unset flag, got %q", body)
+	}
+	for input, expected := range map[string]string{"mode -1": `"negative"`, "mode 1": `"ordinary"`} {
+		result := evaluator.Evaluate(*service.Parser.ParseLine("test", input), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+		if got := service.Parser.Serialize(result, parser.LITERAL); got != expected {
+			t.Errorf("%s: expected %s, got %s", input, expected, got)
+		}
+	}
+	service, init = makeTestService(t, script)
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	if body := service.Parser.FunctionTable["mode"][0].Body.String(); strings.Contains(body, "negative") {
+		t.Errorf("expected a flag to be unset by default, got %q", body)
+	}
+	_, init = makeTestService(t, "def\n\ng(x int) :\n    when debug x\n")
+	if !init.ErrorsExist() || init.Parser.Errors[0].ErrorId != "parse/when/colon" {
+		t.Errorf("expected a 'when' without a colon to be an error, got %s", init.ReturnErrors())
+	}
+}
+
+func TestConstantsAreFrozen(t *testing.T) {
+	service, init := makeTestService(t, `def
+
+Person = struct(name string, tags list)
+
+L = [1, [2, 3], 4]
+
+P = Person "Joe", ["a", "b"]
+
+inner(i int) : L[1][i]
+
+tag(i int) : P[tags][i]
+`)
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	for _, name := range []string{"L", "P"} {
+		forREPL, _ := service.Env.Get(name)
+		forFunctions, _ := service.Parser.GlobalConstants.Get(name)
+		if forREPL != forFunctions {
+			t.Errorf("expected the REPL and the functions to see the same value of %s", name)
+		}
+	}
+	evaluate := func(line string) object.Object {
+		return evaluator.Evaluate(*service.Parser.ParseLine("test", line), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+	}
+	// We alter values derived from the constants, in place, as no Pipefish code could, and check that the constants
+	// don't change.
+	evaluate(`L with [1, 1]::99`).(*object.List).Elements[1].(*object.List).Elements[0] = &object.Integer{Value: 99}
+	evaluate(`P with tags::["c"]`).(*object.Struct).Value["name"] = &object.String{Value: "Jim"}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`L`, `[1, [2, 3], 4]`},
+		{`P[name]`, `"Joe"`},
+		{`inner 0`, `2`},
+		{`inner 1`, `3`},
+		{`tag 0`, `"a"`},
+	}
+	for _, tt := range tests {
+		if got := service.Parser.Serialize(evaluate(tt.input), parser.LITERAL); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestNewtype(t *testing.T) {
+	service, init := makeTestService(t, `def
+
+Cat = struct(name string)
+
+Dog = struct(name string)
+
+newtype Number = int/float64
+
+newtype Pet = Cat/Dog
+
+newtype Thing = Pet/Number/string
+
+describe(x Number) : "number"
+
+describe(x Pet) : "pet"
+
+describe(x string) : "string"
+
+isThing(x Thing) : true
+
+isThing(x single) : false
+`)
+	if init.ErrorsExist() {
+		t.Fatal(init.ReturnErrors())
+	}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`describe 2`, `"number"`},
+		{`describe 2.5`, `"number"`},
+		{`describe Cat "Tom"`, `"pet"`},
+		{`describe Dog "Rex"`, `"pet"`},
+		{`describe "x"`, `"string"`},
+		{`isThing Dog "Rex"`, `true`},
+		{`isThing 3`, `true`},
+		{`isThing true`, `false`},
+		{`3 in Number`, `true`},
+		{`"x" in Number`, `false`},
+		{`NULL in Number?`, `true`},
+	}
+	for _, tt := range tests {
+		result := evaluator.Evaluate(*service.Parser.ParseLine("test", tt.input), evaluator.NewContext(service.Parser, service.Env, evaluator.REPL, false))
+		if got := service.Parser.Serialize(result, parser.LITERAL); got != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+	expectErrors(t, "def\n\nnewtype Number = int/float\n", []string{"init/newtype/type"})
+	expectErrors(t, "def\n\nnewtype Number = int float64\n", []string{"init/newtype/form"})
+	expectErrors(t, "def\n\nnewtype int = float64/string\n", []string{"init/newtype/exists"})
+}
+
+func TestDeprecationErrors(t *testing.T) {
+	expectErrors(t, "def\n\n@deprecated \"no\"\nx = 1\n", []string{"init/deprecated/target"})
+	expectErrors(t, "def\n\n@deprecated\ng(x int) : x\n", []string{"init/deprecated/form"})
+	expectErrors(t, "def\n\n@obsolete \"no\"\ng(x int) : x\n", []string{"init/deprecated/form"})
+}
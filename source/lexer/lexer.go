@@ -24,6 +24,8 @@ type Lexer struct {
 	source            string
 	snippetWhitespace string
 	afterSnippet      bool
+	Comments          map[int]string // The comments starting at column 0, by line number, which may be doc-comments.
+	BlankLines        map[int]bool   // So we can tell whether such a comment follows on from the code above it.
 }
 
 func New(source, input string) *Lexer {
@@ -39,6 +41,8 @@ func New(source, input string) *Lexer {
 		whitespaceStack: *stack,
 		Ers:             []*object.Error{},
 		source:          source,
+		Comments:        map[int]string{},
+		BlankLines:      map[int]bool{},
 	}
 	l.readChar()
 	return l
@@ -133,8 +137,23 @@ func (l *Lexer) NextToken() token.Token {
 		tok = l.NewToken(token.RPAREN, ")")
 	case '"':
 		tok = l.NewToken(token.STRING, "")
+		if l.peekChar() == '"' {
+			l.readChar()
+			if l.peekChar() != '"' {
+				break // Then it's the empty string.
+			}
+			l.readChar()
+			s, ok := l.readMultilineString()
+			tok = makeStringToken(tok, s)
+			if !ok {
+				l.Throw("lex/quote/e", tok)
+			}
+			l.readChar()
+			l.afterWhitespace = false
+			return tok // Rather than breaking, so that the token keeps the line it started on.
+		}
 		s, ok := l.readFormattedString()
-		tok.Literal = s
+		tok = makeStringToken(tok, s)
 		if !ok {
 			l.Throw("lex/quote/a", tok)
 		}
@@ -177,6 +196,14 @@ func (l *Lexer) NextToken() token.Token {
 			l.afterWhitespace = false
 			return tok
 		}
+		if (l.ch == '+' || l.ch == '-' || l.ch == '*') && l.peekChar() == '=' { // Compound assignment.
+			op := string(l.ch)
+			l.readChar()
+			l.readChar()
+			tok = l.NewToken(token.ASSIGN, op+"=")
+			l.afterWhitespace = false
+			return tok
+		}
 		if l.ch == '>' && l.peekChar() == '>' {
 			l.readChar()
 			tok = l.NewToken(token.MAP, ">>")
@@ -261,11 +288,15 @@ func (l *Lexer) interpretWhitespace() token.Token {
 		l.snippetWhitespace = ""
 	}
 	if l.ch == '\n' {
+		l.BlankLines[l.line] = true
 		return l.NewToken(token.NO_INDENT, "|||")
 	}
 	if l.ch == '/' && l.peekChar() == '/' {
 		l.readChar()
 		comment := l.readComment()
+		if whitespace == "" {
+			l.Comments[l.line] = comment
+		}
 		l.readChar()
 		return l.NewToken(token.COMMENT, comment)
 	}
@@ -338,14 +369,23 @@ func (l *Lexer) skipWhitespace() {
 	}
 }
 
+// Comments are skipped, whether at the end of the line being continued or on lines of their own before the
+// continuation, so that e.g. the fields of a struct can be commented one by one.
 func (l *Lexer) skipWhitespaceAfterPotentialContinuation() bool {
 	for l.peekChar() == ' ' || l.peekChar() == '\t' || l.peekChar() == '\r' {
 		l.readChar()
 	}
+	if l.peekComment() {
+		l.readComment()
+	}
 	if l.peekChar() != '\n' {
 		return true
 	}
-	for l.peekChar() == '\n' || l.peekChar() == ' ' || l.peekChar() == '\t' || l.peekChar() == '\r' {
+	for l.peekChar() == '\n' || l.peekChar() == ' ' || l.peekChar() == '\t' || l.peekChar() == '\r' || l.peekComment() {
+		if l.peekComment() {
+			l.readComment()
+			continue
+		}
 		l.readChar()
 	}
 	if l.peekChar() != '.' {
@@ -427,6 +467,10 @@ func (l *Lexer) readHexNumber() string {
 	return result
 }
 
+func (l *Lexer) peekComment() bool {
+	return strings.HasPrefix(l.input[len(l.input)-l.reader.Len():], "//")
+}
+
 func (l *Lexer) readComment() string {
 	result := ""
 	for !(l.peekChar() == '\n' || l.peekChar() == 0) {
@@ -517,7 +561,7 @@ func (l *Lexer) readGolang() string {
 			l.Throw("lex/quote/c", l.NewToken(token.ILLEGAL, "lex/quote/c"))
 		}
 		l.readChar()
-		return s
+		return Unescape(s)
 	}
 	if l.peekChar() == '`' {
 		l.readChar()
@@ -564,6 +608,7 @@ func (l *Lexer) readGolang() string {
 	return result
 }
 
+// This returns the string with its escapes still in it, so that we can find the interpolations before we unescape it.
 func (l *Lexer) readFormattedString() (string, bool) {
 	escape := false
 	result := ""
@@ -572,29 +617,11 @@ func (l *Lexer) readFormattedString() (string, bool) {
 		if (l.ch == '"' && !escape) || l.ch == 0 || l.ch == 13 || l.ch == 10 {
 			break
 		}
-		if l.ch == '\\' {
-			escape = true
-			continue
-		}
-
-		charToAdd := l.ch
-
 		if escape {
-			escape = false
-			switch l.ch {
-			case 'n':
-				charToAdd = '\n'
-			case 'r':
-				charToAdd = '\r'
-			case 't':
-				charToAdd = '\t'
-			case '"':
-				charToAdd = '"'
-			case '\\':
-				charToAdd = '\\'
-			}
+			l.checkEscape()
 		}
-		result = result + string(charToAdd)
+		escape = l.ch == '\\' && !escape
+		result = result + string(l.ch)
 	}
 	if l.ch == 13 || l.ch == 0 || l.ch == 10 {
 		return result, false
@@ -602,6 +629,8 @@ func (l *Lexer) readFormattedString() (string, bool) {
 	return result, true
 }
 
+// Strings in backticks are raw: backslashes, quotes, and braces all stand for themselves, which is convenient for
+// such things as regular expressions and Windows paths.
 func (l *Lexer) readPlaintextString() (string, bool) {
 	result := ""
 	for {
@@ -617,6 +646,147 @@ func (l *Lexer) readPlaintextString() (string, bool) {
 	return result, true
 }
 
+// This reads the body of a string begun with """ and ended with """, which may run over several lines and contain
+// unescaped quotes. If the opening quotes are followed by a newline, then the string is a block: the first newline
+// is dropped, so is the last line if it's only whitespace, and so is the indentation common to the remaining lines.
+// This lets us indent the string along with the code around it. Like readFormattedString, this returns the string
+// with its escapes still in it, so an escaped '\t' at the start of a line isn't mistaken for indentation.
+func (l *Lexer) readMultilineString() (string, bool) {
+	escape := false
+	quotes := 0 // The number of unescaped quotes we've just seen.
+	result := ""
+	for {
+		l.readChar()
+		if l.ch == 0 {
+			l.newline = false
+			return result, false
+		}
+		if l.ch == '"' && !escape {
+			quotes++
+		} else {
+			quotes = 0
+		}
+		if quotes == 3 {
+			break
+		}
+		if escape {
+			l.checkEscape()
+		}
+		escape = l.ch == '\\' && !escape
+		result = result + string(l.ch)
+	}
+	l.newline = false // Since the lexer will have noticed the newlines inside the string.
+	result = result[:len(result)-2]
+	if strings.HasPrefix(result, "\n") || strings.HasPrefix(result, "\r\n") {
+		result = dedent(result[strings.Index(result, "\n")+1:])
+	}
+	return result, true
+}
+
+func dedent(s string) string {
+	lines := strings.Split(strings.ReplaceAll(s, "\r\n", "\n"), "\n")
+	if strings.TrimLeft(lines[len(lines)-1], " \t") == "" {
+		lines = lines[:len(lines)-1]
+	}
+	indent := ""
+	indentFound := false
+	for _, line := range lines {
+		if strings.TrimLeft(line, " \t") == "" {
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if !indentFound {
+			indent, indentFound = lineIndent, true
+			continue
+		}
+		for !strings.HasPrefix(lineIndent, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	for i, line := range lines {
+		if strings.HasPrefix(line, indent) {
+			lines[i] = line[len(indent):]
+		} else {
+			lines[i] = "" // Since it must consist only of whitespace.
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// A string containing an unescaped '{' is a template, to be split up by the parser into the literal parts and the
+// expressions to be interpolated. Otherwise we can unescape it here.
+func makeStringToken(tok token.Token, s string) token.Token {
+	escape := false
+	for _, ch := range s {
+		if ch == '{' && !escape {
+			tok.Type = token.TEMPLATE
+			tok.Literal = s
+			return tok
+		}
+		escape = ch == '\\' && !escape
+	}
+	tok.Literal = Unescape(s)
+	return tok
+}
+
+// This is called when the current character follows a backslash in a string literal, and checks that it's one of
+// the escapes understood by Unescape.
+func (l *Lexer) checkEscape() {
+	switch l.ch {
+	case 'n', 'r', 't', '"', '\\', '{', '}':
+		return
+	case 'u':
+		next := l.input[len(l.input)-l.reader.Len():]
+		if len(next) >= 4 && isHex(next[:4]) {
+			return
+		}
+		tok := token.Token{Type: token.ILLEGAL, Literal: "lex/escape/u", Source: l.source, Line: l.line, ChStart: l.char - 1, ChEnd: l.char}
+		l.Throw("lex/escape/u", tok)
+	default:
+		tok := token.Token{Type: token.ILLEGAL, Literal: "lex/escape", Source: l.source, Line: l.line, ChStart: l.char - 1, ChEnd: l.char}
+		l.Throw("lex/escape", tok, l.ch)
+	}
+}
+
+func isHex(s string) bool {
+	_, err := strconv.ParseUint(s, 16, 32)
+	return err == nil
+}
+
+// Interprets the escapes in a string literal, which the lexer will have checked. '\uXXXX' is the character with the
+// given hexadecimal code point, and anything else escaped other than 'n', 'r', and 't' stands for itself.
+func Unescape(s string) string {
+	escape := false
+	result := ""
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		if ch == '\\' && !escape {
+			escape = true
+			continue
+		}
+		if escape {
+			escape = false
+			switch ch {
+			case 'n':
+				ch = '\n'
+			case 'r':
+				ch = '\r'
+			case 't':
+				ch = '\t'
+			case 'u':
+				if i+5 <= len(runes) && isHex(string(runes[i+1:i+5])) {
+					code, _ := strconv.ParseUint(string(runes[i+1:i+5]), 16, 32)
+					ch = rune(code)
+					i = i + 4
+				}
+			}
+		}
+		result = result + string(ch)
+	}
+	return result
+}
+
 func (l *Lexer) readIdentifier() string {
 	result := ""
 	for isLegalNonStart(l.ch) {
@@ -194,3 +194,229 @@ line five`
 		}
 	}
 }
+
+func TestCompoundAssignment(t *testing.T) {
+	input := `x += 1; y -= 2; z *= 3; a <= b`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{{token.NO_INDENT, "|||"},
+		{token.IDENT, "x"},
+		{token.ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "y"},
+		{token.ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "z"},
+		{token.ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.IDENT, "<="},
+		{token.IDENT, "b"},
+	}
+
+	l := New("dummy source", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestMultilineStrings(t *testing.T) {
+	input := "x = \"\"\"He said \"hi\".\"\"\"\n" +
+		"y = \"\"\"\n    SELECT *\n    \tFROM t\\tu\n\n    \"\"\"\n" +
+		"z = \"\", \"\"\"a\n  b\"\"\"\n" +
+		"w = \"\"\"x"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+	}{{token.NO_INDENT, "|||", 1},
+		{token.IDENT, "x", 1},
+		{token.ASSIGN, "=", 1},
+		{token.STRING, "He said \"hi\".", 1},
+		{token.NEWLINE, ";", 1},
+		{token.NO_INDENT, "|||", 2},
+		{token.IDENT, "y", 2},
+		{token.ASSIGN, "=", 2},
+		{token.STRING, "SELECT *\n\tFROM t\tu\n", 2},
+		{token.NEWLINE, ";", 6},
+		{token.NO_INDENT, "|||", 7},
+		{token.IDENT, "z", 7},
+		{token.ASSIGN, "=", 7},
+		{token.STRING, "", 7},
+		{token.COMMA, ",", 7},
+		{token.STRING, "a\n  b", 7},
+		{token.NEWLINE, ";", 8},
+		{token.NO_INDENT, "|||", 9},
+		{token.IDENT, "w", 9},
+		{token.ASSIGN, "=", 9},
+		{token.STRING, "x", 9},
+		{token.EOF, "EOF", 9},
+	}
+
+	l := New("dummy source", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine {
+			t.Fatalf("tests[%d] - line wrong. expected=%d, got=%d", i, tt.expectedLine, tok.Line)
+		}
+	}
+	if len(l.Ers) != 1 || l.Ers[0].ErrorId != "lex/quote/e" {
+		t.Fatalf("expected error lex/quote/e, got %v", l.Ers)
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	input := "\"a\\{b\" + \"a{b}c\" + \"a\\\\{b}\" + `a{b}`"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{{token.NO_INDENT, "|||"},
+		{token.STRING, "a{b"},
+		{token.IDENT, "+"},
+		{token.TEMPLATE, "a{b}c"},
+		{token.IDENT, "+"},
+		{token.TEMPLATE, "a\\\\{b}"},
+		{token.IDENT, "+"},
+		{token.STRING, "a{b}"},
+	}
+
+	l := New("dummy source", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestRawStrings(t *testing.T) {
+	input := "`C:\\new\\table` `say \"hi\"` `\\d+{2}\\n` `oops"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{{token.NO_INDENT, "|||"},
+		{token.STRING, "C:\\new\\table"},
+		{token.STRING, "say \"hi\""},
+		{token.STRING, "\\d+{2}\\n"},
+		{token.STRING, "oops"},
+	}
+
+	l := New("dummy source", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+	if len(l.Ers) != 1 || l.Ers[0].ErrorId != "lex/quote/b" {
+		t.Fatalf("expected error lex/quote/b, got %v", l.Ers)
+	}
+}
+
+func TestEscapes(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+	}{
+		{`"a\tb"`, "a\tb"},
+		{`"a\nb\rc"`, "a\nb\rc"},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"C:\\new"`, `C:\new`},
+		{`"caf\u00e9 \u263A"`, "café ☺"},
+		{`"\{x\}"`, "{x}"},
+		{`"""a\tb "quoted" \u00e9"""`, "a\tb \"quoted\" é"},
+	}
+	for _, tt := range tests {
+		l := New("dummy source", tt.input)
+		l.NextToken()
+		tok := l.NextToken()
+		if tok.Type != token.STRING || tok.Literal != tt.expectedLiteral {
+			t.Errorf("%s: expected string %q, got %s %q", tt.input, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if len(l.Ers) != 0 {
+			t.Errorf("%s: unexpected errors %v", tt.input, l.Ers)
+		}
+	}
+
+	badEscapes := []struct {
+		input           string
+		expectedErrorID string
+		expectedChStart int
+	}{
+		{`x = "ab\qc"`, "lex/escape", 7},
+		{`x = "\u12"`, "lex/escape/u", 5},
+		{`x = "\u12zz"`, "lex/escape/u", 5},
+		{"x = \"\"\"a\n\\w\"\"\"", "lex/escape", 0},
+	}
+	for _, tt := range badEscapes {
+		l := New("dummy source", tt.input)
+		for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		}
+		if len(l.Ers) != 1 || l.Ers[0].ErrorId != tt.expectedErrorID || l.Ers[0].Token.ChStart != tt.expectedChStart {
+			t.Errorf("%s: expected error %s at %d, got %v", tt.input, tt.expectedErrorID, tt.expectedChStart, l.Ers)
+		}
+	}
+}
+
+func TestCommentsInContinuations(t *testing.T) {
+	input := "f(a, // first\n  // more\n  .. b) // last"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{{token.NO_INDENT, "|||"},
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a"},
+		{token.COMMA, ","},
+		{token.IDENT, "b"},
+		{token.RPAREN, ")"},
+		{token.COMMENT, " last"},
+		{token.EOF, "EOF"},
+	}
+
+	l := New("dummy source", input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+	if len(l.Ers) != 0 {
+		t.Fatalf("unexpected errors %v", l.Ers)
+	}
+}
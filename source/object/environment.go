@@ -30,12 +30,31 @@ func (storage *Storage) GetValue() Object {
 	return storage.obj
 }
 
+// Returns the storage with a deep copy of its value, so that nothing done with the original value can affect it.
+func (storage Storage) DeepCopy() Storage {
+	return Storage{storage.obj.DeepCopy(), storage.access, storage.VarType}
+}
+
 func NewEnvironment() *Environment {
 	s := make(map[string]Storage)
 	p := make(map[string]Object)
 	return &Environment{Store: s, Pending: p}
 }
 
+// Returns a copy of the environment whose own variables can be changed without affecting the original. The
+// environments it extends are shared.
+func (e *Environment) Copy() *Environment {
+	newEnv := NewEnvironment()
+	for k, v := range e.Store {
+		newEnv.Store[k] = v
+	}
+	for k, v := range e.Pending {
+		newEnv.Pending[k] = v
+	}
+	newEnv.Ext = e.Ext
+	return newEnv
+}
+
 func (e *Environment) ImportGlobal(name string, val Object, ty string) {
 	e.Store[name] = Storage{val, ACCESS_GLOBAL, ty}
 }
@@ -12,7 +12,7 @@ import (
 //
 // Errors in the map are in alphabetical order of their identifers.
 //
-// Major categories are built, err, eval, init, lex, parse, repl, and serve.
+// Major categories are built, check, err, eval, init, lex, parse, repl, and serve.
 //
 // Two otherwise identical errors thrown in different places in the Go code must be assigned
 // different identifiers, if only by suffixing /a, /b, etc to the identifier, with the following exception:
@@ -32,6 +32,99 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/as/type": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't convert type <" + args[0].(string) + "> to <" + args[1].(string) + ">"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The only conversion of one type into another is that an enum type can be turned into the set of " +
+				"its elements, e.g. 'Color as set'."
+		},
+	},
+
+	"built/cast/abstract": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't cast to abstract type " + emphText(args[0])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'cast' function needs to know what the type of its result should be, so the type it's " +
+				"given must be a concrete type such as 'int' or 'float64', and not an abstract type such as 'single'."
+		},
+	},
+
+	"built/cast/range": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't cast " + emphText(args[0]) + " to 'int'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Casting a 'float64' to an 'int' drops anything after the decimal point, but infinities and NaN " +
+				"have no integer part to keep, and other numbers may have an integer part too big to fit in an 'int'."
+		},
+	},
+
+	"built/cast/unsupported": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't cast value of type " + emphText(args[0]) + " to " + emphText(args[1])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'cast' function converts between 'int' and 'float64', truncating a 'float64' towards zero " +
+				"to make an 'int'. It will also 'cast' a value to its own type, which leaves it as it is. Anything " +
+				"else is an error."
+		},
+	},
+
+	"built/channel/capacity": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't make a channel with negative capacity " + emphNum(args[0])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The capacity of a channel is how many values can be sent to it before anything receives them, " +
+				"so it can be zero, but it can't be negative."
+		},
+	},
+
+	"built/channel/empty": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't receive from an empty channel"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Receiving from a channel doesn't wait for something to be sent to it, since nothing else in the " +
+				"same evaluation could send it. So there has to be a value in the channel already."
+		},
+	},
+
+	"built/channel/full": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't send to a channel of capacity " + emphNum(args[0]) + " which is full"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Sending to a channel doesn't wait for something to receive from it, since nothing else in the " +
+				"same evaluation could receive it. So there has to be room in the channel for the value: one with " +
+				"capacity 'n' holds at most 'n' values that haven't been received yet, and one with capacity zero " +
+				"can only be sent to when something is already waiting to receive."
+		},
+	},
+
+	"built/chunks/size": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't split a list into pieces of size " + emphText(args[0])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The functions 'chunks' and 'windows' split a list into sublists of the given length, and so that " +
+				"length must be at least 1."
+		},
+	},
+
+	"built/clamp/range": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't clamp to a range with lower bound " + emphText(args[0]) + " greater than upper bound " + emphText(args[1])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'clamp(x, lo, hi)' returns 'lo' if 'x' is less than 'lo', 'hi' if 'x' is greater than 'hi', " +
+				"and 'x' otherwise. This only makes sense if 'lo' is no greater than 'hi'."
+		},
+	},
+
 	"built/codepoint": {
 		Message: func(tok token.Token, args ...any) string {
 			return fmt.Sprintf("codepoint applied to string of length %v", args[0].(int))
@@ -41,6 +134,18 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/deserialize": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't deserialize string: " + args[0].(string) + " at character " + emphNum(args[1])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'deserialize' reads back the strings that 'serialize' makes. It only knows how to " +
+				"read values written the way 'serialize' writes them, and the names of the types, enum elements and " +
+				"struct fields it reads must be those of the service. Since 'serialize' never writes the same " +
+				"element of a set, key of a map, or field of a struct twice, neither may the string."
+		},
+	},
+
 	"built/div/float64": {
 		Message: func(tok token.Token, args ...any) string {
 			return "division by zero"
@@ -63,6 +168,108 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/exp/neg": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't raise an integer to the negative power " + emphNum(args[0])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Raising an integer to a negative power would give you a fraction, which isn't an integer. If " +
+				"that's what you want, convert the numbers to floats first, e.g. 'float64(x) ** float64(y)'."
+		},
+	},
+
+	"built/field/missing": {
+		Message: func(tok token.Token, args ...any) string {
+			return emph(args[0].(string)) + " doesn't label a field of structs of type " + emph(args[1].(string))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'set_field' function can only give a new value to a field the struct already has, and structs " +
+				"of type " + emph(args[1].(string)) + " have no field labeled " + emph(args[0].(string)) + "."
+		},
+	},
+
+	"built/find/bool": {
+		Message: func(tok token.Token, args ...any) string {
+			return "the function given to 'find' should return a boolean, not something of type " +
+				EmphType(args[0].(Object))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'find' looks for the first element of a list for which the function it's given " +
+				"returns 'true', and so the function must return a boolean."
+		},
+	},
+
+	"built/flags/mix": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't combine flags of type " + emph(args[0].(string)) + " with flags of type " + emph(args[1].(string))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The elements of a flags type can only be combined or compared with elements of the same type."
+		},
+	},
+
+	"built/flags/type": {
+		Message: func(tok token.Token, args ...any) string {
+			return emph(args[0].(string)) + " is not a flags type"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'no_flags' function returns the value of a flags type with none of the flags set, and so it " +
+				"must be passed a type declared with 'flags', e.g. 'Permission = flags READ, WRITE, EXECUTE'."
+		},
+	},
+
+	"built/floordiv/int": {
+		Message: func(tok token.Token, args ...any) string {
+			return "division by zero in 'floor_div'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'floor_div' divides one integer by another and rounds the quotient down. Since " +
+				"'x * 0 == y * 0' for any integers 'x' and 'y', there is no right answer to dividing by zero, and " +
+				"so there is nothing to round down."
+		},
+	},
+
+	"built/floormod/int": {
+		Message: func(tok token.Token, args ...any) string {
+			return "taking the remainder on division by zero in 'floor_mod'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'floor_mod' returns what's left over when one integer is divided by another with " +
+				"the quotient rounded down. Since there is no right answer to dividing by zero, there is no " +
+				"quotient to round and so nothing left over."
+		},
+	},
+
+	"built/format/gocode": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't format code, line " + strconv.Itoa(args[0].(int)) + ": can't lay out 'gocode'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'format_source' function doesn't yet know how to lay out 'gocode' blocks, since what's " +
+				"inside them is Go rather than Pipefish, and so can't format code containing them."
+		},
+	},
+
+	"built/format/lex": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't format code, line " + strconv.Itoa(args[1].(int)) + ": " + args[0].(string)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'format_source' function can only format code that it can split into tokens, and this code " +
+				"has an error at the level of the lexer: an unclosed quote, a bad escape sequence, or suchlike."
+		},
+	},
+
+	"built/format/snippet": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't format code, line " + strconv.Itoa(args[0].(int)) + ": can't lay out '---'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'format_source' function doesn't yet know how to lay out snippets, which begin with '---' " +
+				"and run to the end of the line, and so can't format code containing them."
+		},
+	},
+
 	"built/hash/a": {
 		Message: func(tok token.Token, args ...any) string {
 			return "objects of type " + EmphType(args[0].(Object)) + " cannot be used as hashkeys"
@@ -148,6 +355,25 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/log/domain": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't take " + emphText(args[0]) + " of " + emphText(args[1])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Logarithms are only defined for numbers greater than zero."
+		},
+	},
+
+	"built/log/level": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't log at level " + emphText(args[0])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'log' command takes as its first parameter the level to log at, which must be one of \"debug\", " +
+				"\"info\", \"warn\" or \"error\"."
+		},
+	},
+
 	"built/mod": {
 		Message: func(tok token.Token, args ...any) string {
 			return "taking the remainder on division by zero"
@@ -180,6 +406,37 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/merge/type": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't merge a struct of type " + emphText(args[0]) + " with one of type " + emphText(args[1])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'merge_structs' combines two structs field by field, and so they must be of the " +
+				"same type."
+		},
+	},
+
+	"built/minby/empty": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't find the least or greatest element of an empty list"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The functions 'min_by' and 'max_by' return an element of the list they're given, and so there's " +
+				"nothing they can return if the list is empty."
+		},
+	},
+
+	"built/minby/key": {
+		Message: func(tok token.Token, args ...any) string {
+			return "the function given to 'min_by' or 'max_by' should return a number, not something of type " +
+				EmphType(args[0].(Object))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The functions 'min_by' and 'max_by' compare the elements of a list by applying the function to each " +
+				"of them, and so the function must return something that can be compared, i.e. an <int> or a <float64>."
+		},
+	},
+
 	"built/pair/empty/a": {
 		Message: func(tok token.Token, args ...any) string {
 			return "malformed pair in 'with' expression"
@@ -207,9 +464,31 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/partition/bool": {
+		Message: func(tok token.Token, args ...any) string {
+			return "the function given to 'partition' should return a boolean, not something of type " +
+				EmphType(args[0].(Object))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'partition' splits a list into the elements for which the function it's given " +
+				"returns 'true' and those for which it returns 'false', and so the function must return a boolean."
+		},
+	},
+
+	"built/pmap/command": {
+		Message: func(tok token.Token, args ...any) string {
+			return "the function given to 'pmap' can't call a command"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'pmap' applies the function it's given to the elements of the list at the same " +
+				"time, which is only safe if the function doesn't have side effects. So it mustn't call any " +
+				"commands. If you want to do that, use '>>' instead, which applies it to one element at a time."
+		},
+	},
+
 	"built/range/list/a": {
 		Message: func(tok token.Token, args ...any) string {
-			return fmt.Sprintf("index %v is out of bounds: list has length %v", args[0].(int), args[1].(int))
+			return fmt.Sprintf("index %v is out of bounds: list has length %v", args[0], args[1])
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
 			return "Recall that in Pipefish, lists are zero-indexed, which means that the first element has index 0 and the " +
@@ -220,7 +499,7 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 
 	"built/range/list/b": {
 		Message: func(tok token.Token, args ...any) string {
-			return fmt.Sprintf("index %v is out of bounds: list has length %v", args[0].(int), args[1].(int))
+			return fmt.Sprintf("index %v is out of bounds: list has length %v", args[0], args[1])
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
 			return "Recall that in Pipefish, lists are zero-indexed, which means that the first element has index 0 and the " +
@@ -229,6 +508,59 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/range/step/type": {
+		Message: func(tok token.Token, args ...any) string {
+			return "ranges with a step are defined by a pair of numbers and a number, not by " +
+				EmphType(args[0].(Object)) + "::" + EmphType(args[1].(Object)) + " and " + EmphType(args[2].(Object))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A range with a step is a list of numbers going from the left-hand side of a pair towards (but not " +
+				"including) the right-hand side in steps of the given size: for example 'range 0::10, 3' is [0, 3, 6, 9]. " +
+				"If all three numbers are of type <int> then so is the list, and otherwise it's of type <float64>."
+		},
+	},
+
+	"built/range/step/zero": {
+		Message: func(tok token.Token, args ...any) string {
+			return "the step of a range can't be zero"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A range counts up from the left-hand side of the pair if the step is positive, and down if it's negative. " +
+				"With a step of zero it would never get anywhere."
+		},
+	},
+
+	"built/repeat/count": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't repeat something " + emphNum(args[0]) + " times"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The functions 'repeat_list' and 'cycle' make a list by repeating a value or a list the given " +
+				"number of times, and so that number can be 0 but can't be negative."
+		},
+	},
+
+	"built/serialize/type": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't serialize a value of type " + EmphType(args[0].(Object))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'serialize' writes values as text which 'deserialize' can read back, and there's no " +
+				"way to do that for things like functions and channels, which only make sense while the service is running."
+		},
+	},
+
+	"built/sign/nan": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't take the sign of NaN"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'sign' returns -1 for negative numbers, 1 for positive numbers, and 0 for zero, " +
+				"whether positive or negative zero. The floating-point value NaN ('not a number') is none of these, and so " +
+				"has no sign."
+		},
+	},
+
 	"built/slice/int/range": {
 		Message: func(tok token.Token, args ...any) string {
 			return "ranges are defined by pairs of type <int>::<int>, not of type " +
@@ -240,6 +572,48 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/struct/field-type/a": {
+		Message: func(tok token.Token, args ...any) string {
+			return wrongFieldType(args...)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Since 'with' can change the fields of a struct, including those of structs inside it, Pipefish " +
+				"checks afterwards that each field still has the type given for it in the struct declaration. " +
+				fieldTypeAdvice
+		},
+	},
+
+	"built/struct/field-type/b": {
+		Message: func(tok token.Token, args ...any) string {
+			return wrongFieldType(args...)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'set_field' function can only give a field a value of the type given for it in the struct " +
+				"declaration. " + fieldTypeAdvice
+		},
+	},
+
+	"built/struct/field-type/c": {
+		Message: func(tok token.Token, args ...any) string {
+			return wrongFieldType(args...)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'struct_of' function makes a struct from the values in a map, and each value must have the " +
+				"type given for its field in the struct declaration. " + fieldTypeAdvice
+		},
+	},
+
+	"built/struct/field-type/d": {
+		Message: func(tok token.Token, args ...any) string {
+			return wrongFieldType(args...)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'merge_structs' function makes a struct by applying the function it's given to the values " +
+				"of each field of two structs, and each result must have the type given for its field in the " +
+				"struct declaration. " + fieldTypeAdvice
+		},
+	},
+
 	"built/struct/field/a": {
 		Message: func(tok token.Token, args ...any) string {
 			return "value doesn't label a field of structs of type <" + args[1].(string) + ">"
@@ -262,6 +636,26 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/struct/missing": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't make a struct of type " + emphText(args[1]) + " from a map with no value for field " + emphText(args[0])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'struct_of' makes a struct by looking up each of its fields in the map it's given, " +
+				"whether by the label of the field or by its name as a string, and so every field must be in the map."
+		},
+	},
+
+	"built/struct/of": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't make a struct of type " + emphText(args[0])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The function 'struct_of' makes a struct of the type it's given from a map, and so the type must be " +
+				"a concrete struct type, not an abstract type or a type of something else."
+		},
+	},
+
 	"built/struct/pair": {
 		Message: func(tok token.Token, args ...any) string {
 			return "Pipefish was expecting a pair, not something of type " + text.EmphType(args[0].(string))
@@ -272,6 +666,99 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"built/trig/domain": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't take " + emphText(args[0]) + " of " + emphText(args[1])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The inverse trigonometric functions 'asin' and 'acos' are only defined for numbers from -1 to 1 inclusive, " +
+				"since these are the only values that the sine and cosine of an angle can take."
+		},
+	},
+
+	"check/break/outside-loop": {
+		Message: func(tok token.Token, args ...any) string {
+			return "'" + tok.Literal + "' outside of a loop"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "'break' ends the 'loop' it's in, and 'continue' skips the rest of the current time round " +
+				"the loop, so it makes no sense to use either of them except in the body of a 'loop'.\n\nNote " +
+				"that a lambda defined inside a loop doesn't count as being inside it: it can't break out of the " +
+				"loop, since it might be called after the loop has finished."
+		},
+	},
+
+	"check/break/unknown-label": {
+		Message: func(tok token.Token, args ...any) string {
+			return "'" + tok.Literal + "' refers to label '" + args[0].(string) + "' which isn't on any enclosing loop"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You can label a loop by writing e.g. 'loop outer :' instead of 'loop :', and then 'break outer' " +
+				"or 'continue outer' inside it will break or continue that loop, rather than the innermost loop " +
+				"they're in. But the label has to belong to a loop that the 'break' or 'continue' is actually inside."
+		},
+	},
+
+	"check/deprecated": {
+		Message: func(tok token.Token, args ...any) string {
+			return "function " + emph(args[0].(string)) + " is deprecated: " + args[1].(string)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The author of " + emph(args[0].(string)) + " has marked it with '@deprecated', meaning that " +
+				"it may be removed in a later version, and left this message to say what to do instead."
+		},
+	},
+
+	"check/match/exhaustive": {
+		Message: func(tok token.Token, args ...any) string {
+			return "'match' on enum " + emph(args[0].(string)) + " has no arm for " + args[1].(string)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "When every pattern of a 'match' is an element of the same enum, Pipefish expects you either " +
+				"to give an arm for each element of the enum or to finish with an 'else' arm, so that the 'match' " +
+				"always has a value to return. If you add an element to an enum, this helps you find the places " +
+				"where you need to deal with it."
+		},
+	},
+
+	"check/overload/unreachable": {
+		Message: func(tok token.Token, args ...any) string {
+			return "overload " + emph(args[0].(string)+" "+args[1].(string)) + " can never be called"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "When a function is overloaded, Pipefish decides which version to call by looking at the types " +
+				"of the arguments one at a time, taking the first overload which they could fit. This overload " +
+				"is of no use because every set of arguments it would accept is already accepted by another " +
+				"overload which is tried before it.\n\nYou should either delete it, or change the types in its " +
+				"signature so that it is distinguishable from the others."
+		},
+	},
+
+	"check/purity": {
+		Message: func(tok token.Token, args ...any) string {
+			return "function '" + args[0].(string) + "' calls command '" + args[1].(string) + "'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Functions declared in the 'def' section are meant to be pure: given the same arguments, they " +
+				"return the same result and do nothing else. Commands, declared in the 'cmd' section, are allowed " +
+				"to have side effects, and so a function can't call a command without smuggling those side effects " +
+				"into the function.\n\nIf you need to do this, the thing you're writing should probably be a command " +
+				"too."
+		},
+	},
+
+	"check/purity/const": {
+		Message: func(tok token.Token, args ...any) string {
+			return "constant '" + args[0].(string) + "' is initialized by calling command '" + args[1].(string) + "'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Commands can return values, but since they're allowed to have side effects, the value " +
+				"they return needn't be the same each time they're called. It therefore makes no sense to " +
+				"use one to initialize a constant in the 'def' section.\n\nIf you need to do this, the thing " +
+				"you're initializing should probably be a variable in the 'var' section instead."
+		},
+	},
+
 	"err/misdirect": {
 		Message: func(tok token.Token, args ...any) string {
 			return "Pipefish is trying and failing to raise an error with reference '" + args[0].(string) + "'"
@@ -330,6 +817,17 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"eval/bool/chain": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't chain " + text.DescribeTok(tok) + " with other comparisons when it returns something of type " +
+				EmphType(args[0].(Object))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A chain of comparisons such as 'a < b < c' means 'a < b and b < c', and so each comparison " +
+				"in it must return a boolean value."
+		},
+	},
+
 	"eval/bool/iflog": {
 		Message: func(tok token.Token, args ...any) string {
 			return "can't apply " + emph(":") + " to things of type " + EmphType(args[0].(Object))
@@ -498,6 +996,15 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"eval/continue": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't 'continue' outside of a command"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The 'continue' keyword skips the rest of the current time round a loop started by 'loop'. As such loops are only permitted inside the 'cmd' section, 'continue' is meaningless outside of it."
+		},
+	},
+
 	"eval/enum/len": {
 		Message: func(tok token.Token, args ...any) string {
 			return "can't apply 'len' to type '" + args[0].(string) + "'"
@@ -526,47 +1033,24 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
-	"eval/eval": {
-		Message: func(tok token.Token, args ...any) string {
-			return "'eval' takes a string or code object as a parameter"
-		},
-		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
-			return "'eval' takes a string or code object as a parameter and returns the result of " +
-				"evaluating that string or code object as an " +
-				"expression in Pipefish: e.g. 'eval \"2 + 2\"' would return '4'."
-		},
-	},
-
-	"eval/filter/list": {
-		Message: func(tok token.Token, args ...any) string {
-			return "'?>' operates on a list, not an object of type " + EmphType(args[0].(Object))
-		},
-		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
-			return "the filter operator '?>' takes a list as its left-hand parameter, and" +
-				"on the right, and expression to filter by."
-		},
-	},
-
-	"eval/field/struct": {
+	"eval/eval": {
 		Message: func(tok token.Token, args ...any) string {
-			return "'" + args[0].(string) + " does not name a field of '" + args[1].(string) + "'."
+			return "'eval' takes a string or code object as a parameter"
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
-			return "You will see this error when you try to index a struct by a label which exists " +
-				"but doesn't label a field of that particular type of struct." +
-				"\n\nFor more information about structs see 'hub help \"structs\"'."
+			return "'eval' takes a string or code object as a parameter and returns the result of " +
+				"evaluating that string or code object as an " +
+				"expression in Pipefish: e.g. 'eval \"2 + 2\"' would return '4'."
 		},
 	},
 
-	"eval/field/type": {
+	"eval/filter/list": {
 		Message: func(tok token.Token, args ...any) string {
-			return "field '" + args[0].(string) + "' of variable '" + args[1].(string) +
-				"' should have type <" + args[2].(string) + ">, not " + EmphType(args[3].(Object))
+			return "'?>' operates on a list, not an object of type " + EmphType(args[0].(Object))
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
-			return "You will see this error when you try to assign a value to a field of a struct " +
-				"and the value is not compatible with the type of the field in the struct declaration." +
-				"\n\nFor more information about structs see 'hub help \"structs\"'."
+			return "the filter operator '?>' takes a list as its left-hand parameter, and" +
+				"on the right, and expression to filter by."
 		},
 	},
 
@@ -786,6 +1270,17 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"eval/match/none": {
+		Message: func(tok token.Token, args ...any) string {
+			return "no arm of 'match' fits the value of type " + EmphType(args[0].(Object))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A 'match' expression tries its patterns in order and returns the value of the first arm whose " +
+				"pattern is equal to the subject of the 'match', or is a type the subject belongs to. If none of " +
+				"them fit, then this is the error you get: you may want to finish the 'match' with an 'else' arm."
+		},
+	},
+
 	"eval/namespace/args": {
 		Message: func(tok token.Token, args ...any) string {
 			return "malformed namespace"
@@ -886,7 +1381,7 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 			return "index " + emphNum(args[0]) + " is out of bounds for a list of length " + emphNum(args[1])
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
-			return "A list is indexed from 0 up to but not including the length of the list."
+			return "A list is indexed from 0 up to but not including the length of the list. A negative index counts backwards from the end of the list, so that -1 is the last element."
 		},
 	},
 
@@ -895,7 +1390,7 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 			return "index " + emphNum(args[0]) + " is out of bounds for a pair"
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
-			return "A pair is indexed by 0 or 1."
+			return "A pair is indexed by 0 or 1, or by -2 or -1, which count backwards from the end of the pair."
 		},
 	},
 
@@ -904,7 +1399,7 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 			return "index " + emphNum(args[0]) + " is out of bounds for a string of length " + emphNum(args[1])
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
-			return "A string is indexed from 0 up to but not including the length of the string."
+			return "A string is indexed from 0 up to but not including the length of the string. A negative index counts backwards from the end of the string, so that -1 is the last character."
 		},
 	},
 
@@ -913,13 +1408,13 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 			return "index " + emphNum(args[0]) + " is out of bounds for a tuple of length " + emphNum(args[1])
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
-			return "A tuple is indexed from 0 up to but not including the arity of the tuple."
+			return "A tuple is indexed from 0 up to but not including the arity of the tuple. A negative index counts backwards from the end of the tuple, so that -1 is the last element."
 		},
 	},
 
 	"eval/range/slice/list": {
 		Message: func(tok token.Token, args ...any) string {
-			return "slice " + emph("["+strconv.Itoa(args[0].(int))+"::"+strconv.Itoa(args[1].(int))+"]") + " is out of bounds for a list of length " + emphNum(args[2])
+			return "slice " + emph(fmt.Sprintf("[%v::%v]", args[0], args[1])) + " is out of bounds for a list of length " + emphNum(args[2])
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
 			return "A slice has the form 'x[a::b]', where 'a' and 'b' are integers and a negative value of 'b' counts backwards from the end of the list to be sliced. The bounds of the slice are from-including-to-excluding, like everything else in Pipefish. The slice must lie entirely inside the list being sliced."
@@ -928,7 +1423,7 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 
 	"eval/range/slice/string": {
 		Message: func(tok token.Token, args ...any) string {
-			return "slice " + emph("["+strconv.Itoa(args[0].(int))+"::"+strconv.Itoa(args[1].(int))+"]") + " is out of bounds for a string of length " + emphNum(args[2])
+			return "slice " + emph(fmt.Sprintf("[%v::%v]", args[0], args[1])) + " is out of bounds for a string of length " + emphNum(args[2])
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
 			return "A slice has the form 'x[a::b]', where 'a' and 'b' are integers and a negative value of 'b' counts backwards from the end of the string to be sliced. The bounds of the slice are from-including-to-excluding, like everything else in Pipefish. The slice must lie entirely inside the string being sliced."
@@ -937,7 +1432,7 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 
 	"eval/range/slice/tuple": {
 		Message: func(tok token.Token, args ...any) string {
-			return "slice " + emph("["+strconv.Itoa(args[0].(int))+"::"+strconv.Itoa(args[1].(int))+"]") + " is out of bounds for a tuple of length " + emphNum(args[2])
+			return "slice " + emph(fmt.Sprintf("[%v::%v]", args[0], args[1])) + " is out of bounds for a tuple of length " + emphNum(args[2])
 		},
 		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
 			return "A slice has the form 'x[a::b]', where 'a' and 'b' are integers and a negative value of 'b' counts backwards from the end of the tuple to be sliced. The bounds of the slice are from-including-to-excluding, like everything else in Pipefish. The slice must lie entirely inside the tuple being sliced."
@@ -1146,6 +1641,50 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"eval/struct/field-type/a": {
+		Message: func(tok token.Token, args ...any) string {
+			return wrongFieldType(args...)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You will see this error when you construct a struct by giving the values of its fields in order, " +
+				"and one of them is not of the type given for the field in the struct declaration. " + fieldTypeAdvice
+		},
+	},
+
+	"eval/struct/field-type/b": {
+		Message: func(tok token.Token, args ...any) string {
+			return wrongFieldType(args...)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You will see this error when you construct a struct by giving its fields as pairs of labels and " +
+				"values, and one of the values is not of the type given for its field in the struct declaration. " +
+				fieldTypeAdvice
+		},
+	},
+
+	"eval/struct/missing-field": {
+		Message: func(tok token.Token, args ...any) string {
+			return "no value given for field " + emphText(args[0]) + " of struct type " + emphText(args[1])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "When you construct a struct by naming its fields, e.g. 'Point(x::1, y::2)' or " +
+				"'Point with x::1, y::2', you need to give a value for every field in the struct declaration." +
+				"\n\nFor more information about structs see 'hub help \"structs\"'."
+		},
+	},
+
+	"eval/struct/unknown-field": {
+		Message: func(tok token.Token, args ...any) string {
+			return emphText(args[0]) + " does not name a field of struct type " + emphText(args[1])
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You will see this error when you construct a struct by naming its fields, e.g. " +
+				"'Point(x::1, y::2)', and one of the labels you've used exists but doesn't label a field of that " +
+				"particular type of struct." +
+				"\n\nFor more information about structs see 'hub help \"structs\"'."
+		},
+	},
+
 	"eval/sv/exists": {
 		Message: func(tok token.Token, args ...any) string {
 			return "service variable " + emph(args[0].(string)) + " doesn't exist"
@@ -1385,6 +1924,16 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"eval/while/bool": {
+		Message: func(tok token.Token, args ...any) string {
+			return "condition of 'while' loop returned object of type " + EmphType(args[0].(Object)) + " rather than a boolean"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "In 'while p do f to z', the function 'p' is applied to the data 'z' to decide whether to go " +
+				"on looping, and so it must return 'true' or 'false'; Pipefish has no concept of \"truthiness\"."
+		},
+	},
+
 	"eval/with/type": {
 		Message: func(tok token.Token, args ...any) string {
 			return "attempting to initialize object of type <" + args[0].(string) + "> using 'with'"
@@ -1450,6 +1999,27 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"infer/args": {
+		Message: func(tok token.Token, args ...any) string {
+			return "no definition of " + emph(args[0].(string)) + " accepts arguments of type " + emph(args[1].(string))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "While working out the type of the expression, Pipefish found that none of the definitions of " +
+				emph(args[0].(string)) + " could accept the types of the arguments passed to it, and so evaluating " +
+				"the expression would fail."
+		},
+	},
+
+	"init/assign/compound": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't use " + emph(tok.Literal) + " to declare a constant or variable"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A compound assignment like 'x " + tok.Literal + " 1' updates a variable that already has a value, " +
+				"and so can only be used in a command or the REPL, not to declare a constant or a variable."
+		},
+	},
+
 	"init/close": {
 		Message: func(tok token.Token, args ...any) string {
 			return "'(' unclosed by outdent"
@@ -1501,6 +2071,18 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"init/const/self-reference": {
+		Message: func(tok token.Token, args ...any) string {
+			return "constant '" + args[0].(string) + "' is defined in terms of itself"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Pipefish initializes the constants in the 'def' section in whatever order is needed for each of " +
+				"them to be defined in terms of constants that already have values. But this can't be done if a " +
+				"constant is defined in terms of itself, either directly, as in 'x = x + 1', or indirectly, as in " +
+				"'x = y + 1' and 'y = x - 1', since then there's no order that would work."
+		},
+	},
+
 	"init/contacts/form": {
 		Message: func(tok token.Token, args ...any) string {
 			return "malformed entry in 'contacts' section"
@@ -1547,6 +2129,26 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"init/deprecated/form": {
+		Message: func(tok token.Token, args ...any) string {
+			return "malformed annotation"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "An annotation should be of the form '@deprecated \"<message>\"' on a line of its own, " +
+				"where the message says what to use instead."
+		},
+	},
+
+	"init/deprecated/target": {
+		Message: func(tok token.Token, args ...any) string {
+			return "'@deprecated' should be followed by a function or command"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Only functions and commands can be marked as deprecated, and so the line after a " +
+				"'@deprecated' annotation should declare one."
+		},
+	},
+
 	"init/enum/comma": {
 		Message: func(tok token.Token, args ...any) string {
 			return "expected comma, got " + text.DescribeTok(tok)
@@ -1560,6 +2162,17 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"init/enum/flags": {
+		Message: func(tok token.Token, args ...any) string {
+			return "flags type " + emph(args[0].(string)) + " has more than " + emphNum(MAX_FLAGS) + " elements"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Each element of a flags type needs a bit of its own in a machine word, and so a flags type can " +
+				"have at most " + emphNum(MAX_FLAGS) + " elements. If you don't need to combine the elements, you can " +
+				"declare the type as an 'enum' instead, which has no such limit."
+		},
+	},
+
 	"init/enum/free": {
 		Message: func(tok token.Token, args ...any) string {
 			return "element '" + tok.Literal + "' has already been declared"
@@ -1689,6 +2302,62 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"init/infix/builtin": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't declare the precedence of builtin operator " + emph(tok.Literal)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You can overload " + emph(tok.Literal) + " for your own types, but its precedence is fixed " +
+				"by Pipefish, since changing it would change the meaning of every expression it appears in."
+		},
+	},
+
+	"init/infix/conflict": {
+		Message: func(tok token.Token, args ...any) string {
+			return "conflicting declarations of the precedence of " + emph(tok.Literal)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You've declared the precedence of the infix " + emph(tok.Literal) + " more than once, with " +
+				"different levels or associativities. Pipefish can't know which one you mean."
+		},
+	},
+
+	"init/infix/form": {
+		Message: func(tok token.Token, args ...any) string {
+			return "malformed declaration of the precedence of an infix"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A declaration of the precedence of an infix should consist of 'infix', 'infixl' or 'infixr', " +
+				"followed by a level from 1 to 8, followed by the operator, e.g. 'infix 7 dot'. 'infix' and 'infixl' " +
+				"make the operator group from the left, and 'infixr' from the right."
+		},
+	},
+
+	"init/infix/infix": {
+		Message: func(tok token.Token, args ...any) string {
+			return "precedence declared for " + emph(tok.Literal) + ", which isn't an infix"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You've declared the precedence of " + emph(tok.Literal) + " but you haven't defined a function " +
+				"using it as an infix, e.g. '(x int) " + tok.Literal + " (y int) : <body>'."
+		},
+	},
+
+	"init/infix/level": {
+		Message: func(tok token.Token, args ...any) string {
+			return "precedence of an infix should be from 1 to 8, not " + emph(tok.Literal)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The levels you can declare for an infix are those of the builtin operators, from the loosest " +
+				"to the tightest binding:\n\n" +
+				"1 : 'or'\n2 : 'and'\n3 : '==' and '!='\n4 : '<', '<=', '>' and '>='\n" +
+				"5 : the default for your own infixes\n6 : '+' and '-'\n7 : '*', '/' and '%'\n" +
+				"8 : more tightly than '*'\n\nOperators of the same level are grouped from the left unless you " +
+				"declared them with 'infixr', in which case everything of the same level to the right of them is " +
+				"grouped together as their right-hand side."
+		},
+	},
+
 	"init/lang/assign": {
 		Message: func(tok token.Token, args ...any) string {
 			return "attempt to declare a variable or constant in the 'languages' section"
@@ -1716,6 +2385,35 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"init/newtype/exists": {
+		Message: func(tok token.Token, args ...any) string {
+			return "type " + emphText(tok.Literal) + " already exists"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You're declaring a new abstract type with 'newtype', but its name is already the name of a type."
+		},
+	},
+
+	"init/newtype/form": {
+		Message: func(tok token.Token, args ...any) string {
+			return "malformed 'newtype' declaration"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A 'newtype' declaration should consist of the name of the new type, then '=', then the types " +
+				"belonging to it separated by '/', e.g.\n\nnewtype Number = int/float64"
+		},
+	},
+
+	"init/newtype/type": {
+		Message: func(tok token.Token, args ...any) string {
+			return emphText(tok.Literal) + " isn't a type"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The members of a type declared with 'newtype' must themselves be types. They can be types " +
+				"declared in the same script, including by 'newtype' on an earlier line."
+		},
+	},
+
 	"init/overload": {
 		Message: func(tok token.Token, args ...any) string {
 			return "too much overloading of function '" + args[0].(string) + "'"
@@ -1734,6 +2432,8 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 				"this error because you've done something similar with your function/command/operator.\n\nIf this is something you've done deliberately, we would suggest that " +
 				"this is probably a bad practise anyway, which will tend to produce unreadable and unmaintainable code, " +
 				"and that you should try to do whatever it is you're doing some other way.\n\n" +
+				"The same goes for the builtin functions: you can overload e.g. 'string' or 'int' to convert a type " +
+				"of your own, but not for a type that the builtin function already accepts.\n\n" +
 				"For more information about overloading, see 'hub help \"overloading\"'; for a more basic introduction to functions " +
 				"see 'hub help \"functions\"'."
 		},
@@ -1752,6 +2452,27 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"init/sig/dup-param": {
+		Message: func(tok token.Token, args ...any) string {
+			return "parameter " + emph(args[0].(string)) + " appears more than once in the signature of " + emph(args[1].(string))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Each parameter of a function or command needs a name of its own, or Pipefish can't tell which " +
+				"argument you mean when you refer to " + emph(args[0].(string)) + " in the body."
+		},
+	},
+
+	"init/sig/shadow": {
+		Message: func(tok token.Token, args ...any) string {
+			return "parameter " + emph(args[0].(string)) + " of " + emph(args[1].(string)) + " has the same name as a global"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "This is only a warning, since it's legal, but it's probably not what you meant. In the body of " +
+				emph(args[1].(string)) + ", the name " + emph(args[0].(string)) + " will refer to the parameter, and " +
+				"so the global constant or variable of that name can't be seen there."
+		},
+	},
+
 	"init/source/open": {
 		Message: func(tok token.Token, args ...any) string {
 			return "unable to get source '" + args[0].(string) + "'"
@@ -1772,6 +2493,16 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"init/struct/dup-field": {
+		Message: func(tok token.Token, args ...any) string {
+			return "struct type " + emph(args[0].(string)) + " has more than one field called " + emph(args[1].(string))
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Each field of a struct needs a label of its own, or there'd be no way to say which of the fields " +
+				"called " + emph(args[1].(string)) + " you meant when you index the struct."
+		},
+	},
+
 	"init/unfinished": {
 		Message: func(tok token.Token, args ...any) string {
 			return "unfinished business at end of script"
@@ -1888,6 +2619,27 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"lex/escape": {
+		Message: func(tok token.Token, args ...any) string {
+			return "unknown escape sequence '\\" + string(args[0].(rune)) + "'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "In a string literal in double quotes, a backslash must be followed by one of 'n', 'r', 't', " +
+				"'\"', '\\', '{', or '}', or by 'u' and four hexadecimal digits. If you want a string in which " +
+				"backslashes stand for themselves, you can put it in backticks instead."
+		},
+	},
+
+	"lex/escape/u": {
+		Message: func(tok token.Token, args ...any) string {
+			return "'\\u' should be followed by four hexadecimal digits"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "In a string literal in double quotes, '\\u' introduces a Unicode character given by its " +
+				"code point as four hexadecimal digits, e.g. '\\u00e9' for 'é'."
+		},
+	},
+
 	"lex/gocode": {
 		Message: func(tok token.Token, args ...any) string {
 			return "no '{' after 'gocode"
@@ -1978,6 +2730,16 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"lex/quote/e": {
+		Message: func(tok token.Token, args ...any) string {
+			return "multiline string unterminated by end of file"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Having begun a string literal with three quotes, '\"\"\"', you haven't concluded it with three " +
+				"more quotes before the end of the file."
+		},
+	},
+
 	"lex/wsp": {
 		Message: func(tok token.Token, args ...any) string {
 			return "whitespace is inconsistent with previous indentation levels"
@@ -2000,6 +2762,39 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"init/var/self-reference": {
+		Message: func(tok token.Token, args ...any) string {
+			return "variable '" + args[0].(string) + "' is initialized in terms of itself"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "Pipefish initializes the variables in the 'var' section in whatever order is needed for each of " +
+				"them to be initialized in terms of things that already have values. But this can't be done if a " +
+				"variable is initialized in terms of itself, either directly, as in 'x = x + 1', or indirectly, as in " +
+				"'x = y + 1' and 'y = x - 1', since then there's no order that would work."
+		},
+	},
+
+	"parse/assign/compound": {
+		Message: func(tok token.Token, args ...any) string {
+			return "can't use " + emph(tok.Literal) + " here"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A compound assignment like 'x " + tok.Literal + " 1' updates a variable that already has a value, " +
+				"and so can only be used in a command or the REPL. In a function, a 'given' block, or a " +
+				"declaration, there's no such variable to update."
+		},
+	},
+
+	"parse/assign/ident": {
+		Message: func(tok token.Token, args ...any) string {
+			return "left-hand side of " + emph(tok.Literal) + " should be a single variable"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A compound assignment like 'x " + tok.Literal + " 1' updates one variable, so what's on the " +
+				"left of the " + emph(tok.Literal) + " should be the name of that variable."
+		},
+	},
+
 	"parse/before": {
 		Message: func(tok token.Token, args ...any) string {
 			return "can't put " + text.DescribeTok(tok) + " before " + text.DescribeTok(args[0].(token.Token))
@@ -2132,6 +2927,27 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"parse/match/arm": {
+		Message: func(tok token.Token, args ...any) string {
+			return "each arm of a 'match' should be of the form '<pattern> : <value>'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A 'match' expression should look like e.g.\n\n" +
+				"match x :\n    1 : \"one\"\n    int : \"some other integer\"\n    else : \"something else\"\n\n" +
+				"... but at least one of its arms isn't of that form."
+		},
+	},
+
+	"parse/match/colon": {
+		Message: func(tok token.Token, args ...any) string {
+			return "expected ':' after subject of 'match'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A 'match' expression should be written 'match <subject> :' followed by its arms, usually " +
+				"in an indented block."
+		},
+	},
+
 	"parse/missing": {
 		Message: func(tok token.Token, args ...any) string {
 			return "Pipefish expected an expression on either side of " + text.DescribeTok(tok)
@@ -2341,6 +3157,16 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"parse/sig/union": {
+		Message: func(tok token.Token, args ...any) string {
+			return "malformed union of types at " + text.DescribeTok(tok)
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "You can give a parameter or a field a union of types by separating the types with '/', " +
+				"e.g. 'x int/string', but Pipefish can't make a union of types out of what you've written here."
+		},
+	},
+
 	"parse/sig/varchar/int/a": {
 		Message: func(tok token.Token, args ...any) string {
 			return "expected integer literal, found " + text.DescribeTok(tok)
@@ -2359,6 +3185,28 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"parse/template/brace": {
+		Message: func(tok token.Token, args ...any) string {
+			return "unclosed '{' in string"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A '{' in a string literal begins an expression to be interpolated into the string, and this " +
+				"should be closed by a matching '}'. If you want the string to contain a '{' then you can escape " +
+				"it as '\\{'."
+		},
+	},
+
+	"parse/template/empty": {
+		Message: func(tok token.Token, args ...any) string {
+			return "empty '{}' in string"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A '{' in a string literal begins an expression to be interpolated into the string, but in this " +
+				"case there's no expression before the closing '}'. If you want the string to contain a '{' then " +
+				"you can escape it as '\\{'."
+		},
+	},
+
 	"parse/try/colon": {
 		Message: func(tok token.Token, args ...any) string {
 			return "found " + text.DescribeTok(tok) + " in 'try' expression"
@@ -2377,6 +3225,17 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 		},
 	},
 
+	"parse/when/colon": {
+		Message: func(tok token.Token, args ...any) string {
+			return "expected ':' after flag of 'when'"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "A 'when' block should be written 'when <flag> :' followed by the code to compile if the flag " +
+				"is set, e.g.\n\nwhen debug :\n    post \"debugging\"\n\nIf the flag isn't set the code is left out " +
+				"altogether."
+		},
+	},
+
 	"relex/indent": {
 		Message: func(tok token.Token, args ...any) string {
 			return "detatched indent"
@@ -2503,6 +3362,59 @@ var ErrorCreatorMap = map[string]ErrorCreator{
 			return "Only concrete subtypes of 'struct' can be converted to the signature of a SQL table."
 		},
 	},
+
+	"sys/floatdivision/bool": {
+		Message: func(tok token.Token, args ...any) string {
+			return "service variable '$floatDivision' must be a boolean"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "If the service variable '$floatDivision' is 'true', then dividing one integer by another with '/' " +
+				"returns a float, e.g. '5 / 2' is '2.5'. If it is 'false', which is the default, the result is an integer " +
+				"rounded towards zero, e.g. '5 / 2' is '2'. It can't be set to anything but 'true' or 'false'."
+		},
+	},
+
+	"sys/loglevel/string": {
+		Message: func(tok token.Token, args ...any) string {
+			return "service variable '$logLevel' must be a string"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The service variable '$logLevel' is the least important level at which the 'log' command writes " +
+				"anything, and must be one of \"debug\", \"info\", \"warn\" or \"error\"."
+		},
+	},
+
+	"sys/loglevel/vals": {
+		Message: func(tok token.Token, args ...any) string {
+			return "service variable '$logLevel' must be one of \"debug\", \"info\", \"warn\" or \"error\""
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The service variable '$logLevel' is the least important level at which the 'log' command writes " +
+				"anything: so for example if it is \"warn\" then only warnings and errors are logged."
+		},
+	},
+
+	"sys/maxelements/int": {
+		Message: func(tok token.Token, args ...any) string {
+			return "service variable '$maxElements' must be a non-negative integer"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "The service variable '$maxElements' says how many elements of a list, set, map or tuple the REPL " +
+				"will show before leaving the rest out, so that displaying a very large collection doesn't freeze the " +
+				"terminal. If it is '0' then nothing is left out. It can't be set to anything but a non-negative integer."
+		},
+	},
+
+	"sys/showtypes/bool": {
+		Message: func(tok token.Token, args ...any) string {
+			return "service variable '$showTypes' must be a boolean"
+		},
+		Explanation: func(errors Errors, pos int, tok token.Token, args ...any) string {
+			return "If the service variable '$showTypes' is 'true', then the REPL follows the value of each expression " +
+				"with the types it could have been inferred to have without evaluating it, e.g. '3 : int'. It can't be " +
+				"set to anything but 'true' or 'false'."
+		},
+	},
 }
 
 func blame(errors Errors, pos int, args ...string) string {
@@ -2526,10 +3438,21 @@ func emph(s string) string {
 	return "'" + s + "'"
 }
 
+// This takes any sort of Go integer, since a Pipefish int is an int64 but a length is an int.
 func emphNum(i any) string {
-	return "'" + (strconv.Itoa(i.(int))) + "'"
+	return fmt.Sprintf("'%v'", i)
+}
+
+// The message for when a field of a struct would be given a value of the wrong type, which is the same however it
+// happens. The arguments are the name of the field, the name of the struct type, the type of the field, and the value.
+func wrongFieldType(args ...any) string {
+	return "field " + emphText(args[0]) + " of struct type " + emphText(args[1]) +
+		" should have type <" + args[2].(string) + ">, not " + EmphType(args[3].(Object))
 }
 
+const fieldTypeAdvice = "If you want a field to be able to hold values of more than one type, you can declare it " +
+	"with a union of types, e.g. 'x int/string'.\n\nFor more information about structs see 'hub help \"structs\"'."
+
 func emphText(s any) string {
 	return "'" + s.(string) + "'"
 }
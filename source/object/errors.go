@@ -39,6 +39,14 @@ func GetList(ers Errors) string {
 	return result + "\n"
 }
 
+func GetWarningList(ers Errors) string {
+	result := "\n"
+	for i, v := range ers {
+		result = result + "[" + strconv.Itoa(i) + "] " + text.WARNING + (v.Message) + text.DescribePos(v.Token) + ".\n"
+	}
+	return result + "\n"
+}
+
 func AddErr(err *Error, ers Errors, tok token.Token) Errors {
 	for _, v := range ers {
 		if v.Token.Line == tok.Line && v.Token.ChStart == tok.ChStart {
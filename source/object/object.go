@@ -26,6 +26,7 @@ const (
 	BLING_OBJ       = "bling"
 	BOOLEAN_OBJ     = "bool"
 	BUILTIN_OBJ     = "BUILTIN"
+	CHANNEL_OBJ     = "channel"
 	ERROR_OBJ       = "error"
 	FLOAT_OBJ       = "float64"
 	FUNC_OBJ        = "func"
@@ -125,16 +126,20 @@ type BuiltError struct {
 // This allows the REPL to respond to the effectsin the following way:
 
 // * BreakHappened: we're breaking from a loop.
+// * ContinueHappened: we're skipping the rest of this iteration of a loop.
+// * Label: if we're breaking or continuing, the label of the loop we're doing it to, if it was given one.
 // * StopHappened: a `stop` token was encountered and we should close down the service.
 // * QuitHappened: used to convey the information that 'hub quit' was encountered.
 // * ElseSeeking : this was the effect of one branch of a conditional and we must skip the others.
 
 type Effects struct {
-	Elements      []Object
-	BreakHappened bool
-	StopHappened  bool
-	QuitHappened  bool
-	ElseSeeking   bool
+	Elements         []Object
+	BreakHappened    bool
+	ContinueHappened bool
+	StopHappened     bool
+	QuitHappened     bool
+	ElseSeeking      bool
+	Label            string
 }
 
 func (ef *Effects) DeepCopy() Object { return ef }
@@ -205,9 +210,9 @@ func (h *Hash) AddStringValuePair(s string, v Object) {
 	h.Pairs[hashKey] = HashPair{Key: str, Value: v}
 }
 
-// Charm 'int' wraps around Go 'int' and so is machine-dependent.
+// A Pipefish 'int' is 64 bits wide whatever the machine, and like a Go 'int64' it wraps around when it overflows.
 type Integer struct {
-	Value int
+	Value int64
 }
 
 func (i *Integer) DeepCopy() Object { return i }
@@ -223,8 +228,12 @@ type Label struct {
 	Value     string
 	Name      string
 	Namespace string
+	Bits      int // For the elements of a flags type, and combinations of them, the bits which are set.
 }
 
+// The number of elements a flags type can have, since each needs a bit of its own.
+const MAX_FLAGS = 62
+
 func (la *Label) DeepCopy() Object { return la }
 func (la *Label) Type() ObjectType { return LABEL_OBJ }
 func (la *Label) HashKey() HashKey {
@@ -267,6 +276,14 @@ func (lo *List) DeepSlice(start, end int) Object {
 }
 func (lo *List) Type() ObjectType { return LIST_OBJ }
 
+// A channel for sending values between things evaluated concurrently. Copying it gives the same channel.
+type Channel struct {
+	Value chan Object
+}
+
+func (ch *Channel) DeepCopy() Object { return ch }
+func (ch *Channel) Type() ObjectType { return CHANNEL_OBJ }
+
 // The null type.
 type Null struct{}
 
@@ -458,7 +475,7 @@ func Equals(lhs, rhs Object) bool {
 	if ConcreteType(lhs) != ConcreteType(rhs) {
 		return false
 	}
-	if lhs == rhs {
+	if lhs == rhs && lhs.Type() != FLOAT_OBJ { // Since NaN isn't equal to itself.
 		return true
 	}
 	switch lhs.Type() {
@@ -522,11 +539,33 @@ func Equals(lhs, rhs Object) bool {
 		return true
 	case PAIR_OBJ:
 		return Equals(lhs.(*Pair).Left, rhs.(*Pair).Left) && Equals(lhs.(*Pair).Right, rhs.(*Pair).Right)
+	case CHANNEL_OBJ:
+		return false // Since if they were the same channel we'd have found that out above.
 	default:
 		panic("You're trying to compare something for which == hasn't been implemented. Find out why and make it stop.")
 	}
 }
 
+// A negative index counts backwards from the end of a container of the given length, so that -1 is the last element.
+func FromEnd(idx int64, length int) int64 {
+	if idx < 0 {
+		return int64(length) + idx
+	}
+	return idx
+}
+
+func IsNumber(obj Object) bool {
+	return obj.Type() == INTEGER_OBJ || obj.Type() == FLOAT_OBJ
+}
+
+// This should only be called on something we know IsNumber.
+func AsFloat(obj Object) float64 {
+	if i, ok := obj.(*Integer); ok {
+		return float64(i.Value)
+	}
+	return obj.(*Float).Value
+}
+
 func MakeBool(input bool) *Boolean {
 	if input {
 		return TRUE
@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"fmt"
+	"math"
+	"sort"
 	"strconv"
+	"strings"
 
+	"pipefish/source/ast"
 	"pipefish/source/object"
 	"pipefish/source/token"
 )
@@ -25,6 +30,124 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		return returnList
 	},
 
+	// The entries of a collection are its keys or indices paired with their values.
+	"entries_of_map": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		returnList := &object.List{Elements: []object.Object{}}
+		for _, v := range args[0].(*object.Hash).Pairs {
+			returnList.Elements = append(returnList.Elements, &object.Pair{Left: v.Key, Right: v.Value})
+		}
+		return returnList
+	},
+
+	"entries_of_struct": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		returnList := &object.List{Elements: []object.Object{}}
+		for _, v := range args[0].(*object.Struct).Labels {
+			returnList.Elements = append(returnList.Elements, &object.Pair{Left: &object.Label{Value: v}, Right: args[0].(*object.Struct).Value[v]})
+		}
+		return returnList
+	},
+
+	"entries_of_list": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		returnList := &object.List{Elements: []object.Object{}}
+		for i, v := range args[0].(*object.List).Elements {
+			returnList.Elements = append(returnList.Elements, &object.Pair{Left: &object.Integer{Value: int64(i)}, Right: v})
+		}
+		return returnList
+	},
+
+	// Unlike indexing the map, this doesn't mind if the key isn't there, and can tell a key whose value is NULL from
+	// a missing one.
+	"has_key": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		key, ok := args[1].(object.Hashable)
+		if !ok {
+			return newError("built/map/hashable", tok, object.ConcreteType(args[1]))
+		}
+		_, ok = args[0].(*object.Hash).Pairs[key.HashKey()]
+		return object.MakeBool(ok)
+	},
+
+	// The inverse of 'entries', more or less: the map may be keyed by the labels of the fields or by their names as
+	// strings. Any other keys are ignored.
+	"struct_of": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		name := args[0].(*object.Type).Value
+		sig, ok := p.StructSig[name]
+		if !ok {
+			return newError("built/struct/of", tok, name)
+		}
+		pairs := args[1].(*object.Hash).Pairs
+		result := &object.Struct{Name: name, Labels: []string{}, Value: make(map[string]object.Object), Namespace: p.NamespacePath}
+		for _, field := range sig {
+			pair, ok := pairs[(&object.Label{Value: field.VarName}).HashKey()]
+			if !ok {
+				pair, ok = pairs[(&object.String{Value: field.VarName}).HashKey()]
+			}
+			if !ok {
+				return newError("built/struct/missing", tok, field.VarName, name)
+			}
+			if !IsObjectInType(p.TypeSystem, pair.Value, field.VarType) {
+				return newError("built/struct/field-type/c", tok, field.VarName, name, field.VarType, pair.Value)
+			}
+			result.Labels = append(result.Labels, field.VarName)
+			result.Value[field.VarName] = pair.Value
+		}
+		return result
+	},
+
+	"diff": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		changes := &object.List{Elements: []object.Object{}}
+		p.diff([]object.Object{}, args[0], args[1], changes)
+		return changes
+	},
+
+	// Structs are the same if they're of the same type and each of their fields are equal.
+	"same_fields": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		a, b := args[0].(*object.Struct), args[1].(*object.Struct)
+		if a.Name != b.Name || a.Namespace != b.Namespace {
+			return object.FALSE
+		}
+		for _, label := range a.Labels {
+			if !object.Equals(a.Value[label], b.Value[label]) {
+				return object.FALSE
+			}
+		}
+		return object.TRUE
+	},
+
+	// Collections, structs and functions are the same only if they're the very same object, which they can be when
+	// they've been passed around without being changed. For anything else identity is just equality.
+	"is_same": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		switch args[0].(type) {
+		case *object.List, *object.Set, *object.Hash, *object.Pair, *object.Struct, *object.Func, *object.Channel:
+			return object.MakeBool(args[0] == args[1])
+		}
+		return object.MakeBool(object.Equals(args[0], args[1]))
+	},
+
+	// Returns the declared return types of a function, or 'tuple' for an overload which doesn't declare them, since
+	// then it could return anything. For an overloaded function we return the union of the types of the overloads.
+	"return_type_of": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		var functions []ast.Function
+		switch f := args[0].(type) {
+		case *object.OuterFunc:
+			functions = p.FunctionTable[f.Name]
+		case *object.Func:
+			functions = []ast.Function{f.Function}
+		}
+		types := typeScheme{}
+		for _, f := range functions {
+			if len(f.Rets) == 0 {
+				types = append(types, []string{"tuple"})
+				continue
+			}
+			rets := []string{}
+			for _, ret := range f.Rets {
+				rets = append(rets, ret.VarType)
+			}
+			types = append(types, rets)
+		}
+		return &object.String{Value: types.String()}
+	},
+
 	"keys_of_type": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		sig, ok := p.StructSig[args[0].(*object.Type).Value]
 		if !ok {
@@ -37,6 +160,14 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		return &object.List{Elements: labels}
 	},
 
+	"subtypes": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return typeList(p.subtypes(args[0].(*object.Type).Value))
+	},
+
+	"supertypes": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return typeList(p.supertypes(args[0].(*object.Type).Value))
+	},
+
 	"range": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		index := args[0]
 		if !((index.(*object.Pair).Left.Type() == object.INTEGER_OBJ) && (index.(*object.Pair).Right.Type() == object.INTEGER_OBJ)) {
@@ -49,6 +180,124 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		return returnList
 	},
 
+	// We compute each element as lo + i * step rather than by repeated addition, so that floating-point error doesn't
+	// accumulate and give us one element too many or too few.
+	"range_with_step": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		index := args[0].(*object.Pair)
+		if !object.IsNumber(index.Left) || !object.IsNumber(index.Right) || !object.IsNumber(args[1]) {
+			return newErrorWithVals("built/range/step/type", tok, []object.Object{index, args[1]}, index.Left, index.Right, args[1])
+		}
+		returnList := &object.List{Elements: []object.Object{}}
+		if index.Left.Type() == object.INTEGER_OBJ && index.Right.Type() == object.INTEGER_OBJ && args[1].Type() == object.INTEGER_OBJ {
+			lo, hi, step := index.Left.(*object.Integer).Value, index.Right.(*object.Integer).Value, args[1].(*object.Integer).Value
+			if step == 0 {
+				return newError("built/range/step/zero", tok)
+			}
+			for i := lo; (step > 0 && i < hi) || (step < 0 && i > hi); i = i + step {
+				returnList.Elements = append(returnList.Elements, &object.Integer{Value: i})
+				if (step > 0 && i > math.MaxInt64-step) || (step < 0 && i < math.MinInt64-step) {
+					break // Since the next step would overflow, and so would take us past 'hi' anyway.
+				}
+			}
+			return returnList
+		}
+		lo, hi, step := object.AsFloat(index.Left), object.AsFloat(index.Right), object.AsFloat(args[1])
+		if step == 0 || math.IsNaN(step) {
+			return newError("built/range/step/zero", tok)
+		}
+		for i := 0; ; i++ {
+			x := lo + float64(i)*step
+			if !((step > 0 && x < hi) || (step < 0 && x > hi)) {
+				break
+			}
+			returnList.Elements = append(returnList.Elements, &object.Float{Value: x})
+		}
+		return returnList
+	},
+
+	// As with indexing, a negative index counts from the end of the list.
+	"get_or_else": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		elements := args[0].(*object.List).Elements
+		i := object.FromEnd(args[1].(*object.Integer).Value, len(elements))
+		if i < 0 || i >= int64(len(elements)) {
+			return args[2]
+		}
+		return elements[i]
+	},
+
+	"chunks": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		elements, size := args[0].(*object.List).Elements, args[1].(*object.Integer).Value
+		if size <= 0 {
+			return newError("built/chunks/size", tok, strconv.FormatInt(size, 10))
+		}
+		returnList := &object.List{Elements: []object.Object{}}
+		length := int64(len(elements))
+		for i := int64(0); i < length; i = i + size {
+			end := i + size
+			if end > length || end < i { // The second case is if it overflowed.
+				end = length
+			}
+			returnList.Elements = append(returnList.Elements, &object.List{Elements: append([]object.Object{}, elements[i:end]...)})
+		}
+		return returnList
+	},
+
+	"windows": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		elements, size := args[0].(*object.List).Elements, args[1].(*object.Integer).Value
+		if size <= 0 {
+			return newError("built/chunks/size", tok, strconv.FormatInt(size, 10))
+		}
+		returnList := &object.List{Elements: []object.Object{}}
+		for i := int64(0); i+size <= int64(len(elements)); i++ {
+			returnList.Elements = append(returnList.Elements, &object.List{Elements: append([]object.Object{}, elements[i:i+size]...)})
+		}
+		return returnList
+	},
+
+	"repeat_list": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		n := args[1].(*object.Integer).Value
+		if n < 0 {
+			return newError("built/repeat/count", tok, n)
+		}
+		returnList := &object.List{Elements: []object.Object{}} // We don't preallocate, since n needn't be sensible.
+		for i := int64(0); i < n; i++ {
+			returnList.Elements = append(returnList.Elements, args[0])
+		}
+		return returnList
+	},
+
+	"cycle": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		elements, n := args[0].(*object.List).Elements, args[1].(*object.Integer).Value
+		if n < 0 {
+			return newError("built/repeat/count", tok, n)
+		}
+		returnList := &object.List{Elements: []object.Object{}}
+		if len(elements) == 0 {
+			return returnList
+		}
+		for i := int64(0); i < n; i++ {
+			returnList.Elements = append(returnList.Elements, elements...)
+		}
+		return returnList
+	},
+
+	// The sublists are spliced in one level deep, and anything else is kept as it is.
+	"flatten_list": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		returnList := &object.List{Elements: []object.Object{}}
+		for _, element := range args[0].(*object.List).Elements {
+			if sublist, ok := element.(*object.List); ok {
+				returnList.Elements = append(returnList.Elements, sublist.Elements...)
+			} else {
+				returnList.Elements = append(returnList.Elements, element)
+			}
+		}
+		return returnList
+	},
+
+	"flatten_deep": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.List{Elements: flattenDeep(args[0].(*object.List).Elements, []object.Object{})}
+	},
+
 	"tuple_to_set": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		result := &object.Set{}
 		for _, v := range args[0].(*object.Tuple).Elements {
@@ -65,9 +314,22 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		return result
 	},
 
+	// For now the only thing we can turn a type into is the set of the elements of an enum.
+	"type_as_type": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		elements, ok := p.Enums[args[0].(*object.Type).Value]
+		if !ok || args[2].(*object.Type).Value != "set" {
+			return newError("built/as/type", tok, args[0].(*object.Type).Value, args[2].(*object.Type).Value)
+		}
+		result := &object.Set{}
+		for _, v := range elements {
+			result.AddElement(v)
+		}
+		return result
+	},
+
 	"len_of_type": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		if p.TypeSystem.PointsTo(args[0].(*object.Type).Value, "enum") {
-			return &object.Integer{Value: len(p.Enums[args[0].(*object.Type).Value])}
+			return &object.Integer{Value: int64(len(p.Enums[args[0].(*object.Type).Value]))}
 		} else {
 			return newError("eval/enum/len", tok)
 		}
@@ -78,7 +340,27 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 	},
 
 	"add_pair_to_struct": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		return addPairToStruct(tok, args...)
+		return p.checkStructFieldTypes(tok, addPairToStruct(tok, args...))
+	},
+
+	// This does the same as 'S with label::value', except that it only replaces existing fields, and is a function so
+	// that it can be passed a label which is only known at runtime.
+	"set_field": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		s := args[0].(*object.Struct)
+		label := args[1].(*object.Label).Value
+		if _, ok := s.Value[label]; !ok {
+			return newError("built/field/missing", tok, label, s.Name)
+		}
+		if prsr := p.ParserOfNamespace(s.Namespace); prsr != nil {
+			for _, field := range prsr.StructSig[s.Name] {
+				if field.VarName == label && !IsObjectInType(prsr.TypeSystem, args[2], field.VarType) {
+					return newError("built/struct/field-type/b", tok, label, s.Name, field.VarType, args[2])
+				}
+			}
+		}
+		result := s.DeepCopy().(*object.Struct)
+		result.Value[label] = args[2]
+		return result
 	},
 
 	"add_pair_to_map": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
@@ -90,7 +372,7 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 	},
 
 	"add_tuple_to_struct": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		return addTupleToStruct(tok, args...)
+		return p.checkStructFieldTypes(tok, addTupleToStruct(tok, args...))
 	},
 
 	"add_tuple_to_map": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
@@ -110,13 +392,33 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		if len(slice) != 1 {
 			return newError("built/codepoint", tok, len(slice))
 		}
-		return &object.Integer{Value: int(slice[0])}
+		return &object.Integer{Value: int64(slice[0])}
 	},
 
 	"charm_literal": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		return &object.String{Value: p.Serialize(args[0], LITERAL)}
 	},
 
+	"serialize": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		result, err := p.canonical(args[0], tok)
+		if err != nil {
+			return err
+		}
+		return &object.String{Value: result}
+	},
+
+	"deserialize": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return p.deserialize(args[0].(*object.String).Value, tok)
+	},
+
+	"format_source": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		result, err := FormatSource(args[0].(*object.String).Value)
+		if err != nil {
+			return newError(err.ErrorId, tok, err.Args...)
+		}
+		return &object.String{Value: result}
+	},
+
 	"single_in_list": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		for _, v := range args[2].(*object.List).Elements {
 			if object.Equals(args[0], v) {
@@ -229,9 +531,84 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		if args[2].(*object.Integer).Value == 0 {
 			return newError("built/div/int", tok)
 		}
+		if p.hasFloatDivision() {
+			return &object.Float{Value: float64(args[0].(*object.Integer).Value) / float64(args[2].(*object.Integer).Value)}
+		}
 		return &object.Integer{Value: args[0].(*object.Integer).Value / args[2].(*object.Integer).Value}
 	},
 
+	// This squares and multiplies rather than going through 'math.Pow', so that the result is exact until it overflows.
+	"power_of_integers": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		base, exponent := args[0].(*object.Integer).Value, args[2].(*object.Integer).Value
+		if exponent < 0 {
+			return newError("built/exp/neg", tok, exponent)
+		}
+		result := int64(1)
+		for ; exponent > 0; exponent = exponent / 2 {
+			if exponent%2 == 1 {
+				result = result * base
+			}
+			base = base * base
+		}
+		return &object.Integer{Value: result}
+	},
+
+	// Unlike '/' and '%', which truncate towards zero, these round the quotient down, so that the remainder has the
+	// same sign as the divisor.
+	"floor_divide_integers": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		x, y := args[0].(*object.Integer).Value, args[1].(*object.Integer).Value
+		if y == 0 {
+			return newError("built/floordiv/int", tok)
+		}
+		if x%y != 0 && (x < 0) != (y < 0) {
+			return &object.Integer{Value: x/y - 1}
+		}
+		return &object.Integer{Value: x / y}
+	},
+
+	"floor_modulo_integers": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		x, y := args[0].(*object.Integer).Value, args[1].(*object.Integer).Value
+		if y == 0 {
+			return newError("built/floormod/int", tok)
+		}
+		if x%y != 0 && (x < 0) != (y < 0) {
+			return &object.Integer{Value: x%y + y}
+		}
+		return &object.Integer{Value: x % y}
+	},
+
+	"sign_of_integer": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		switch x := args[0].(*object.Integer).Value; {
+		case x < 0:
+			return &object.Integer{Value: -1}
+		case x > 0:
+			return &object.Integer{Value: 1}
+		}
+		return &object.Integer{Value: 0}
+	},
+
+	"clamp_integers": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		x, lo, hi := args[0].(*object.Integer).Value, args[1].(*object.Integer).Value, args[2].(*object.Integer).Value
+		if lo > hi {
+			return newError("built/clamp/range", tok, p.Serialize(args[1], LITERAL), p.Serialize(args[2], LITERAL))
+		}
+		if x < lo {
+			return args[1]
+		}
+		if x > hi {
+			return args[2]
+		}
+		return args[0]
+	},
+
+	// The 'try_divide' functions return a pair of whether the division succeeded and the quotient, rather than an error.
+	"try_divide_integers": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		if args[1].(*object.Integer).Value == 0 {
+			return &object.Pair{Left: object.FALSE, Right: &object.Integer{Value: 0}}
+		}
+		return &object.Pair{Left: object.TRUE, Right: &object.Integer{Value: args[0].(*object.Integer).Value / args[1].(*object.Integer).Value}}
+	},
+
 	"< float64": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		if args[0].(*object.Float).Value < args[2].(*object.Float).Value {
 			return object.TRUE
@@ -280,24 +657,140 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		return &object.Float{Value: args[0].(*object.Float).Value / args[2].(*object.Float).Value}
 	},
 
+	"power_of_floats": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Float{Value: math.Pow(args[0].(*object.Float).Value, args[2].(*object.Float).Value)}
+	},
+
+	// Both positive and negative zero have sign 0, and NaN has no sign at all.
+	"sign_of_float": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		switch x := args[0].(*object.Float).Value; {
+		case math.IsNaN(x):
+			return newError("built/sign/nan", tok)
+		case x < 0:
+			return &object.Integer{Value: -1}
+		case x > 0:
+			return &object.Integer{Value: 1}
+		}
+		return &object.Integer{Value: 0}
+	},
+
+	"is_nan": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return object.MakeBool(math.IsNaN(args[0].(*object.Float).Value))
+	},
+
+	"is_inf": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return object.MakeBool(math.IsInf(args[0].(*object.Float).Value, 0))
+	},
+
+	"copysign": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Float{Value: math.Copysign(args[0].(*object.Float).Value, args[1].(*object.Float).Value)}
+	},
+
+	// The trigonometric and logarithmic functions.
+	"sin": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Float{Value: math.Sin(args[0].(*object.Float).Value)}
+	},
+
+	"cos": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Float{Value: math.Cos(args[0].(*object.Float).Value)}
+	},
+
+	"tan": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Float{Value: math.Tan(args[0].(*object.Float).Value)}
+	},
+
+	"asin": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		x := args[0].(*object.Float).Value
+		if x < -1 || x > 1 {
+			return newError("built/trig/domain", tok, "asin", p.Serialize(args[0], LITERAL))
+		}
+		return &object.Float{Value: math.Asin(x)}
+	},
+
+	"acos": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		x := args[0].(*object.Float).Value
+		if x < -1 || x > 1 {
+			return newError("built/trig/domain", tok, "acos", p.Serialize(args[0], LITERAL))
+		}
+		return &object.Float{Value: math.Acos(x)}
+	},
+
+	"atan": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Float{Value: math.Atan(args[0].(*object.Float).Value)}
+	},
+
+	"atan2": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Float{Value: math.Atan2(args[0].(*object.Float).Value, args[1].(*object.Float).Value)}
+	},
+
+	"exp": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Float{Value: math.Exp(args[0].(*object.Float).Value)}
+	},
+
+	"ln": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		x := args[0].(*object.Float).Value
+		if x <= 0 {
+			return newError("built/log/domain", tok, "ln", p.Serialize(args[0], LITERAL))
+		}
+		return &object.Float{Value: math.Log(x)}
+	},
+
+	"log10": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		x := args[0].(*object.Float).Value
+		if x <= 0 {
+			return newError("built/log/domain", tok, "log10", p.Serialize(args[0], LITERAL))
+		}
+		return &object.Float{Value: math.Log10(x)}
+	},
+
+	"clamp_floats": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		x, lo, hi := args[0].(*object.Float).Value, args[1].(*object.Float).Value, args[2].(*object.Float).Value
+		if lo > hi {
+			return newError("built/clamp/range", tok, p.Serialize(args[1], LITERAL), p.Serialize(args[2], LITERAL))
+		}
+		if x < lo {
+			return args[1]
+		}
+		if x > hi {
+			return args[2]
+		}
+		return args[0]
+	},
+
+	"lerp": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		a, b, t := args[0].(*object.Float).Value, args[1].(*object.Float).Value, args[2].(*object.Float).Value
+		return &object.Float{Value: a + (b-a)*t}
+	},
+
+	"try_divide_floats": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		if args[1].(*object.Float).Value == 0 {
+			return &object.Pair{Left: object.FALSE, Right: &object.Float{Value: 0}}
+		}
+		return &object.Pair{Left: object.TRUE, Right: &object.Float{Value: args[0].(*object.Float).Value / args[1].(*object.Float).Value}}
+	},
+
 	"len_list": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		return &object.Integer{Value: len(args[0].(*object.List).Elements)}
+		return &object.Integer{Value: int64(len(args[0].(*object.List).Elements))}
 	},
 
 	"len_set": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		return &object.Integer{Value: len(args[0].(*object.Set).Elements)}
+		return &object.Integer{Value: int64(len(args[0].(*object.Set).Elements))}
 	},
 
 	"len_map": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		return &object.Integer{Value: len(args[0].(*object.Hash).Pairs)}
+		return &object.Integer{Value: int64(len(args[0].(*object.Hash).Pairs))}
 	},
 
 	"len_string": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		return &object.Integer{Value: (len([]rune(args[0].(*object.String).Value)))}
+		return &object.Integer{Value: int64(len([]rune(args[0].(*object.String).Value)))}
+	},
+
+	"count_substrings": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Integer{Value: int64(strings.Count(args[0].(*object.String).Value, args[1].(*object.String).Value))}
 	},
 
 	"arity_tuple": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		return &object.Integer{Value: len(args[0].(*object.Tuple).Elements)}
+		return &object.Integer{Value: int64(len(args[0].(*object.Tuple).Elements))}
 	},
 
 	"tuple_to_string": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
@@ -311,7 +804,7 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 	},
 
 	"string_to_int": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		result, ok := strconv.Atoi(args[0].(*object.String).Value)
+		result, ok := strconv.ParseInt(args[0].(*object.String).Value, 10, 64)
 		if ok != nil {
 			return newError("built/int", tok, args[0].(*object.String).Value)
 		}
@@ -329,10 +822,35 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 	},
 
 	"float_to_int": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
-		result := int(args[0].(*object.Float).Value)
+		result := int64(args[0].(*object.Float).Value)
 		return &object.Integer{Value: result}
 	},
 
+	"cast": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		target := args[1].(*object.Type).Value
+		if !p.isConcreteType(target) {
+			return newError("built/cast/abstract", tok, target)
+		}
+		switch x := args[0].(type) {
+		case *object.Integer:
+			if target == "float64" {
+				return &object.Float{Value: float64(x.Value)}
+			}
+		case *object.Float:
+			if target == "int" {
+				// As a float64, math.MaxInt64 rounds up to 2^63. NaN fails both comparisons.
+				if !(x.Value >= math.MinInt64 && x.Value < math.MaxInt64) {
+					return newError("built/cast/range", tok, strconv.FormatFloat(x.Value, 'g', -1, 64))
+				}
+				return &object.Integer{Value: int64(x.Value)}
+			}
+		}
+		if object.ConcreteType(args[0]) == target {
+			return args[0]
+		}
+		return newError("built/cast/unsupported", tok, object.ConcreteType(args[0]), target)
+	},
+
 	"int_to_bool": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		if args[0].(*object.Integer).Value == 0 {
 			return object.FALSE
@@ -368,6 +886,10 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		return object.TRUE
 	},
 
+	"tuple_to_list": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.List{Elements: append([]object.Object{}, args[0].(*object.Tuple).Elements...)}
+	},
+
 	"spread_list": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		return &object.Tuple{Elements: args[0].(*object.List).Elements}
 	},
@@ -393,15 +915,88 @@ var Builtins = map[string]func(p *Parser, tok token.Token, args ...object.Object
 		return &object.Type{Value: object.ConcreteType(args[0])}
 	},
 
+	// Unlike 'type', this shows the tag the evaluator itself uses for the value, and the Go type it's stored in, e.g.
+	// a struct of type 'Person' gives "struct (*object.Struct)". It's meant for debugging Pipefish.
+	"debug_type": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.String{Value: fmt.Sprintf("%s (%T)", args[0].Type(), args[0])}
+	},
+
+	// The elements of a flags type can be combined with '|' and '&'. The result is a label of the same type with the
+	// bits of the elements it's made of.
+	"flags_or": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		f, g := args[0].(*object.Label), args[2].(*object.Label)
+		if f.Name != g.Name {
+			return newError("built/flags/mix", tok, f.Name, g.Name)
+		}
+		return p.makeFlags(f.Name, f.Namespace, f.Bits|g.Bits)
+	},
+
+	"flags_and": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		f, g := args[0].(*object.Label), args[2].(*object.Label)
+		if f.Name != g.Name {
+			return newError("built/flags/mix", tok, f.Name, g.Name)
+		}
+		return p.makeFlags(f.Name, f.Namespace, f.Bits&g.Bits)
+	},
+
+	// Says whether all the flags set in the second argument are set in the first.
+	"has_flag": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		f, g := args[0].(*object.Label), args[1].(*object.Label)
+		if f.Name != g.Name {
+			return newError("built/flags/mix", tok, f.Name, g.Name)
+		}
+		return object.MakeBool(f.Bits&g.Bits == g.Bits)
+	},
+
+	"no_flags": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		name := args[0].(*object.Type).Value
+		if !p.TypeSystem.PointsTo(name, "flags") {
+			return newError("built/flags/type", tok, name)
+		}
+		return p.makeFlags(name, p.NamespacePath, 0)
+	},
+
+	"flags_to_int": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		return &object.Integer{Value: int64(args[0].(*object.Label).Bits)}
+	},
+
 	"make_error": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
 		return &object.Error{ErrorId: "eval/user", Message: args[0].(*object.String).Value, Token: tok}
 	},
+
+	"new_channel": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		if args[0].(*object.Integer).Value < 0 {
+			return newError("built/channel/capacity", tok, args[0].(*object.Integer).Value)
+		}
+		return &object.Channel{Value: make(chan object.Object, args[0].(*object.Integer).Value)}
+	},
+
+	// Nothing else in the same evaluation could make room in a channel or put something in it, so rather than wait
+	// forever we return an error.
+	"send_to_channel": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		ch := args[0].(*object.Channel).Value
+		select {
+		case ch <- args[1]:
+			return object.SUCCESS
+		default:
+			return newError("built/channel/full", tok, cap(ch))
+		}
+	},
+
+	"receive_from_channel": func(p *Parser, tok token.Token, args ...object.Object) object.Object {
+		select {
+		case v := <-args[0].(*object.Channel).Value:
+			return v
+		default:
+			return newError("built/channel/empty", tok)
+		}
+	},
 }
 
 func evalArrayIndexExpression(array, index object.Object, tok token.Token) object.Object {
 	arrayObject := array.(*object.List)
 	idx := index.(*object.Integer).Value
-	max := len(arrayObject.Elements) - 1
+	max := int64(len(arrayObject.Elements)) - 1
 
 	if idx < 0 || idx > max {
 		return newError("built/range/list/b", tok, idx, len(arrayObject.Elements))
@@ -434,6 +1029,17 @@ func evalHashIndexExpression(hash, index object.Object, tok token.Token) object.
 	return pair.Value
 }
 
+func flattenDeep(elements, result []object.Object) []object.Object {
+	for _, element := range elements {
+		if sublist, ok := element.(*object.List); ok {
+			result = flattenDeep(sublist.Elements, result)
+		} else {
+			result = append(result, element)
+		}
+	}
+	return result
+}
+
 func tupleToMap(elements []object.Object, tok token.Token) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 	for _, v := range elements {
@@ -563,7 +1169,7 @@ func unsafeAddPairToList(tok token.Token, args ...object.Object) object.Object {
 	if index.(*object.Integer).Value < 0 {
 		return newError("built/list/neg", tok, index.(*object.Integer).Value < 0)
 	}
-	if index.(*object.Integer).Value >= len(args[0].(*object.List).Elements) {
+	if index.(*object.Integer).Value >= int64(len(args[0].(*object.List).Elements)) {
 		return newError("built/range/list/a", tok, index.(*object.Integer).Value, len(args[0].(*object.List).Elements))
 	}
 	newElements := []object.Object{}
@@ -572,6 +1178,77 @@ func unsafeAddPairToList(tok token.Token, args ...object.Object) object.Object {
 	return &object.List{Elements: newElements}
 }
 
+// If the service variable '$floatDivision' is set to 'true', dividing one integer by another returns a float
+// rather than truncating.
+func (p *Parser) hasFloatDivision() bool {
+	floatDivision, _ := p.AllGlobals.Get("$floatDivision")
+	return floatDivision == object.TRUE
+}
+
+// Returns the label of the given flags type with the given bits set. If only one bit is set, this is an element of
+// the type; otherwise it's named after the elements it's made of, e.g. 'READ | WRITE', so that it serializes as an
+// expression which would evaluate to it.
+func (p *Parser) makeFlags(name, namespace string, bits int) *object.Label {
+	elements := []string{}
+	for _, element := range p.Enums[name] {
+		if element.Bits == bits {
+			return element
+		}
+		if element.Bits&bits != 0 {
+			elements = append(elements, element.Value)
+		}
+	}
+	if len(elements) == 0 {
+		return &object.Label{Value: "no_flags " + name, Name: name, Namespace: namespace}
+	}
+	return &object.Label{Value: strings.Join(elements, " | "), Name: name, Namespace: namespace, Bits: bits}
+}
+
+// Since 'with' can change the fields of a struct, including those of structs inside it, we check afterwards
+// that the fields all still have the types the struct declarations say they should.
+func (p *Parser) checkStructFieldTypes(tok token.Token, obj object.Object) object.Object {
+	s, ok := obj.(*object.Struct)
+	if !ok {
+		return obj
+	}
+	prsr := p.ParserOfNamespace(s.Namespace)
+	if prsr == nil {
+		return obj
+	}
+	for _, field := range prsr.StructSig[s.Name] {
+		value, ok := s.Value[field.VarName]
+		if !ok {
+			continue
+		}
+		if !IsObjectInType(prsr.TypeSystem, value, field.VarType) {
+			return newError("built/struct/field-type/a", tok, field.VarName, s.Name, field.VarType, value)
+		}
+		if err := p.checkStructFieldTypes(tok, value); err.Type() == object.ERROR_OBJ {
+			return err
+		}
+	}
+	return obj
+}
+
+// The parser of the namespace with the given path, e.g. 'foo.bar.', which must be the parser's own or one below it,
+// or nil if there's no such namespace.
+func (p *Parser) ParserOfNamespace(namespacePath string) *Parser {
+	if !strings.HasPrefix(namespacePath, p.NamespacePath) {
+		return nil
+	}
+	q := p
+	path := strings.TrimPrefix(namespacePath, p.NamespacePath)
+	for path != "" {
+		namespace, rest, _ := strings.Cut(path, ".")
+		service, ok := q.NamespaceBranch[namespace]
+		if !ok {
+			return nil
+		}
+		q, path = service.Parser, rest
+	}
+	return q
+}
+
 func addPairToStruct(tok token.Token, args ...object.Object) object.Object {
 	args[0] = args[0].DeepCopy()
 	return unsafeAddPairToStruct(tok, args...)
@@ -627,7 +1304,7 @@ func unsafeAddPairToStruct(tok token.Token, args ...object.Object) object.Object
 		newValue[k] = v
 	}
 	newValue[index.(*object.Label).Value] = args[2].(*object.Pair).Right
-	return &object.Struct{Name: args[0].(*object.Struct).Name, Labels: args[0].(*object.Struct).Labels, Value: newValue}
+	return &object.Struct{Name: args[0].(*object.Struct).Name, Labels: args[0].(*object.Struct).Labels, Value: newValue, Namespace: args[0].(*object.Struct).Namespace}
 }
 
 func addPairToMap(tok token.Token, args ...object.Object) object.Object {
@@ -692,6 +1369,81 @@ func unsafeAddPairToMap(tok token.Token, args ...object.Object) object.Object {
 	return &object.Hash{Pairs: newMap}
 }
 
+// Adds to the list of changes the places where the two values differ, each as a pair path::(old::new) where the path
+// is the list of labels, keys and indices leading to it from the top. Where something is only in one of the values,
+// it's null in the other. Structs of the same type, maps, and lists are compared element by element; anything else
+// is just the same or a change.
+func (p *Parser) diff(path []object.Object, a, b object.Object, changes *object.List) {
+	change := func(key, a, b object.Object) {
+		p.diff(append(append([]object.Object{}, path...), key), a, b, changes)
+	}
+	switch {
+	case object.ConcreteType(a) != object.ConcreteType(b):
+	case a.Type() == object.STRUCT_OBJ:
+		for _, label := range a.(*object.Struct).Labels {
+			change(&object.Label{Value: label}, a.(*object.Struct).Value[label], b.(*object.Struct).Value[label])
+		}
+		return
+	case a.Type() == object.LIST_OBJ:
+		left, right := a.(*object.List).Elements, b.(*object.List).Elements
+		for i := 0; i < len(left) || i < len(right); i++ {
+			var x, y object.Object = object.NULL, object.NULL
+			if i < len(left) {
+				x = left[i]
+			}
+			if i < len(right) {
+				y = right[i]
+			}
+			change(&object.Integer{Value: int64(i)}, x, y)
+		}
+		return
+	case a.Type() == object.HASH_OBJ:
+		left, right := a.(*object.Hash).Pairs, b.(*object.Hash).Pairs
+		keys := []object.HashKey{}
+		for k := range left {
+			keys = append(keys, k)
+		}
+		for k := range right {
+			if _, ok := left[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		// So that the changes come in the same order each time.
+		describe := func(k object.HashKey) string {
+			if pair, ok := left[k]; ok {
+				return p.Serialize(pair.Key, LITERAL)
+			}
+			return p.Serialize(right[k].Key, LITERAL)
+		}
+		sort.Slice(keys, func(i, j int) bool { return describe(keys[i]) < describe(keys[j]) })
+		for _, k := range keys {
+			x, xOk := left[k]
+			y, yOk := right[k]
+			switch {
+			case !yOk:
+				change(x.Key, x.Value, object.NULL)
+			case !xOk:
+				change(y.Key, object.NULL, y.Value)
+			default:
+				change(x.Key, x.Value, y.Value)
+			}
+		}
+		return
+	case object.Equals(a, b):
+		return
+	}
+	changes.Elements = append(changes.Elements,
+		&object.Pair{Left: &object.List{Elements: path}, Right: &object.Pair{Left: a, Right: b}})
+}
+
+func typeList(names []string) *object.List {
+	types := []object.Object{}
+	for _, name := range names {
+		types = append(types, &object.Type{Value: name})
+	}
+	return &object.List{Elements: types}
+}
+
 func newError(ident string, tok token.Token, args ...any) *object.Error {
 	errorToReturn := object.CreateErr(ident, tok, args...)
 	errorToReturn.Trace = []token.Token{tok}
@@ -0,0 +1,444 @@
+package parser
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"pipefish/source/object"
+	"pipefish/source/signature"
+	"pipefish/source/text"
+	"pipefish/source/token"
+)
+
+// This supplies the `serialize` and `deserialize` builtins. Unlike the output of `literal`, the text `serialize`
+// produces is the same every time for equal values, so that it can be hashed or stored and compared: the elements
+// of sets and the keys of maps are sorted by their own serializations, and floats are written with as many digits as
+// it takes to read them back exactly. Except for NaN and the infinities, which Pipefish has no literals for, the
+// result is also a Pipefish expression which would evaluate to the value.
+//
+// We read it back ourselves rather than with the parser, so that `deserialize` can't be made to call functions:
+// it knows only the canonical forms and the names of the types, enum elements and struct fields of the service.
+
+func (p *Parser) canonical(ob object.Object, tok token.Token) (string, *object.Error) {
+	switch ob := ob.(type) {
+	case *object.Boolean, *object.Integer, *object.Null:
+		return p.Serialize(ob, LITERAL), nil
+	case *object.Float:
+		switch {
+		case math.IsNaN(ob.Value):
+			return "NaN", nil
+		case math.IsInf(ob.Value, 1):
+			return "Inf", nil
+		case math.IsInf(ob.Value, -1):
+			return "-Inf", nil
+		}
+		result := strconv.FormatFloat(ob.Value, 'f', -1, 64)
+		if !strings.Contains(result, ".") {
+			result = result + ".0"
+		}
+		return result, nil
+	case *object.String:
+		return text.ToEscapedText(ob.Value), nil
+	case *object.Label:
+		return ob.Namespace + ob.Value, nil
+	case *object.Type:
+		return ob.Value, nil
+	case *object.Pair:
+		left, err := p.canonical(ob.Left, tok)
+		if err != nil {
+			return "", err
+		}
+		right, err := p.canonical(ob.Right, tok)
+		if err != nil {
+			return "", err
+		}
+		if ob.Left.Type() == object.PAIR_OBJ {
+			left = "(" + left + ")"
+		}
+		if ob.Right.Type() == object.PAIR_OBJ {
+			right = "(" + right + ")"
+		}
+		return left + "::" + right, nil
+	case *object.List:
+		elements, err := p.canonicalElements(ob.Elements, false, tok)
+		return "[" + elements + "]", err
+	case *object.Set:
+		elements, err := p.canonicalElements(ob.Elements, true, tok)
+		return "set(" + elements + ")", err
+	case *object.Tuple:
+		elements, err := p.canonicalElements(ob.Elements, false, tok)
+		return "tuple(" + elements + ")", err
+	case *object.Hash:
+		pairs := []object.Object{}
+		for _, pair := range ob.Pairs {
+			pairs = append(pairs, &object.Pair{Left: pair.Key, Right: pair.Value})
+		}
+		elements, err := p.canonicalElements(pairs, true, tok)
+		return "map(" + elements + ")", err
+	case *object.Struct:
+		fields := []object.Object{}
+		for _, label := range ob.Labels {
+			fields = append(fields, &object.Pair{Left: &object.Label{Value: label}, Right: ob.Value[label]})
+		}
+		elements, err := p.canonicalElements(fields, false, tok)
+		return ob.Namespace + ob.Name + " with (" + elements + ")", err
+	}
+	return "", newError("built/serialize/type", tok, ob)
+}
+
+// Since a pair serializes as its key followed by '::', sorting the pairs of a map by their serializations sorts them
+// by their keys.
+func (p *Parser) canonicalElements(elements []object.Object, sorted bool, tok token.Token) (string, *object.Error) {
+	result := make([]string, 0, len(elements))
+	for _, element := range elements {
+		s, err := p.canonical(element, tok)
+		if err != nil {
+			return "", err
+		}
+		result = append(result, s)
+	}
+	if sorted {
+		sort.Strings(result)
+	}
+	return strings.Join(result, ", "), nil
+}
+
+type deserializer struct {
+	p   *Parser
+	src []rune
+	pos int
+	tok token.Token
+}
+
+func (p *Parser) deserialize(s string, tok token.Token) object.Object {
+	d := &deserializer{p: p, src: []rune(s), tok: tok}
+	result := d.value()
+	if result.Type() == object.ERROR_OBJ {
+		return result
+	}
+	if d.skipSpace(); d.pos < len(d.src) {
+		return d.fail("unexpected " + text.Emph(string(d.src[d.pos])))
+	}
+	return result
+}
+
+func (d *deserializer) fail(problem string) *object.Error {
+	return newError("built/deserialize", d.tok, problem, d.pos+1)
+}
+
+func (d *deserializer) skipSpace() {
+	for d.pos < len(d.src) && unicode.IsSpace(d.src[d.pos]) {
+		d.pos++
+	}
+}
+
+// Skips any whitespace and then the given text, if that's what comes next.
+func (d *deserializer) accept(s string) bool {
+	d.skipSpace()
+	if strings.HasPrefix(string(d.src[d.pos:]), s) {
+		d.pos = d.pos + len([]rune(s))
+		return true
+	}
+	return false
+}
+
+func (d *deserializer) expect(s string) *object.Error {
+	if !d.accept(s) {
+		return d.fail("expected " + text.Emph(s))
+	}
+	return nil
+}
+
+// A value is a term, or a pair of them. The terms of a pair are only pairs themselves if they're in parentheses.
+func (d *deserializer) value() object.Object {
+	left := d.term()
+	if left.Type() == object.ERROR_OBJ || !d.accept("::") {
+		return left
+	}
+	right := d.term()
+	if right.Type() == object.ERROR_OBJ {
+		return right
+	}
+	return &object.Pair{Left: left, Right: right}
+}
+
+func (d *deserializer) term() object.Object {
+	d.skipSpace()
+	if d.pos == len(d.src) {
+		return d.fail("unexpected end of string")
+	}
+	switch ch := d.src[d.pos]; {
+	case ch == '(':
+		d.pos++
+		result := d.value()
+		if result.Type() == object.ERROR_OBJ {
+			return result
+		}
+		if err := d.expect(")"); err != nil {
+			return err
+		}
+		return result
+	case ch == '[':
+		d.pos++
+		elements, err := d.elements("]")
+		if err != nil {
+			return err
+		}
+		return &object.List{Elements: elements}
+	case ch == '"':
+		return d.string()
+	case unicode.IsDigit(ch) || ch == '-':
+		return d.number()
+	case isIdentifierStart(ch):
+		return d.name()
+	}
+	return d.fail("unexpected " + text.Emph(string(d.src[d.pos])))
+}
+
+// Reads values separated by commas up to the closing bracket.
+func (d *deserializer) elements(closing string) ([]object.Object, *object.Error) {
+	result := []object.Object{}
+	if d.accept(closing) {
+		return result, nil
+	}
+	for {
+		element := d.value()
+		if element.Type() == object.ERROR_OBJ {
+			return nil, element.(*object.Error)
+		}
+		result = append(result, element)
+		if d.accept(closing) {
+			return result, nil
+		}
+		if err := d.expect(","); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *deserializer) string() object.Object {
+	var b strings.Builder
+	for d.pos++; d.pos < len(d.src); d.pos++ {
+		switch ch := d.src[d.pos]; ch {
+		case '"':
+			d.pos++
+			return &object.String{Value: b.String()}
+		case '\\':
+			d.pos++
+			if d.pos == len(d.src) {
+				return d.fail("unexpected end of string")
+			}
+			switch escaped := d.src[d.pos]; escaped {
+			case 'n':
+				b.WriteRune('\n')
+			case 'r':
+				b.WriteRune('\r')
+			case 't':
+				b.WriteRune('\t')
+			case 'u':
+				if d.pos+5 > len(d.src) {
+					return d.fail("unexpected end of string")
+				}
+				code, err := strconv.ParseUint(string(d.src[d.pos+1:d.pos+5]), 16, 32)
+				if err != nil {
+					return d.fail("malformed escape " + text.Emph("\\u"+string(d.src[d.pos+1:d.pos+5])))
+				}
+				b.WriteRune(rune(code))
+				d.pos = d.pos + 4
+			default:
+				b.WriteRune(escaped)
+			}
+		default:
+			b.WriteRune(ch)
+		}
+	}
+	return d.fail("unterminated string")
+}
+
+func (d *deserializer) number() object.Object {
+	start := d.pos
+	if d.src[d.pos] == '-' {
+		d.pos++
+		if d.accept("Inf") {
+			return &object.Float{Value: math.Inf(-1)}
+		}
+	}
+	for d.pos < len(d.src) && (unicode.IsDigit(d.src[d.pos]) || d.src[d.pos] == '.') {
+		d.pos++
+	}
+	literal := string(d.src[start:d.pos])
+	if strings.Contains(literal, ".") {
+		f, err := strconv.ParseFloat(literal, 64)
+		if err != nil {
+			d.pos = start
+			return d.fail("malformed number " + text.Emph(literal))
+		}
+		return &object.Float{Value: f}
+	}
+	i, err := strconv.ParseInt(literal, 10, 64)
+	if err != nil {
+		d.pos = start
+		return d.fail("malformed number " + text.Emph(literal))
+	}
+	return &object.Integer{Value: i}
+}
+
+// Reads an identifier, which may be qualified by a namespace, and returns it with the namespace split off.
+func (d *deserializer) identifier() (string, string) {
+	d.skipSpace()
+	start := d.pos
+	for d.pos < len(d.src) && (isIdentifierRune(d.src[d.pos]) || d.src[d.pos] == '.' || d.src[d.pos] == '?') {
+		d.pos++
+	}
+	name := string(d.src[start:d.pos])
+	dot := strings.LastIndex(name, ".")
+	return name[:dot+1], name[dot+1:]
+}
+
+func (d *deserializer) name() object.Object {
+	start := d.pos
+	namespace, name := d.identifier()
+	switch name {
+	case "NULL":
+		return object.NULL
+	case "true":
+		return object.TRUE
+	case "false":
+		return object.FALSE
+	case "NaN":
+		return &object.Float{Value: math.NaN()}
+	case "Inf":
+		return &object.Float{Value: math.Inf(1)}
+	case "set", "map", "tuple":
+		if !d.accept("(") {
+			break
+		}
+		elements, err := d.elements(")")
+		if err != nil {
+			return err
+		}
+		switch name {
+		case "set":
+			result := &object.Set{Elements: []object.Object{}}
+			for _, element := range elements {
+				if result.Contains(element) {
+					return d.fail("the set contains " + text.Emph(d.p.Serialize(element, LITERAL)) + " twice")
+				}
+				result.Elements = append(result.Elements, element)
+			}
+			return result
+		case "tuple":
+			return &object.Tuple{Elements: elements}
+		}
+		return d.hash(elements)
+	case "no_flags":
+		_, flagsType := d.identifier()
+		if _, ok := d.p.Enums[flagsType]; !ok {
+			d.pos = start
+			return d.fail("no flags type " + text.Emph(flagsType))
+		}
+		return d.p.makeFlags(flagsType, namespace, 0)
+	}
+	if sig, ok := d.p.StructSig[name]; ok && d.accept("with") {
+		return d.structure(namespace, name, sig)
+	}
+	if element := d.p.enumElement(namespace, name); element != nil {
+		bits := element.Bits
+		for element.Bits != 0 && d.accept("|") {
+			_, name := d.identifier()
+			other := d.p.enumElement(namespace, name)
+			if other == nil || other.Name != element.Name {
+				return d.fail(text.Emph(name) + " is not an element of " + text.Emph(element.Name))
+			}
+			bits = bits | other.Bits
+		}
+		if bits != element.Bits {
+			return d.p.makeFlags(element.Name, element.Namespace, bits)
+		}
+		return element
+	}
+	if TypeExists(name, d.p.TypeSystem) {
+		return &object.Type{Value: name}
+	}
+	for _, sig := range d.p.StructSig {
+		for _, field := range sig {
+			if field.VarName == name {
+				return &object.Label{Value: name, Name: "field"}
+			}
+		}
+	}
+	d.pos = start
+	return d.fail("unknown name " + text.Emph(namespace+name))
+}
+
+func (d *deserializer) hash(elements []object.Object) object.Object {
+	pairs := make(map[object.HashKey]object.HashPair)
+	for _, element := range elements {
+		pair, ok := element.(*object.Pair)
+		if !ok {
+			return d.fail("a map should contain only pairs")
+		}
+		key, ok := pair.Left.(object.Hashable)
+		if !ok {
+			return d.fail("can't use a value of type " + object.EmphType(pair.Left) + " as a map key")
+		}
+		if _, ok := pairs[key.HashKey()]; ok {
+			return d.fail("the map contains the key " + text.Emph(d.p.Serialize(pair.Left, LITERAL)) + " twice")
+		}
+		pairs[key.HashKey()] = object.HashPair{Key: pair.Left, Value: pair.Right}
+	}
+	return &object.Hash{Pairs: pairs}
+}
+
+func (d *deserializer) structure(namespace, name string, sig signature.Signature) object.Object {
+	if err := d.expect("("); err != nil {
+		return err
+	}
+	elements, err := d.elements(")")
+	if err != nil {
+		return err
+	}
+	values := map[string]object.Object{}
+	for _, element := range elements {
+		pair, ok := element.(*object.Pair)
+		if !ok || pair.Left.Type() != object.LABEL_OBJ {
+			return d.fail("the fields of a struct should be given as pairs of labels and values")
+		}
+		if _, ok := values[pair.Left.(*object.Label).Value]; ok {
+			return d.fail("the field " + text.Emph(pair.Left.(*object.Label).Value) + " is given twice")
+		}
+		values[pair.Left.(*object.Label).Value] = pair.Right
+	}
+	result := &object.Struct{Name: name, Labels: []string{}, Value: make(map[string]object.Object), Namespace: namespace}
+	for _, field := range sig {
+		value, ok := values[field.VarName]
+		if !ok {
+			return d.fail("no value for field " + text.Emph(field.VarName) + " of " + text.Emph(name))
+		}
+		if !IsObjectInType(d.p.TypeSystem, value, field.VarType) {
+			return d.fail("field " + text.Emph(field.VarName) + " of " + text.Emph(name) + " should have type " +
+				text.EmphType(field.VarType) + ", not " + object.EmphType(value))
+		}
+		result.Labels = append(result.Labels, field.VarName)
+		result.Value[field.VarName] = value
+	}
+	if len(values) != len(sig) {
+		return d.fail("too many fields for " + text.Emph(name))
+	}
+	return result
+}
+
+// The element of an enum or flags type with the given name, or nil if there isn't one.
+func (p *Parser) enumElement(namespace, name string) *object.Label {
+	for _, elements := range p.Enums {
+		for _, element := range elements {
+			if element.Value == name && element.Namespace == namespace {
+				return element
+			}
+		}
+	}
+	return nil
+}
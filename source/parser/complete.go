@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"pipefish/source/lexer"
+	"pipefish/source/object"
+	"pipefish/source/token"
+)
+
+// This supplies the identifiers which might complete what's being typed at a given point in some code, for the
+// benefit of editors. The global constants and variables, the enum elements and the labels of struct fields all
+// live in the service's environment, and we know the functions and types from the initializer. The local variables
+// have to be found from the code itself, since the code being edited needn't be what the service was initialized
+// from, nor even valid: we lex it and find the parameters and local assignments of the declaration the cursor is in.
+
+type CompletionKind int
+
+const (
+	FUNCTION_COMPLETION CompletionKind = iota
+	VARIABLE_COMPLETION
+	TYPE_COMPLETION
+	ELEMENT_COMPLETION // Of an enum.
+	LABEL_COMPLETION   // Of a struct field.
+)
+
+type Completion struct {
+	Name string
+	Kind CompletionKind
+}
+
+// The identifiers in scope at the cursor which start with whatever identifier the cursor is at the end of, sorted by
+// name. The position is an offset in bytes into the code.
+func (p *Parser) completions(code string, pos int, env *object.Environment) []Completion {
+	if pos < 0 || pos > len(code) {
+		return []Completion{}
+	}
+	start := strings.LastIndexFunc(code[:pos], func(r rune) bool { return !isIdentifierRune(r) }) + 1
+	prefix := code[start:pos]
+	found := map[Completion]bool{}
+	add := func(name string, kind CompletionKind) {
+		if strings.HasPrefix(name, prefix) && name != "" && isIdentifierStart([]rune(name)[0]) {
+			found[Completion{name, kind}] = true
+		}
+	}
+	for name, storage := range env.Store {
+		switch _, isEnum := p.Enums[storage.VarType]; {
+		case storage.VarType == "field":
+			add(name, LABEL_COMPLETION)
+		case isEnum:
+			add(name, ELEMENT_COMPLETION)
+		default:
+			add(name, VARIABLE_COMPLETION)
+		}
+	}
+	for name := range p.FunctionTable {
+		add(name, FUNCTION_COMPLETION)
+	}
+	for ty := range *p.TypeSystem {
+		if !strings.HasSuffix(ty, "?") && !strings.Contains(ty, "/") {
+			add(ty, TYPE_COMPLETION)
+		}
+	}
+	line := strings.Count(code[:start], "\n") + 1
+	column := utf8.RuneCountInString(code[strings.LastIndex(code[:start], "\n")+1 : start])
+	for _, tok := range p.localsAt(code, line) {
+		if !(tok.Line == line && tok.ChStart == column) { // Then it's not the identifier being typed.
+			add(tok.Literal, VARIABLE_COMPLETION)
+		}
+	}
+	result := make([]Completion, 0, len(found))
+	for completion := range found {
+		result = append(result, completion)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Name != result[j].Name {
+			return result[i].Name < result[j].Name
+		}
+		return result[i].Kind < result[j].Kind
+	})
+	return result
+}
+
+// The tokens declaring the parameters of the declaration which contains the given line, and the variables assigned
+// to in its body, which includes those in its 'given' block.
+func (p *Parser) localsAt(code string, line int) []token.Token {
+	l := lexer.New("completion", code)
+	declaration := []token.Token{}
+	level := 0
+	startsDeclaration := false
+tokens:
+	for tok := l.NextToken(); tok.Type != token.EOF; tok = l.NextToken() {
+		switch tok.Type {
+		case token.BEGIN:
+			level++
+		case token.END:
+			n, _ := strconv.Atoi(tok.Literal)
+			level = level - n
+			fallthrough
+		case token.NO_INDENT:
+			startsDeclaration = level == 0
+		case token.COMMENT, token.ILLEGAL:
+		case token.NEWLINE:
+			if !startsDeclaration { // Else it's a blank line.
+				declaration = append(declaration, tok)
+			}
+		default:
+			// A line with no indentation starts a new declaration, unless it's the 'given' block of the one before.
+			if startsDeclaration && tok.Type != token.GIVEN {
+				if tok.Line > line {
+					break tokens
+				}
+				declaration = []token.Token{}
+			}
+			startsDeclaration = false
+			declaration = append(declaration, tok)
+		}
+	}
+	locals := []token.Token{}
+	colon := -1
+	depth := 0
+	for i, tok := range declaration {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.ASSIGN, token.NEWLINE:
+			if depth == 0 && colon == -1 { // Then it's not a function or command.
+				return locals
+			}
+		case token.COLON:
+			if depth == 0 && colon == -1 {
+				colon = i
+			}
+		case token.IDENT:
+			if colon == -1 && depth > 0 && !TypeExists(strings.TrimSuffix(tok.Literal, "?"), p.TypeSystem) {
+				locals = append(locals, tok)
+			}
+		}
+		if colon != -1 {
+			break
+		}
+	}
+	for i := colon + 1; colon != -1 && i < len(declaration); i++ {
+		if declaration[i].Type != token.ASSIGN {
+			continue
+		}
+		// We go back over the variables being assigned to, e.g. in 'x, y = 1, 2'.
+		for j := i - 1; j > colon && declaration[j].Type == token.IDENT; j = j - 2 {
+			locals = append(locals, declaration[j])
+			if j == 0 || declaration[j-1].Type != token.COMMA {
+				break
+			}
+		}
+	}
+	return locals
+}
+
+func isIdentifierStart(r rune) bool {
+	return unicode.IsLetter(r) || r == '_' || r == '$'
+}
+
+func isIdentifierRune(r rune) bool {
+	return isIdentifierStart(r) || unicode.IsDigit(r)
+}
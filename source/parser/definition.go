@@ -0,0 +1,165 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+
+	"pipefish/source/lexer"
+	"pipefish/source/token"
+)
+
+// This finds where the identifier at a given point in some code was declared, for the benefit of editors. As with
+// completions, the code needn't be valid. We look first among the local variables of the declaration the identifier
+// is in, then at what the code declares at the top level, and finally, for a function declared somewhere else,
+// such as in the builtins, at the bodies of the functions in the function table.
+
+// The token declaring the identifier at the given byte offset into the code, if we can find one.
+func (p *Parser) definition(code string, pos int) (token.Token, bool) {
+	if pos < 0 || pos > len(code) {
+		return token.Token{}, false
+	}
+	start := strings.LastIndexFunc(code[:pos], func(r rune) bool { return !isIdentifierRune(r) }) + 1
+	end := strings.IndexFunc(code[pos:], func(r rune) bool { return !isIdentifierRune(r) })
+	if end == -1 {
+		end = len(code)
+	} else {
+		end = pos + end
+	}
+	name := code[start:end]
+	if name == "" {
+		return token.Token{}, false
+	}
+	line := strings.Count(code[:start], "\n") + 1
+	for _, tok := range p.localsAt(code, line) {
+		if tok.Literal == name {
+			return tok, true
+		}
+	}
+	for _, tok := range p.topLevelDeclarations(code) {
+		if tok.Literal == name {
+			return tok, true
+		}
+	}
+	for _, f := range p.FunctionTable[name] {
+		if tok := f.Body.GetToken(); tok.Source != "" { // Else it's implemented in Go and has nowhere to point to.
+			return tok, true
+		}
+	}
+	return token.Token{}, false
+}
+
+// The tokens naming the things the code declares at the top level: functions and commands, global constants and
+// variables, types, and the elements of enums and the fields of structs. Where a function is overloaded we find each
+// of its declarations, in order.
+func (p *Parser) topLevelDeclarations(code string) []token.Token {
+	l := lexer.New("definition", code)
+	result := []token.Token{}
+	line := []token.Token{} // The unindented line we're on, which is where the declaring happens.
+	level := 0
+	for tok := l.NextToken(); ; tok = l.NextToken() {
+		switch tok.Type {
+		case token.BEGIN:
+			level++
+		case token.END:
+			n, _ := strconv.Atoi(tok.Literal)
+			level = level - n
+		case token.COMMENT, token.ILLEGAL, token.NO_INDENT:
+		case token.NEWLINE, token.EOF:
+			if level == 0 {
+				result = append(result, p.declaredBy(line)...)
+				line = []token.Token{}
+			}
+			if tok.Type == token.EOF {
+				return result
+			}
+		default:
+			if level == 0 {
+				line = append(line, tok)
+			}
+		}
+	}
+}
+
+// The tokens naming whatever is declared by an unindented line of code, if anything.
+func (p *Parser) declaredBy(line []token.Token) []token.Token {
+	if len(line) > 2 && line[0].Literal == "newtype" && line[2].Type == token.ASSIGN {
+		line = line[1:] // So that the first identifier is the name of the type.
+	}
+	depth := 0
+	for i, tok := range line {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.COLON:
+			if depth == 0 { // Then it's a function or command, named by its first identifier outside of parentheses.
+				if names := identifiersAtDepthZero(line[:i]); len(names) > 0 {
+					return names[:1]
+				}
+				return nil
+			}
+		case token.ASSIGN:
+			if depth == 0 {
+				return p.assignedBy(line, i)
+			}
+		}
+	}
+	return nil
+}
+
+// The tokens naming what's declared by an unindented assignment: either global constants or variables, or a type
+// together with the elements of the enum or the fields of the struct.
+func (p *Parser) assignedBy(line []token.Token, assign int) []token.Token {
+	result := []token.Token{}
+	for i, tok := range identifiersAtDepthZero(line[:assign]) {
+		if i == 0 || !TypeExists(strings.TrimSuffix(tok.Literal, "?"), p.TypeSystem) { // Else it says what type the last one is.
+			result = append(result, tok)
+		}
+	}
+	if assign+1 == len(line) || len(result) != 1 {
+		return result
+	}
+	switch line[assign+1].Literal {
+	case "enum", "flags":
+		for _, tok := range line[assign+2:] {
+			if tok.Type == token.IDENT {
+				result = append(result, tok)
+			}
+		}
+	case "struct":
+		depth := 0
+		for i, tok := range line[assign+2:] {
+			switch tok.Type {
+			case token.LPAREN, token.LBRACK, token.LBRACE:
+				depth++
+			case token.RPAREN, token.RBRACK, token.RBRACE:
+				depth--
+			case token.IDENT:
+				previous := line[assign+1+i]
+				if depth == 1 && (previous.Type == token.LPAREN || previous.Type == token.COMMA) {
+					result = append(result, tok)
+				}
+			}
+		}
+	}
+	return result
+}
+
+func identifiersAtDepthZero(toks []token.Token) []token.Token {
+	result := []token.Token{}
+	depth := 0
+	for _, tok := range toks {
+		switch tok.Type {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			depth++
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			depth--
+		case token.IDENT:
+			if depth == 0 {
+				result = append(result, tok)
+			}
+		}
+	}
+	return result
+}
@@ -0,0 +1,318 @@
+package parser
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"pipefish/source/lexer"
+	"pipefish/source/object"
+	"pipefish/source/text"
+	"pipefish/source/token"
+)
+
+// This re-emits Pipefish source in a canonical layout, for the benefit of editors and of the `format_source`
+// builtin. We work from the lexer's tokens rather than from the AST, because the AST has forgotten the comments and
+// the line breaks, and the relexer throws away the comments and the indentation we're trying to reproduce.
+//
+// The rules are: four spaces of indentation per level; one space between tokens, except inside brackets, before
+// commas and semicolons, around namespace dots and around `::`; a space after commas; continuation lines lined up
+// with the bracket they continue; the fields of a struct declared one per line lined up with one another; at most
+// one blank line in a row. Whether or not there's a space before a bracket or after a prefix `-` is kept as it was,
+// since `f(x)` and `f (x)`, or `x -1` and `x - 1`, aren't necessarily the same thing.
+//
+// It's meant for one declaration at a time, and doesn't yet know what to do with `gocode` or with snippets.
+
+// A line of source as the lexer sees it: any continuations have been joined on.
+type formatLine struct {
+	level   int
+	toks    []token.Token
+	comment *token.Token
+}
+
+// FormatSource returns the source in canonical form, or an error whose token is positioned in the source.
+func FormatSource(source string) (string, *object.Error) {
+	lines, err := splitIntoFormatLines(source)
+	if err != nil {
+		return "", err
+	}
+	sourceLines := strings.Split(source, "\n")
+	var out strings.Builder
+	blank := false
+	for _, line := range lines {
+		if len(line.toks) == 0 && line.comment == nil {
+			blank = out.Len() > 0
+			continue
+		}
+		if blank {
+			out.WriteString("\n")
+			blank = false
+		}
+		indent := strings.Repeat("    ", line.level)
+		out.WriteString(indent)
+		if len(line.toks) > 0 {
+			out.WriteString(formatTokens(line.toks, indent, sourceLines))
+			if line.comment != nil {
+				out.WriteString(" ")
+			}
+		}
+		if line.comment != nil {
+			out.WriteString("//" + strings.TrimRight(line.comment.Literal, " \t\r"))
+		}
+		out.WriteString("\n")
+	}
+	return out.String(), nil
+}
+
+func splitIntoFormatLines(source string) ([]*formatLine, *object.Error) {
+	l := lexer.New("format_source", source)
+	lines := []*formatLine{}
+	current := &formatLine{level: -1}
+	level := 0
+	for tok := l.NextToken(); ; tok = l.NextToken() {
+		switch tok.Type {
+		case token.BEGIN:
+			level++
+		case token.END:
+			n, _ := strconv.Atoi(tok.Literal)
+			level = level - n
+		case token.NO_INDENT, token.ILLEGAL:
+		case token.GOLANG:
+			return nil, newError("built/format/gocode", tok, tok.Line)
+		case token.EMDASH:
+			return nil, newError("built/format/snippet", tok, tok.Line)
+		case token.COMMENT:
+			comment := tok
+			current.comment = &comment
+		case token.NEWLINE, token.EOF:
+			lines = append(lines, current)
+			current = &formatLine{level: -1}
+		default:
+			current.level = level
+			current.toks = append(current.toks, tok)
+		}
+		if tok.Type == token.EOF {
+			break
+		}
+	}
+	if len(l.Ers) > 0 {
+		return nil, newError("built/format/lex", l.Ers[0].Token, l.Ers[0].Message, l.Ers[0].Token.Line)
+	}
+	// The lexer tells us about a change of indentation at the first line that has code on it, so a comment on a line
+	// of its own goes at the level of the code that follows it; or if there isn't any, of the code before it.
+	next := -1
+	for i := len(lines) - 1; i >= 0; i-- {
+		if lines[i].level == -1 {
+			lines[i].level = next
+		} else {
+			next = lines[i].level
+		}
+	}
+	previous := 0
+	for _, line := range lines {
+		if line.level == -1 {
+			line.level = previous
+		} else {
+			previous = line.level
+		}
+	}
+	return lines, nil
+}
+
+func formatTokens(toks []token.Token, indent string, sourceLines []string) string {
+	padding := structPadding(toks)
+	var b strings.Builder
+	b.WriteString(indent)
+	lineStart := 0
+	brackets := []int{} // The columns just after the brackets that are still open.
+	for i, tok := range toks {
+		if isContinuation(toks, i) {
+			if tok.Type == token.COMMA {
+				b.WriteString(",")
+			} else {
+				b.WriteString(" ..")
+			}
+			column := len(indent) + 7
+			if len(brackets) > 0 && brackets[len(brackets)-1] >= len(indent)+3 {
+				column = brackets[len(brackets)-1]
+			}
+			b.WriteString("\n" + strings.Repeat(" ", column-3) + ".. ")
+			lineStart = b.Len() - column
+			continue
+		}
+		if i > 0 && !isContinuation(toks, i-1) && spaceBetween(toks, i, sourceLines) {
+			b.WriteString(" ")
+		}
+		literal := tokenText(tok, sourceLines)
+		b.WriteString(literal)
+		if width, ok := padding[i]; ok {
+			b.WriteString(strings.Repeat(" ", width-len([]rune(literal))))
+		}
+		switch tok.Type {
+		case token.LPAREN, token.LBRACK, token.LBRACE:
+			brackets = append(brackets, len([]rune(b.String()[lineStart:])))
+		case token.RPAREN, token.RBRACK, token.RBRACE:
+			if len(brackets) > 0 {
+				brackets = brackets[:len(brackets)-1]
+			}
+		}
+	}
+	return b.String()[len(indent):]
+}
+
+// Whether the token is a comma or `..` that ends a line which is continued on the next.
+func isContinuation(toks []token.Token, i int) bool {
+	return i > 0 && (toks[i].Type == token.COMMA || toks[i].Type == token.DOTDOT) && toks[i].Line > toks[i-1].Line
+}
+
+func spaceBetween(toks []token.Token, i int, sourceLines []string) bool {
+	prev, next := toks[i-1], toks[i]
+	switch {
+	case prev.Type == token.LPAREN || prev.Type == token.LBRACK || prev.Type == token.LBRACE:
+		return false
+	case next.Type == token.RPAREN || next.Type == token.RBRACK || next.Type == token.RBRACE:
+		return false
+	case next.Type == token.COMMA || next.Type == token.SEMICOLON:
+		return false
+	case prev.Type == token.NAMESPACE || next.Type == token.NAMESPACE:
+		return false
+	case prev.Literal == "::" && prev.Type == token.IDENT || next.Literal == "::" && next.Type == token.IDENT:
+		return false
+	case prev.Type == token.COMMA || prev.Type == token.SEMICOLON:
+		return true
+	case next.Type == token.LPAREN || next.Type == token.LBRACK || next.Type == token.LBRACE:
+		return spacedBefore(next, sourceLines)
+	case prev.Type == token.IDENT && prev.Literal == "-" && !spacedBefore(next, sourceLines):
+		// Then it's a prefix minus unless it's stuck to a value on its left, as in `x-1`.
+		return i > 1 && endsValue(toks[i-2]) && !spacedBefore(prev, sourceLines)
+	}
+	return true
+}
+
+// Whether there's whitespace in the source just before the token, or it starts a line.
+func spacedBefore(tok token.Token, sourceLines []string) bool {
+	if tok.Line < 1 || tok.Line > len(sourceLines) {
+		return true
+	}
+	line := []rune(sourceLines[tok.Line-1])
+	if tok.ChStart < 1 || tok.ChStart > len(line) {
+		return true
+	}
+	return unicode.IsSpace(line[tok.ChStart-1])
+}
+
+func endsValue(tok token.Token) bool {
+	switch tok.Type {
+	case token.INT, token.FLOAT, token.STRING, token.TEMPLATE, token.TRUE, token.FALSE,
+		token.RPAREN, token.RBRACK, token.RBRACE:
+		return true
+	case token.IDENT:
+		for _, first := range tok.Literal {
+			return unicode.IsLetter(first) || first == '_'
+		}
+	}
+	return false
+}
+
+// The lexer has turned string and number literals into their values, so where we can we go back to the source to
+// find out how they were written.
+func tokenText(tok token.Token, sourceLines []string) string {
+	var written []rune
+	if tok.Line >= 1 && tok.Line <= len(sourceLines) {
+		line := []rune(sourceLines[tok.Line-1])
+		if tok.ChStart >= 0 && tok.ChStart < len(line) {
+			written = line[tok.ChStart:]
+		}
+	}
+	switch tok.Type {
+	case token.STRING:
+		if len(written) > 0 && written[0] == '`' {
+			return "`" + tok.Literal + "`"
+		}
+		return text.ToEscapedText(tok.Literal)
+	case token.TEMPLATE:
+		return "\"" + escapeTemplate(tok.Literal) + "\""
+	case token.INT, token.FLOAT:
+		end := 0
+		for end < len(written) && (unicode.IsLetter(written[end]) || unicode.IsDigit(written[end]) ||
+			written[end] == '.' && end+1 < len(written) && unicode.IsDigit(written[end+1])) {
+			end++
+		}
+		if end > 0 {
+			return string(written[:end])
+		}
+	case token.LOG:
+		return "\\\\ " + tok.Literal
+	}
+	return tok.Literal
+}
+
+// The literal of a template still has its escapes in it, but if it was written between triple quotes then it may
+// also contain newlines and unescaped quotes, which we must escape to put it between single quotes.
+func escapeTemplate(literal string) string {
+	var out strings.Builder
+	escape := false
+	for _, ch := range literal {
+		switch {
+		case ch == '\n':
+			out.WriteString("\\n")
+		case ch == '\r':
+			out.WriteString("\\r")
+		case ch == '"' && !escape:
+			out.WriteString("\\\"")
+		default:
+			out.WriteRune(ch)
+		}
+		escape = ch == '\\' && !escape
+	}
+	return out.String()
+}
+
+// If a struct is declared with one field to a line, then we pad the names of the fields so that their types line up.
+// This returns the widths to pad to, keyed by the indices of the names.
+func structPadding(toks []token.Token) map[int]int {
+	padding := map[int]int{}
+	for i := 0; i+1 < len(toks); i++ {
+		if !(toks[i].Type == token.IDENT && toks[i].Literal == "struct" && toks[i+1].Type == token.LPAREN) {
+			continue
+		}
+		names := []int{i + 2}
+		onePerLine := true
+		depth := 0
+	fields:
+		for j := i + 1; j < len(toks); j++ {
+			switch toks[j].Type {
+			case token.LPAREN, token.LBRACK, token.LBRACE:
+				depth++
+			case token.RPAREN, token.RBRACK, token.RBRACE:
+				depth--
+				if depth == 0 {
+					names = append(names, j+1) // So that we can check the length of the last field.
+					break fields
+				}
+			case token.COMMA:
+				if depth == 1 {
+					onePerLine = onePerLine && isContinuation(toks, j)
+					names = append(names, j+1)
+				}
+			}
+		}
+		if len(names) < 3 || !onePerLine {
+			continue
+		}
+		width := 0
+		for k := 0; k+1 < len(names); k++ {
+			if names[k+1]-names[k] < 3 { // Then there's only a name in the field and no type.
+				width = 0
+				break
+			}
+			if len([]rune(toks[names[k]].Literal)) > width {
+				width = len([]rune(toks[names[k]].Literal))
+			}
+		}
+		for k := 0; width > 0 && k+1 < len(names); k++ {
+			padding[names[k]] = width
+		}
+	}
+	return padding
+}
@@ -0,0 +1,65 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Each file 'foo.pf' in the directory is messy code, and 'foo.golden' is how it should come out.
+const formatTests = "../../rsc/suite/format"
+
+func TestFormatSource(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join(formatTests, "*.pf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no tests found in %s", formatTests)
+	}
+	for _, input := range inputs {
+		messy, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		golden, err := os.ReadFile(strings.TrimSuffix(input, ".pf") + ".golden")
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, formatErr := FormatSource(string(messy))
+		if formatErr != nil {
+			t.Errorf("%s: unexpected error %s", input, formatErr.Message)
+			continue
+		}
+		if got != string(golden) {
+			t.Errorf("%s: got\n%s\nwant\n%s", input, got, golden)
+		}
+		// Formatting should leave formatted code alone.
+		again, formatErr := FormatSource(got)
+		if formatErr != nil || again != got {
+			t.Errorf("%s: formatting the result again changed it to\n%s", input, again)
+		}
+	}
+}
+
+func TestFormatSourceErrors(t *testing.T) {
+	tests := []struct {
+		input   string
+		errorID string
+	}{
+		{"foo : \"zort", "built/format/lex"},
+		{"foo : gocode {\n    return 1\n}", "built/format/gocode"},
+		{"foo : --- SELECT * FROM |x|", "built/format/snippet"},
+	}
+	for _, tt := range tests {
+		_, err := FormatSource(tt.input)
+		if err == nil {
+			t.Errorf("%q: expected error %s, got none", tt.input, tt.errorID)
+			continue
+		}
+		if err.ErrorId != tt.errorID {
+			t.Errorf("%q: expected error %s, got %s", tt.input, tt.errorID, err.ErrorId)
+		}
+	}
+}
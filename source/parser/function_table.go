@@ -64,18 +64,23 @@ func UpdateEnvironment(sig signature.Signature, params []object.Object, env *obj
 	}
 	sigPos := 0
 	tupleAccumulator := []object.Object{}
+	bind := func(name string, val object.Object) {
+		if name != "_" { // Then the parameter is there to be ignored, and so we don't bind it.
+			env.Set(name, val)
+		}
+	}
 
 	for paramPos := 0; paramPos < len(params); paramPos++ {
 		if sig[sigPos].VarType == object.TUPLE_OBJ {
 			if params[paramPos].Type() == object.BLING_OBJ {
-				env.Set(sig[sigPos].VarName, &object.Tuple{Elements: tupleAccumulator})
+				bind(sig[sigPos].VarName, &object.Tuple{Elements: tupleAccumulator})
 				tupleAccumulator = []object.Object{}
 				sigPos = sigPos + 2
 				continue
 			}
 			if params[paramPos].Type() == object.TUPLE_OBJ && len(params[paramPos].(*object.Tuple).Elements) == 0 {
 				if len(tupleAccumulator) == 0 && (paramPos == len(params)-1 || params[paramPos+1].Type() == object.BLING_OBJ) {
-					env.Set(sig[sigPos].VarName, object.EMPTY_TUPLE)
+					bind(sig[sigPos].VarName, object.EMPTY_TUPLE)
 					tupleAccumulator = []object.Object{}
 					sigPos = sigPos + 1
 				}
@@ -83,7 +88,7 @@ func UpdateEnvironment(sig signature.Signature, params []object.Object, env *obj
 			}
 			if paramPos == len(params)-1 {
 				tupleAccumulator = append(tupleAccumulator, params[paramPos])
-				env.Set(sig[sigPos].VarName, &object.Tuple{Elements: tupleAccumulator})
+				bind(sig[sigPos].VarName, &object.Tuple{Elements: tupleAccumulator})
 				break
 			}
 			tupleAccumulator = append(tupleAccumulator, params[paramPos])
@@ -94,7 +99,7 @@ func UpdateEnvironment(sig signature.Signature, params []object.Object, env *obj
 			continue
 		}
 
-		env.Set(sig[sigPos].VarName, params[paramPos])
+		bind(sig[sigPos].VarName, params[paramPos])
 
 		sigPos++
 	}
@@ -0,0 +1,281 @@
+package parser
+
+import (
+	"strings"
+
+	"pipefish/source/ast"
+	"pipefish/source/object"
+	"pipefish/source/signature"
+	"pipefish/source/token"
+)
+
+// This lets us say what types an expression might evaluate to without evaluating it, for the benefit of the REPL
+// and of tooling. There's no type inference in the evaluator, so we work from the types of literals, the current
+// values of the globals, and the declared return types of the functions the expression calls. Nothing is
+// executed, so in particular a command mentioned in the expression has no effects.
+
+// The types a value might have. Each alternative is a list of types, one for each element of a tuple.
+type typeScheme [][]string
+
+// This is what we say when we don't know anything: a tuple may contain anything at all.
+var anyTypes = typeScheme{{"tuple"}}
+
+// Gives e.g. "int/bool" for a single value, and "(int, int)" for a pair of values.
+func (ts typeScheme) String() string {
+	descriptions := []string{}
+	for _, alternative := range ts {
+		description := strings.Join(alternative, ", ")
+		if len(alternative) != 1 {
+			description = "(" + description + ")"
+		}
+		alreadyFound := false
+		for _, found := range descriptions {
+			alreadyFound = alreadyFound || found == description
+		}
+		if !alreadyFound {
+			descriptions = append(descriptions, description)
+		}
+	}
+	return strings.Join(descriptions, "/")
+}
+
+func (ts typeScheme) isUnknown() bool {
+	for _, alternative := range ts {
+		for _, ty := range alternative {
+			if ty == "tuple" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// The declared return types of a function, with any union types split into their members, or anyTypes if none
+// were declared.
+func typeSchemeOfReturns(f ast.Function) typeScheme {
+	if len(f.Rets) == 0 {
+		return anyTypes
+	}
+	result := typeScheme{{}}
+	for _, ret := range f.Rets {
+		result = result.followedBy(typeSchemeOf(strings.Split(ret.VarType, "/")...))
+	}
+	return result
+}
+
+func typeSchemeOf(types ...string) typeScheme {
+	result := typeScheme{}
+	for _, ty := range types {
+		result = append(result, []string{ty})
+	}
+	return result
+}
+
+// The types of a tuple whose first elements have the types in ts and whose remaining elements have the types in
+// other.
+func (ts typeScheme) followedBy(other typeScheme) typeScheme {
+	result := typeScheme{}
+	for _, left := range ts {
+		for _, right := range other {
+			alternative := make([]string, 0, len(left)+len(right))
+			alternative = append(append(alternative, left...), right...)
+			result = append(result, alternative)
+		}
+	}
+	return result
+}
+
+func (p *Parser) inferTypes(node ast.Node, env *object.Environment) (typeScheme, *object.Error) {
+	switch node := node.(type) {
+	case *ast.BooleanLiteral:
+		return typeSchemeOf("bool"), nil
+	case *ast.ComparisonChain:
+		return typeSchemeOf("bool"), nil
+	case *ast.EmptyTuple, *ast.Nothing:
+		return typeScheme{{}}, nil
+	case *ast.FloatLiteral:
+		return typeSchemeOf("float64"), nil
+	case *ast.FuncExpression:
+		return typeSchemeOf("func"), nil
+	case *ast.Identifier:
+		return p.inferTypesOfIdentifier(node, env)
+	case *ast.InfixExpression:
+		if node.Token.Type == token.COMMA {
+			left, err := p.inferTypes(node.Args[0], env)
+			if err != nil {
+				return nil, err
+			}
+			right, err := p.inferTypes(node.Args[2], env)
+			if err != nil {
+				return nil, err
+			}
+			return left.followedBy(right), nil
+		}
+		if node.Operator == "==" || node.Operator == "!=" {
+			return typeSchemeOf("bool"), nil
+		}
+		return p.inferTypesOfCall(node.Operator, node.Args, node.Token, env)
+	case *ast.IntegerLiteral:
+		return typeSchemeOf("int"), nil
+	case *ast.LazyInfixExpression:
+		if node.Operator == "and" || node.Operator == "or" {
+			return typeSchemeOf("bool"), nil
+		}
+	case *ast.ListExpression:
+		return typeSchemeOf("list"), nil
+	case *ast.PrefixExpression:
+		if node.Operator == "not" {
+			return typeSchemeOf("bool"), nil
+		}
+		return p.inferTypesOfCall(node.Operator, node.Args, node.Token, env)
+	case *ast.SetExpression:
+		return typeSchemeOf("set"), nil
+	case *ast.StringLiteral:
+		return typeSchemeOf("string"), nil
+	case *ast.SuffixExpression:
+		return p.inferTypesOfCall(node.Operator, node.Args, node.Token, env)
+	case *ast.TypeLiteral:
+		return typeSchemeOf("type"), nil
+	case *ast.UnfixExpression:
+		return p.inferTypesOfCall(node.Operator, []ast.Node{}, node.Token, env)
+	}
+	return anyTypes, nil
+}
+
+// Like evalIdentifier in the evaluator, except that it looks at the type of the value rather than returning it.
+func (p *Parser) inferTypesOfIdentifier(node *ast.Identifier, env *object.Environment) (typeScheme, *object.Error) {
+	val, ok := env.Get(node.Value)
+	if ok && !(env.IsPrivate(node.Value) && node.Token.Source == "REPL input") {
+		switch val := val.(type) {
+		case *object.Lazy:
+			return anyTypes, nil
+		case *object.Tuple:
+			alternative := []string{}
+			for _, element := range val.Elements {
+				alternative = append(alternative, object.ConcreteType(element))
+			}
+			return typeScheme{alternative}, nil
+		}
+		return typeSchemeOf(object.ConcreteType(val)), nil
+	}
+	if p.Functions.Contains(node.Value) {
+		return typeSchemeOf("func"), nil
+	}
+	return nil, newError("eval/repl/var", node.Token, node.Value)
+}
+
+// The types an argument of a function call might have, or the name of the bling if that's what it is.
+type argTypes struct {
+	bling string
+	types []string
+}
+
+// We find the types of the arguments, and then the union of the return types of all the overloads of the function
+// which might accept them.
+func (p *Parser) inferTypesOfCall(name string, args []ast.Node, tok token.Token, env *object.Environment) (typeScheme, *object.Error) {
+	overloads, ok := p.FunctionTable[name]
+	if !ok {
+		return anyTypes, nil
+	}
+	params, arityIsKnown, err := p.inferTypesOfArgs(args, env)
+	if err != nil {
+		return nil, err
+	}
+	result := typeScheme{}
+	for _, f := range overloads {
+		if !p.mightAccept(f.Sig, params, arityIsKnown) {
+			continue
+		}
+		if len(f.Rets) == 0 {
+			return anyTypes, nil
+		}
+		result = append(result, typeSchemeOfReturns(f)...)
+	}
+	if len(result) == 0 {
+		types := []string{}
+		for _, param := range params {
+			if param.bling == "" {
+				types = append(types, strings.Join(param.types, "/"))
+			}
+		}
+		return nil, newError("infer/args", tok, name, strings.Join(types, ", "))
+	}
+	return result, nil
+}
+
+// The types of the arguments of a function call, one for each parameter they might be passed to, and whether we know
+// how many there are. If we don't, then we've only found the types of the first few.
+func (p *Parser) inferTypesOfArgs(args []ast.Node, env *object.Environment) ([]argTypes, bool, *object.Error) {
+	params := []argTypes{}
+	for _, arg := range args {
+		if bling, ok := arg.(*ast.Bling); ok {
+			params = append(params, argTypes{bling: bling.Value})
+			continue
+		}
+		types, err := p.inferTypes(arg, env)
+		if err != nil {
+			return params, false, err
+		}
+		arityIsKnown := true
+		for _, alternative := range types {
+			arityIsKnown = arityIsKnown && len(alternative) == len(types[0])
+		}
+		if !arityIsKnown || types.isUnknown() {
+			return params, false, nil // Then we can't tell which parameters the rest of the arguments go to.
+		}
+		for i := range types[0] {
+			param := argTypes{}
+			for _, alternative := range types {
+				param.types = append(param.types, alternative[i])
+			}
+			params = append(params, param)
+		}
+	}
+	return params, true, nil
+}
+
+// The overloads of the function which might accept the arguments, so far as we can tell without evaluating them.
+// Where we can't tell the type of an argument, we suppose it might be anything.
+func (p *Parser) PossibleOverloads(name string, args []ast.Node, env *object.Environment) []ast.Function {
+	params, arityIsKnown, _ := p.inferTypesOfArgs(args, env)
+	result := []ast.Function{}
+	for _, f := range p.FunctionTable[name] {
+		if p.mightAccept(f.Sig, params, arityIsKnown) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// Whether a function with the given signature might accept arguments of the given types. If we don't know the
+// arity of the arguments then we have only checked the first few of them.
+func (p *Parser) mightAccept(sig signature.Signature, params []argTypes, arityIsKnown bool) bool {
+	for i, param := range params {
+		var paramType, paramName string
+		switch {
+		case i < len(sig):
+			paramType, paramName = sig[i].VarType, sig[i].VarName
+		case len(sig) > 0 && sig[len(sig)-1].VarType == "tuple":
+			paramType = "tuple"
+		default:
+			return false
+		}
+		if param.bling != "" || paramType == "bling" {
+			if param.bling != paramName || paramType != "bling" {
+				return false
+			}
+			continue
+		}
+		fits := false
+		for _, ty := range param.types {
+			fits = fits || IsSameTypeOrSubtype(p.TypeSystem, ty, paramType) || IsSameTypeOrSubtype(p.TypeSystem, paramType, ty)
+		}
+		if !fits {
+			return false
+		}
+	}
+	if arityIsKnown && len(params) < len(sig) {
+		return len(params) == len(sig)-1 && sig[len(sig)-1].VarType == "tuple"
+	}
+	return true
+}
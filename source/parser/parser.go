@@ -8,6 +8,7 @@ import (
 	"strings"
 
 	"pipefish/source/ast"
+	"pipefish/source/lexer"
 	"pipefish/source/object"
 	"pipefish/source/relexer"
 	"pipefish/source/set"
@@ -47,8 +48,9 @@ const (
 	FINFIX      // user-defined infix or ->
 	SUM         // + or -
 	PRODUCT     // * or / or %
+	FINFIX_HIGH // ** or user-defined infix declared as binding more tightly than * or /
 	FSUFFIX     // user-defined suffix, or type in type declaration
-	MINUS       //  - as a prefix
+	MINUS       //  - as a prefix, which binds more tightly than any infix, even **, so -2 ** 2 is 4
 	INDEX       // after [
 	BELOW_NAMESPACE
 	NAMESPACE // 'foo.bar'
@@ -90,6 +92,21 @@ var precedences = map[token.TokenType]int{
 	token.NAMESPACE:   NAMESPACE,
 }
 
+// Users can declare the precedence of their own infixes with e.g. 'infix 6 <op>', or 'infixr 6 <op>' to make it
+// right-associative. This maps the levels they can
+// declare to the precedences of the builtin operators they share them with. An infix with no declaration is at
+// level 5.
+var UserPrecedences = map[int]int{
+	1: OR,
+	2: AND,
+	3: EQUALS,
+	4: LESSGREATER,
+	5: FINFIX,
+	6: SUM,
+	7: PRODUCT,
+	8: FINFIX_HIGH,
+}
+
 type TokenSupplier interface{ NextToken() token.Token }
 
 func String(t TokenSupplier) string {
@@ -113,6 +130,7 @@ type Parser struct {
 
 	TokenizedCode         TokenSupplier
 	Errors                object.Errors
+	Warnings              object.Errors
 	nesting               stack.Stack[token.Token]
 	curToken              token.Token
 	peekToken             token.Token
@@ -155,11 +173,17 @@ type Parser struct {
 	NamespacePath    string
 	RootService      *Service
 	Directory        string
+	InfixPrecedences map[string]int    // The precedences users have declared for their own infixes.
+	RightAssociative set.Set[string]   // The infixes users have declared to be right-associative.
+	InitOrder        []string          // The names of the global constants and variables in the order they were initialized.
+	Docs             map[string]string // The doc-comments of the things declared, by name.
+	Flags            map[string]bool   // The flags deciding which 'when' blocks are compiled.
 }
 
 func New(dir string) *Parser {
 	p := &Parser{
 		Errors:            []*object.Error{},
+		Warnings:          []*object.Error{},
 		Logging:           true,
 		nesting:           *stack.NewStack[token.Token](),
 		Functions:         make(set.Set[string]),
@@ -180,16 +204,20 @@ func New(dir string) *Parser {
 			token.NAMESPACE, token.IFLOG}),
 		lazyInfixes: *set.MakeFromSlice([]token.TokenType{token.AND,
 			token.OR, token.COLON, token.WEAK_COLON, token.SEMICOLON, token.NEWLINE}),
-		FunctionTable:   make(FunctionTable),
-		FunctionTreeMap: make(map[string]*ast.FnTreeNode),
-		GlobalConstants: object.NewEnvironment(), // I need my functions to be able to see the global constants.
-		AllGlobals:      object.NewEnvironment(), // The logger needs to be able to see service variables and this is the simplest way.
-		TypeSystem:      NewTypeSystem(),
-		Structs:         make(set.Set[string]),
-		GoImports:       make(map[string][]string),
-		NamespaceBranch: make(map[string]*Service),
-		Contacts:        []string{},
-		Directory:       dir,
+		FunctionTable:    make(FunctionTable),
+		FunctionTreeMap:  make(map[string]*ast.FnTreeNode),
+		GlobalConstants:  object.NewEnvironment(), // I need my functions to be able to see the global constants.
+		AllGlobals:       object.NewEnvironment(), // The logger needs to be able to see service variables and this is the simplest way.
+		TypeSystem:       NewTypeSystem(),
+		Structs:          make(set.Set[string]),
+		GoImports:        make(map[string][]string),
+		NamespaceBranch:  make(map[string]*Service),
+		InfixPrecedences: make(map[string]int),
+		RightAssociative: make(set.Set[string]),
+		Docs:             make(map[string]string),
+		Flags:            make(map[string]bool),
+		Contacts:         []string{},
+		Directory:        dir,
 	}
 
 	for k := range *p.TypeSystem {
@@ -261,8 +289,8 @@ func (p *Parser) ParseTokenizedChunk() *ast.Node {
 	return &expn
 }
 
-var literals = *set.MakeFromSlice([]token.TokenType{token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.ELSE})
-var literalsAndLParen = *set.MakeFromSlice([]token.TokenType{token.INT, token.FLOAT, token.STRING, token.TRUE, token.FALSE, token.ELSE,
+var literals = *set.MakeFromSlice([]token.TokenType{token.INT, token.FLOAT, token.STRING, token.TEMPLATE, token.TRUE, token.FALSE, token.ELSE})
+var literalsAndLParen = *set.MakeFromSlice([]token.TokenType{token.INT, token.FLOAT, token.STRING, token.TEMPLATE, token.TRUE, token.FALSE, token.ELSE,
 	token.LPAREN, token.LBRACE, token.EVAL})
 var assignmentTokens = *set.MakeFromSlice([]token.TokenType{token.ASSIGN, token.VAR_ASSIGN, token.DEF_ASSIGN,
 	token.CMD_ASSIGN, token.GVN_ASSIGN, token.LZY_ASSIGN, token.PVR_ASSIGN, token.TYP_ASSIGN})
@@ -282,6 +310,8 @@ func (p *Parser) parseExpression(precedence int) ast.Node {
 		leftExp = p.parseFloatLiteral()
 	case token.STRING:
 		leftExp = p.parseStringLiteral()
+	case token.TEMPLATE:
+		leftExp = p.parseTemplateLiteral()
 	case token.NOT:
 		leftExp = p.parseNativePrefixExpression()
 	case token.EVAL, token.GLOBAL:
@@ -307,7 +337,13 @@ func (p *Parser) parseExpression(precedence int) ast.Node {
 	case token.PRELOG:
 		leftExp = p.parsePrelogExpression()
 	default:
-		noNativePrefix = true
+		// Like 'match' below, 'when' isn't a keyword. Unlike 'match', it can be followed by more lines of code.
+		if p.curToken.Type == token.IDENT && p.curToken.Literal == "when" && p.peekToken.Type == token.IDENT &&
+			!p.Functions.Contains("when") {
+			leftExp = p.parseWhenExpression()
+		} else {
+			noNativePrefix = true
+		}
 	}
 
 	// So what we're going to do is find out if the identifier *thinks* it's a function, i.e. if it precedes
@@ -327,10 +363,23 @@ func (p *Parser) parseExpression(precedence int) ast.Node {
 				return leftExp
 			}
 
-			if p.curToken.Literal == "struct" {
+			if p.curToken.Literal == "struct" && p.peekToken.Type == token.LPAREN { // Else it names the type.
 				leftExp = p.parseStructExpression()
 				return leftExp
 			}
+
+			// 'match' isn't a keyword, so as not to take the name from the functions in the standard libraries:
+			// if there's a function called 'match' in the way, we parse that instead.
+			if p.curToken.Literal == "match" && p.peekToken.Type != token.LPAREN && !p.Functions.Contains("match") {
+				leftExp = p.parseMatchExpression()
+				return leftExp
+			}
+
+			if (p.curToken.Literal == "break" || p.curToken.Literal == "continue") && p.peekToken.Type == token.IDENT &&
+				!p.Infixes.Contains(p.peekToken.Literal) {
+				leftExp = p.parseLabeledLoopControl()
+				return leftExp
+			}
 			// Here we step in and deal with things that are functions and objects, like the type conversion
 			// functions and their associated types. Before we look them up as functions, we want to
 			// be sure that they're not in such a position that they're being used as literals.
@@ -357,6 +406,7 @@ func (p *Parser) parseExpression(precedence int) ast.Node {
 		}
 	}
 
+	chainable := false // Whether leftExp is a comparison we've just parsed, which a further comparison would extend.
 	for precedence < p.peekPrecedence() {
 		for p.Suffixes.Contains(p.peekToken.Literal) || p.Endfixes.Contains(p.peekToken.Literal) || p.peekToken.Type == token.EMDASH {
 			if p.curToken.Type == token.NOT || p.curToken.Type == token.IDENT && p.curToken.Literal == "-" || p.curToken.Type == token.ELSE {
@@ -365,11 +415,13 @@ func (p *Parser) parseExpression(precedence int) ast.Node {
 			}
 			p.NextToken()
 			leftExp = p.parseSuffixExpression(leftExp)
+			chainable = false
 		}
 
 		if p.peekToken.Type == token.LOG {
 			p.NextToken()
 			leftExp = p.parseLogExpression(leftExp)
+			chainable = false
 		}
 
 		if precedence >= p.peekPrecedence() {
@@ -396,8 +448,14 @@ func (p *Parser) parseExpression(precedence int) ast.Node {
 				leftExp = p.parseStreamingExpression(leftExp)
 			case p.curToken.Type == token.IFLOG:
 				leftExp = p.parseIfLogExpression(leftExp)
+			case chainable && isComparison(p.curToken):
+				leftExp = p.parseComparisonChain(leftExp)
 			default:
+				chainable = isComparison(p.curToken)
 				leftExp = p.parseInfixExpression(leftExp)
+				if infix, ok := leftExp.(*ast.InfixExpression); !ok || len(infix.Args) != 3 {
+					chainable = false
+				}
 			}
 		}
 	}
@@ -472,6 +530,9 @@ func (p *Parser) peekPrecedence() int {
 		if p.peekToken.Literal == "*" || p.peekToken.Literal == "/" || p.peekToken.Literal == "%" {
 			return PRODUCT
 		}
+		if p.peekToken.Literal == "**" {
+			return FINFIX_HIGH
+		}
 		if p.peekToken.Literal == "<" || p.peekToken.Literal == "<=" || p.peekToken.Literal == ">" || p.peekToken.Literal == ">=" {
 			return LESSGREATER
 		}
@@ -481,6 +542,9 @@ func (p *Parser) peekPrecedence() int {
 		if p.peekToken.Literal == "with" || p.peekToken.Literal == "without" { // Note, this is the one assymmetry in the system of precedence.
 			return WITH // When not peeking ahead, `with` has precedence just *below* a comma.
 		}
+		if precedence, ok := p.InfixPrecedences[p.peekToken.Literal]; ok {
+			return precedence
+		}
 		return FINFIX
 	}
 	if p.Prefixes.Contains(p.peekToken.Literal) || p.Functions.Contains(p.peekToken.Literal) {
@@ -513,6 +577,9 @@ func (p *Parser) curPrecedence() int {
 			if p.curToken.Literal == "*" || p.curToken.Literal == "/" || p.curToken.Literal == "%" {
 				return PRODUCT
 			}
+			if p.curToken.Literal == "**" {
+				return FINFIX_HIGH
+			}
 			if p.curToken.Literal == "<" || p.curToken.Literal == "<=" || p.curToken.Literal == ">" || p.curToken.Literal == ">=" {
 				return LESSGREATER
 			}
@@ -522,6 +589,9 @@ func (p *Parser) curPrecedence() int {
 			if p.curToken.Literal == "with" || p.curToken.Literal == "without" {
 				return FMIDFIX
 			}
+			if precedence, ok := p.InfixPrecedences[p.curToken.Literal]; ok {
+				return precedence
+			}
 			return FINFIX
 		}
 		if p.Prefixes.Contains(p.curToken.Literal) || p.Functions.Contains(p.curToken.Literal) {
@@ -554,9 +624,22 @@ func (p *Parser) parseIndexExpression(left ast.Node) ast.Node {
 		p.NextToken() // Forces emission of error
 		return nil
 	}
+	// 'm[i, j]' is sugar for 'm[i][j]'.
+	indices := listifyCommas(exp.Index)
+	exp.Index = indices[0]
+	for _, index := range indices[1:] {
+		exp = &ast.IndexExpression{Token: exp.Token, Left: exp, Index: index}
+	}
 	return exp
 }
 
+func listifyCommas(node ast.Node) []ast.Node {
+	if infix, ok := node.(*ast.InfixExpression); ok && infix.Operator == "," {
+		return append(listifyCommas(infix.Args[0]), listifyCommas(infix.Args[2])...)
+	}
+	return []ast.Node{node}
+}
+
 func (p *Parser) parseIdentifier() ast.Node {
 	return &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
 }
@@ -565,9 +648,17 @@ func (p *Parser) parseUnfixExpression() ast.Node {
 	return &ast.UnfixExpression{Token: p.curToken, Operator: p.curToken.Literal}
 }
 
+// 'break' and 'continue' can be followed by the label of the loop they apply to.
+func (p *Parser) parseLabeledLoopControl() ast.Node {
+	expression := &ast.UnfixExpression{Token: p.curToken, Operator: p.curToken.Literal}
+	p.NextToken()
+	expression.Label = p.curToken.Literal
+	return expression
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Node {
 	lit := &ast.IntegerLiteral{Token: p.curToken}
-	value, e := strconv.Atoi(p.curToken.Literal)
+	value, e := strconv.ParseInt(p.curToken.Literal, 10, 64)
 	if e != nil {
 		p.Throw("parse/int", p.curToken)
 		return nil
@@ -593,6 +684,89 @@ func (p *Parser) parseStringLiteral() ast.Node {
 	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
 }
 
+// A template such as "Hello {name}!" is desugared into '"Hello " + (string name) + "!"'.
+func (p *Parser) parseTemplateLiteral() ast.Node {
+	tok := p.curToken
+	chunks, errorID := splitTemplate(tok.Literal)
+	if errorID != "" {
+		p.Throw(errorID, tok)
+		return &ast.StringLiteral{Token: tok}
+	}
+	parts := []ast.Node{}
+	for i, chunk := range chunks {
+		switch {
+		case i%2 == 1:
+			stringTok := token.Token{Type: token.IDENT, Literal: "string", Source: tok.Source, Line: tok.Line, ChStart: tok.ChStart, ChEnd: tok.ChEnd}
+			parts = append(parts, &ast.PrefixExpression{Token: stringTok, Operator: "string",
+				Args: []ast.Node{p.parseInterpolation(chunk, tok)}})
+		case chunk != "":
+			parts = append(parts, &ast.StringLiteral{Token: tok, Value: chunk})
+		}
+	}
+	result := parts[0]
+	if _, ok := result.(*ast.PrefixExpression); ok && len(parts) == 1 {
+		return result
+	}
+	plusTok := token.Token{Type: token.IDENT, Literal: "+", Source: tok.Source, Line: tok.Line, ChStart: tok.ChStart, ChEnd: tok.ChEnd}
+	for _, part := range parts[1:] {
+		result = &ast.InfixExpression{Token: plusTok, Operator: "+",
+			Args: []ast.Node{result, &ast.Bling{Token: plusTok, Value: "+"}, part}}
+	}
+	return result
+}
+
+// Splits the literal of a template into the parts of the string, which are unescaped, alternating with the source
+// code of the expressions to be interpolated, so that the odd-numbered elements are the expressions. If the template
+// is malformed we return the error ID.
+func splitTemplate(literal string) ([]string, string) {
+	chunks := []string{}
+	chunk := ""
+	escape := false
+	runes := []rune(literal)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '{' || escape {
+			escape = runes[i] == '\\' && !escape
+			chunk = chunk + string(runes[i])
+			continue
+		}
+		chunks = append(chunks, lexer.Unescape(chunk))
+		chunk = ""
+		braces := 1
+		for i++; i < len(runes); i++ {
+			if runes[i] == '{' {
+				braces++
+			}
+			if runes[i] == '}' {
+				braces--
+			}
+			if braces == 0 {
+				break
+			}
+			chunk = chunk + string(runes[i])
+		}
+		if braces > 0 {
+			return nil, "parse/template/brace"
+		}
+		if strings.TrimSpace(chunk) == "" {
+			return nil, "parse/template/empty"
+		}
+		chunks = append(chunks, lexer.Unescape(chunk))
+		chunk = ""
+	}
+	return append(chunks, lexer.Unescape(chunk)), ""
+}
+
+// Parses an expression embedded in a template, putting back the state of the parser afterwards.
+func (p *Parser) parseInterpolation(source string, tok token.Token) ast.Node {
+	tokenizedCode, nesting, curToken, peekToken := p.TokenizedCode, p.nesting, p.curToken, p.peekToken
+	rl := relexer.New(tok.Source, source)
+	p.TokenizedCode = rl
+	result := p.ParseTokenizedChunk()
+	p.Errors = append(p.Errors, rl.GetErrors()...)
+	p.TokenizedCode, p.nesting, p.curToken, p.peekToken = tokenizedCode, nesting, curToken, peekToken
+	return *result
+}
+
 func (p *Parser) parseAutoLog() ast.Node {
 	return &ast.StringLiteral{Token: p.curToken}
 }
@@ -632,11 +806,69 @@ func (p *Parser) parseLoopExpression() ast.Node {
 	expression := &ast.LoopExpression{
 		Token: p.curToken,
 	}
+	if strings.HasPrefix(p.curToken.Literal, "loop ") { // The relexer puts the label, if any, here.
+		expression.Label = p.curToken.Literal[len("loop "):]
+	}
 	p.NextToken()
 	expression.Code = p.parseExpression(GIVEN)
 	return expression
 }
 
+// A match expression looks like 'match <subject> : <pattern> : <value> ; <pattern> : <value> ...', where the
+// arms usually go in an indented block. We split the arms up here so that the evaluator doesn't have to.
+func (p *Parser) parseMatchExpression() ast.Node {
+	expression := &ast.MatchExpression{
+		Token: p.curToken,
+	}
+	p.NextToken()
+	expression.Subject = p.parseExpression(COLON)
+	if !p.peekTokenIs(token.COLON) {
+		p.Throw("parse/match/colon", p.peekToken)
+		return nil
+	}
+	p.NextToken()
+	p.NextToken()
+	for _, arm := range p.recursivelyListArms(p.parseExpression(COLON)) {
+		if arm == nil {
+			return nil
+		}
+		conditional, ok := arm.(*ast.LazyInfixExpression)
+		if !ok || conditional.Operator != ":" {
+			p.Throw("parse/match/arm", arm.GetToken())
+			continue
+		}
+		expression.Patterns = append(expression.Patterns, conditional.Left)
+		expression.Values = append(expression.Values, conditional.Right)
+	}
+	return expression
+}
+
+// A 'when' block is included or left out at parse time according to whether its flag is set, so if it's left out
+// there's nothing left of it to evaluate.
+func (p *Parser) parseWhenExpression() ast.Node {
+	tok := p.curToken
+	p.NextToken()
+	flag := p.curToken.Literal
+	if !p.peekTokenIs(token.COLON) {
+		p.Throw("parse/when/colon", p.peekToken)
+		return nil
+	}
+	p.NextToken()
+	p.NextToken()
+	body := p.parseExpression(COLON)
+	if !p.Flags[flag] {
+		return &ast.OmittedExpression{Token: tok}
+	}
+	return body
+}
+
+func (p *Parser) recursivelyListArms(start ast.Node) []ast.Node {
+	if start, ok := start.(*ast.LazyInfixExpression); ok && start.Operator == ";" {
+		return append(p.recursivelyListArms(start.Left), p.recursivelyListArms(start.Right)...)
+	}
+	return []ast.Node{start}
+}
+
 func (p *Parser) parseStructExpression() ast.Node {
 	expression := &ast.StructExpression{
 		Token: p.curToken,
@@ -737,6 +969,9 @@ func (p *Parser) parseInfixExpression(left ast.Node) ast.Node {
 		Operator: p.curToken.Literal,
 	}
 	precedence := p.curPrecedence()
+	if p.RightAssociative.Contains(expression.Operator) || expression.Operator == "**" { // Then the right-hand side can contain the same operator.
+		precedence--
+	}
 	p.NextToken()
 	right := p.parseExpression(precedence)
 	if expression.Operator == "," {
@@ -750,6 +985,26 @@ func (p *Parser) parseInfixExpression(left ast.Node) ast.Node {
 	return expression
 }
 
+// We turn e.g. '0 <= x < 10' into a chain of comparisons, so that the evaluator can evaluate 'x' only once. A
+// comparison in parentheses isn't chained with anything outside them.
+func (p *Parser) parseComparisonChain(left ast.Node) ast.Node {
+	chain, ok := left.(*ast.ComparisonChain)
+	if !ok {
+		infix := left.(*ast.InfixExpression)
+		chain = &ast.ComparisonChain{Token: infix.Token, Operands: []ast.Node{infix.Args[0], infix.Args[2]},
+			Operators: []token.Token{infix.Token}}
+	}
+	chain.Operators = append(chain.Operators, p.curToken)
+	precedence := p.curPrecedence()
+	p.NextToken()
+	chain.Operands = append(chain.Operands, p.parseExpression(precedence))
+	return chain
+}
+
+func isComparison(tok token.Token) bool {
+	return tok.Type == token.IDENT && (tok.Literal == "<" || tok.Literal == "<=" || tok.Literal == ">" || tok.Literal == ">=")
+}
+
 // In a streaming expression we need to desugar e.g. 'x -> foo' to 'x -> foo that', etc.
 func (p *Parser) parseStreamingExpression(left ast.Node) ast.Node {
 	expression := &ast.StreamingExpression{
@@ -837,6 +1092,29 @@ func (p *Parser) parseAssignmentExpression(left ast.Node) ast.Node {
 	precedence := p.curPrecedence()
 	p.NextToken()
 	expression.Right = p.parseExpression(precedence)
+	if expression.Token.Literal != "=" {
+		return p.desugarCompoundAssignment(expression)
+	}
+	return expression
+}
+
+// We turn e.g. 'x += 1' into 'x = x + 1'. This only makes sense in a command or the REPL, where there's a variable
+// with a value to update. The token keeps its literal so that the evaluator knows it mustn't create a new variable.
+func (p *Parser) desugarCompoundAssignment(expression *ast.AssignmentExpression) ast.Node {
+	if !(expression.Token.Type == token.CMD_ASSIGN || expression.Token.Type == token.ASSIGN) {
+		p.Throw("parse/assign/compound", expression.Token)
+		return nil
+	}
+	if _, ok := expression.Left.(*ast.Identifier); !ok {
+		p.Throw("parse/assign/ident", expression.Token)
+		return nil
+	}
+	opTok := expression.Token
+	opTok.Type = token.IDENT
+	opTok.Literal = strings.TrimSuffix(expression.Token.Literal, "=")
+	infix := &ast.InfixExpression{Token: opTok, Operator: opTok.Literal}
+	infix.Args = append([]ast.Node{expression.Left, &ast.Bling{Value: opTok.Literal, Token: opTok}}, p.recursivelyListify(expression.Right)...)
+	expression.Right = infix
 	return expression
 }
 
@@ -1230,10 +1508,13 @@ func (p *Parser) extractSig(args []ast.Node) signature.Signature {
 					varName = arg.Operator
 					varType = inner.Value
 					if !(TypeExists(inner.Value, p.TypeSystem) ||
-						arg.Operator == "ast" || arg.Operator == "ident") {
+						inner.Value == "ast" || inner.Value == "ident") {
 						p.Throw("parse/sig/type/b", arg.Token)
 						return nil
 					}
+				case *ast.TypeLiteral:
+					varName = arg.Operator
+					varType = inner.Value
 				default:
 					p.Throw("parse/sig/ident/b", inner.GetToken())
 					return nil
@@ -1250,13 +1531,21 @@ func (p *Parser) extractSig(args []ast.Node) signature.Signature {
 				}
 				switch potentialInteger := arg.Args[2].(type) {
 				case *ast.IntegerLiteral:
-					varType = "varchar(" + strconv.Itoa(potentialInteger.Value) + ")"
+					varType = "varchar(" + strconv.FormatInt(potentialInteger.Value, 10) + ")"
 				default:
 					p.Throw("parse/sig/varchar/int/a", potentialInteger.GetToken())
 					return nil
 				}
 			} else {
-				if p.Midfixes.Contains(arg.Operator) {
+				if arg.Operator == "/" {
+					unionSig, err := p.slurpUnionType(arg, "*")
+					if err != nil || len(unionSig) != 1 {
+						p.Throw("parse/sig/union", arg.GetToken())
+						return nil
+					}
+					varName = unionSig[0].VarName
+					varType = unionSig[0].VarType
+				} else if p.Midfixes.Contains(arg.Operator) {
 					varName = arg.Operator
 					varType = "bling"
 				} else {
@@ -1343,11 +1632,13 @@ func (p *Parser) RecursivelySlurpSignature(node ast.Node, dflt string) (signatur
 		case typednode.Operator == "varchar":
 			switch potentialInteger := typednode.Args[2].(type) {
 			case *ast.IntegerLiteral:
-				varType := "varchar(" + strconv.Itoa(potentialInteger.Value) + ")"
+				varType := "varchar(" + strconv.FormatInt(potentialInteger.Value, 10) + ")"
 				return p.RecursivelySlurpSignature(typednode.Args[0], varType)
 			default:
 				return nil, newError("parse/sig/varchar/int/b", potentialInteger.GetToken())
 			}
+		case typednode.Operator == "/":
+			return p.slurpUnionType(typednode, dflt)
 		case typednode.Operator == ".":
 			namespacedIdent, err := recursivelySlurpNamespace(typednode)
 			if err != nil {
@@ -1412,6 +1703,26 @@ func (p *Parser) RecursivelySlurpSignature(node ast.Node, dflt string) (signatur
 	return nil, newError("parse/sig/d", node.GetToken())
 }
 
+// A parameter or field can be given a union of types, e.g. 'x int/string'. This parses as the infix '/' applied
+// to 'x int' and 'string', so we find the types on the left and make a union of them with the type on the right.
+func (p *Parser) slurpUnionType(node *ast.InfixExpression, dflt string) (signature.Signature, *object.Error) {
+	LHS, err := p.RecursivelySlurpSignature(node.Args[0], dflt)
+	if err != nil {
+		return nil, err
+	}
+	RHS, ok := node.Args[2].(*ast.TypeLiteral)
+	if !ok {
+		return nil, newError("parse/sig/union", node.Args[2].GetToken())
+	}
+	for k := range LHS {
+		if !TypeExists(LHS[k].VarType, p.TypeSystem) {
+			return nil, newError("parse/sig/union", node.Token)
+		}
+		LHS[k].VarType = p.MakeUnionType(LHS[k].VarType, RHS.Value)
+	}
+	return LHS, nil
+}
+
 func recursivelySlurpNamespace(root *ast.InfixExpression) (string, *object.Error) {
 	if len(root.Args) != 3 {
 		return "", newError("parse/sig.namespace/a", root.Args[1].GetToken())
@@ -1455,6 +1766,15 @@ func (p *Parser) RecursivelySlurpReturnTypes(node ast.Node) signature.Signature
 			LHS := p.RecursivelySlurpReturnTypes(typednode.Args[0])
 			RHS := p.RecursivelySlurpReturnTypes(typednode.Args[2])
 			return append(LHS, RHS...)
+		case typednode.Operator == "/":
+			LHS := p.RecursivelySlurpReturnTypes(typednode.Args[0])
+			RHS, ok := typednode.Args[2].(*ast.TypeLiteral)
+			if len(LHS) == 0 || !ok {
+				p.Throw("parse/ret/a", typednode.Token)
+				return nil
+			}
+			LHS[len(LHS)-1].VarType = p.MakeUnionType(LHS[len(LHS)-1].VarType, RHS.Value)
+			return LHS
 		default:
 			p.Throw("parse/ret/a", typednode.Token)
 		}
@@ -1471,6 +1791,17 @@ func (p *Parser) ExtractVariables(T TokenSupplier) (set.Set[string], set.Set[str
 	RHS := make(set.Set[string])
 	assignHasHappened := false
 	for tok := T.NextToken(); tok.Type != token.EOF; tok = T.NextToken() {
+		if tok.Type == token.TEMPLATE {
+			chunks, _ := splitTemplate(tok.Literal)
+			for i := 1; i < len(chunks); i = i + 2 {
+				variables, _ := p.ExtractVariables(relexer.New(tok.Source, chunks[i]))
+				if assignHasHappened {
+					RHS.AddSet(variables)
+				} else {
+					LHS.AddSet(variables)
+				}
+			}
+		}
 		if tok.Type == token.IDENT &&
 			!p.AllFunctionIdents.Contains(tok.Literal) &&
 			!TypeExists(tok.Literal, p.TypeSystem) {
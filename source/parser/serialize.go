@@ -17,6 +17,13 @@ const (
 )
 
 func (p *Parser) Serialize(ob object.Object, style Style) string {
+	return p.Describe(ob, style, 0)
+}
+
+// Like Serialize, except that we show at most maxElements of the elements of each list, set, map or tuple, followed
+// by the number left out, so that the REPL doesn't freeze trying to show a huge collection. The limit applies to each
+// collection separately, however deeply nested. If maxElements is 0 there is no limit.
+func (p *Parser) Describe(ob object.Object, style Style, maxElements int) string {
 	switch ob := ob.(type) {
 	case *object.Boolean:
 		return fmt.Sprintf("%t", ob.Value)
@@ -44,8 +51,12 @@ func (p *Parser) Serialize(ob object.Object, style Style) string {
 		pairs := []string{}
 		out.WriteString("map(")
 		for _, pair := range ob.Pairs {
+			if maxElements > 0 && len(pairs) == maxElements {
+				pairs = append(pairs, leftOut(len(ob.Pairs)-maxElements))
+				break
+			}
 			pairs = append(pairs, fmt.Sprintf("%s::%s",
-				p.Serialize(pair.Key, style), p.Serialize(pair.Value, style)))
+				p.Describe(pair.Key, style, maxElements), p.Describe(pair.Value, style, maxElements)))
 		}
 
 		out.WriteString(strings.Join(pairs, ", "))
@@ -65,30 +76,24 @@ func (p *Parser) Serialize(ob object.Object, style Style) string {
 		return ob.Value.String() // TODO : find out what this does and make it do something else, probably? It doesn't look right.
 	case *object.List:
 		var out bytes.Buffer
-		elements := []string{}
-		for _, element := range ob.Elements {
-			elements = append(elements, p.Serialize(element, style))
-		}
 		out.WriteString("[")
-		out.WriteString(strings.Join(elements, ", "))
+		out.WriteString(p.describeElements(ob.Elements, style, maxElements))
 		out.WriteString("]")
 		return out.String()
 	case *object.Null:
 		return "NULL"
 	case *object.Pair:
-		return fmt.Sprintf("%s::%s", p.Serialize(ob.Left, style), p.Serialize(ob.Right, style))
+		return fmt.Sprintf("%s::%s", p.Describe(ob.Left, style, maxElements), p.Describe(ob.Right, style, maxElements))
 	case *object.OuterFunc:
 		return "<Unserializable outer function>" // TODO --- is it really?
+	case *object.Channel:
+		return "<Unserializable channel>"
 	case *object.Ref:
 		return "<Unserializable refrence variable>" // TODO --- is it really?
 	case *object.Set:
 		var out bytes.Buffer
-		elements := []string{}
-		for _, element := range ob.Elements {
-			elements = append(elements, p.Serialize(element, style))
-		}
 		out.WriteString("set (")
-		out.WriteString(strings.Join(elements, ", "))
+		out.WriteString(p.describeElements(ob.Elements, style, maxElements))
 		out.WriteString(")")
 		return out.String()
 	case *object.String:
@@ -100,7 +105,7 @@ func (p *Parser) Serialize(ob object.Object, style Style) string {
 		var out bytes.Buffer
 		elements := []string{}
 		for _, element := range ob.Labels {
-			elements = append(elements, element+"::"+p.Serialize(ob.Value[element], style))
+			elements = append(elements, element+"::"+p.Describe(ob.Value[element], style, maxElements))
 		}
 		if style == PLAIN {
 			out.WriteString(ob.Name)
@@ -119,17 +124,13 @@ func (p *Parser) Serialize(ob object.Object, style Style) string {
 		return text.OK
 	case *object.Tuple:
 		var out bytes.Buffer
-		elements := []string{}
 		if len(ob.Elements) == 1 {
 			out.WriteString("tuple ")
 		}
 		if len(ob.Elements) <= 1 {
 			out.WriteString("(")
 		}
-		for _, element := range ob.Elements {
-			elements = append(elements, p.Serialize(element, style))
-		}
-		out.WriteString(strings.Join(elements, ", "))
+		out.WriteString(p.describeElements(ob.Elements, style, maxElements))
 		if len(ob.Elements) <= 1 {
 			out.WriteString(")")
 		}
@@ -142,3 +143,19 @@ func (p *Parser) Serialize(ob object.Object, style Style) string {
 	}
 	return "<unexpected serialization error>"
 }
+
+func (p *Parser) describeElements(elements []object.Object, style Style, maxElements int) string {
+	result := []string{}
+	for i, element := range elements {
+		if maxElements > 0 && i == maxElements {
+			result = append(result, leftOut(len(elements)-maxElements))
+			break
+		}
+		result = append(result, p.Describe(element, style, maxElements))
+	}
+	return strings.Join(result, ", ")
+}
+
+func leftOut(n int) string {
+	return fmt.Sprintf("... (%d more)", n)
+}
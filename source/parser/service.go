@@ -1,9 +1,15 @@
 package parser
 
 import (
+	"errors"
 	"os"
+	"sort"
+	"strings"
 
+	"pipefish/source/ast"
 	"pipefish/source/object"
+	"pipefish/source/stack"
+	"pipefish/source/token"
 )
 
 type Service struct {
@@ -43,3 +49,145 @@ func (service *Service) NeedsUpdate() (bool, error) {
 	}
 	return false, nil
 }
+
+// Returns a copy of the service which can be used from one goroutine while the original or other copies are used from
+// others. The copies share the permanent state of the parser, which the initializer set up and which doesn't change
+// afterwards, but each has its own global variables and its own state for parsing lines, and so do the services it
+// imports into namespaces, which are cloned in turn. The external services it talks to are not cloned, since they
+// live elsewhere.
+func (service *Service) Clone() *Service {
+	newParser := *service.Parser
+	newParser.Errors = object.Errors{}
+	newParser.Warnings = object.Errors{}
+	newParser.nesting = *stack.NewStack[token.Token]()
+	newParser.TokenizedCode = nil
+	newParser.NamespaceBranch = make(map[string]*Service, len(service.Parser.NamespaceBranch))
+	for namespace, library := range service.Parser.NamespaceBranch {
+		newParser.NamespaceBranch[namespace] = library.Clone()
+	}
+	newService := *service
+	newService.Parser = &newParser
+	newService.Env = service.Env.Copy()
+	newParser.AllGlobals = newService.Env
+	return &newService
+}
+
+// Returns the names of the service's global constants and then its global variables, in the order in which the
+// initializer gave them their values.
+func (service *Service) InitOrder() []string {
+	return service.Parser.InitOrder
+}
+
+// Sets a flag deciding whether the 'when' blocks guarded by it are compiled. This only affects code parsed after it's
+// set, so to have it apply to a script, set it on the root service which is passed to the initializer, and it will
+// apply to the script and to all its imports.
+func (service *Service) SetFlag(flag string, value bool) {
+	if service.Parser == nil { // Then this is the root of services which are yet to be initialized.
+		service.Parser = New("")
+	}
+	service.Parser.Flags[flag] = value
+}
+
+// Returns the types the line of code might evaluate to, without evaluating it. This is worked out from the
+// declared return types of the functions it calls, so any commands in the line are not executed.
+func (service *Service) TypeOf(line string) (string, error) {
+	node := service.Parser.ParseLine("REPL input", line)
+	if service.Parser.ErrorsExist() {
+		return "", errors.New(service.Parser.Errors[0].Message)
+	}
+	types, err := service.Parser.inferTypes(*node, service.Env)
+	if err != nil {
+		return "", errors.New(err.Message)
+	}
+	return types.String(), nil
+}
+
+// Returns the description of the value the REPL got by evaluating the line, followed by the types the line might
+// evaluate to if the service variable $showTypes is set. If the types can't be inferred, the description is left as
+// it is.
+func (service *Service) Annotate(line, description string) string {
+	showTypes, ok := service.Env.Get("$showTypes")
+	if !ok || showTypes.Type() != object.BOOLEAN_OBJ || !showTypes.(*object.Boolean).Value {
+		return description
+	}
+	types, err := service.TypeOf(line)
+	service.Parser.ClearErrors()
+	if err != nil || types == "" {
+		return description
+	}
+	return description + " : " + types
+}
+
+// A function or command which is implemented in Go rather than in Pipefish.
+type BuiltinInfo struct {
+	Name      string // What it's called in Pipefish.
+	Builtin   string // What its implementation is called in Go.
+	Signature string
+	Returns   string // As worked out by TypeOf, so that it's "tuple" if no return types were declared.
+	Cmd       bool
+}
+
+// Returns all the functions and commands the service can call which are implemented in Go, sorted by name and then in
+// the order in which their overloads are tried.
+func (service *Service) Builtins() []BuiltinInfo {
+	names := []string{}
+	for name := range service.Parser.FunctionTable {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	result := []BuiltinInfo{}
+	for _, name := range names {
+		for _, f := range service.Parser.FunctionTable[name] {
+			if body, ok := f.Body.(*ast.BuiltInExpression); ok {
+				result = append(result, BuiltinInfo{Name: name, Builtin: body.Name, Signature: f.Sig.String(),
+					Returns: typeSchemeOfReturns(f).String(), Cmd: f.Cmd})
+			}
+		}
+	}
+	return result
+}
+
+// Returns the tree the evaluator walks to choose which overload of the function, command or operator with the given
+// name to call, one branch to a line and indented by depth, or the empty string if there's no such function. Each
+// branch is labeled with the type of the argument which leads down it, and the branches are in the order they're
+// tried. Where the arguments have run out, the line says which overload is called.
+func (service *Service) DumpDispatchTree(keyword string) string {
+	tree, ok := service.Parser.FunctionTreeMap[keyword]
+	if !ok {
+		return ""
+	}
+	var out strings.Builder
+	dumpDispatchBranches(&out, keyword, tree, 0)
+	return out.String()
+}
+
+func dumpDispatchBranches(out *strings.Builder, keyword string, node *ast.FnTreeNode, depth int) {
+	for _, branch := range node.Branch {
+		out.WriteString(strings.Repeat("    ", depth))
+		if branch.TypeName == "" {
+			out.WriteString("-> " + keyword + " " + branch.Node.Fn.Sig.String() + "\n")
+			continue
+		}
+		out.WriteString(branch.TypeName + "\n")
+		dumpDispatchBranches(out, keyword, branch.Node, depth+1)
+	}
+}
+
+// Returns the doc-comment of the function, type, constant or variable with the given name, or the empty string if it
+// hasn't got one.
+func (service *Service) Doc(name string) string {
+	return service.Parser.Docs[name]
+}
+
+// Returns the identifiers in scope at the given byte offset into the code which might complete the identifier being
+// typed there. The code needn't be valid, nor be the code the service was initialized from.
+func (service *Service) Completions(code string, pos int) []Completion {
+	return service.Parser.completions(code, pos, service.Env)
+}
+
+// Returns the token declaring the identifier at the given byte offset into the code, if it can be found: the
+// parameter or local variable of a function or command, or the declaration of a function, global, type, enum element
+// or struct field. The code needn't be valid, nor be the code the service was initialized from.
+func (service *Service) Definition(code string, pos int) (token.Token, bool) {
+	return service.Parser.definition(code, pos)
+}
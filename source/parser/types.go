@@ -1,7 +1,9 @@
 package parser
 
 import (
+	"sort"
 	"strconv"
+	"strings"
 
 	"pipefish/source/ast"
 	"pipefish/source/digraph"
@@ -25,6 +27,7 @@ func NewTypeSystem() TypeSystem {
 	T.AddTransitiveArrow("single", "single?")
 	T.AddTransitiveArrow("label", "label?")
 	T.AddTransitiveArrow("enum", "label")
+	T.AddTransitiveArrow("flags", "enum")
 	T.AddTransitiveArrow("field", "label")
 	T.AddTransitiveArrow("enum", "enum?")
 	T.AddTransitiveArrow("field", "field?")
@@ -45,13 +48,38 @@ func NewTypeSystem() TypeSystem {
 	return &T
 }
 
+// Adds the union of the two types to the type system if it isn't there already, and returns its name, which
+// is the names of its members separated by '/'. Either of the types may itself be a union.
+func (p *Parser) MakeUnionType(a, b string) string {
+	union := a + "/" + b
+	if TypeExists(union, p.TypeSystem) {
+		return union
+	}
+	p.TypeSystem.AddTransitiveArrow(a, union)
+	p.TypeSystem.AddTransitiveArrow(b, union)
+	p.AddUnionType(union, strings.Split(union, "/"))
+	return union
+}
+
+// Makes the named type the union of its members, which are supertypes of it if they're all subtypes of 'single'.
+func (p *Parser) AddUnionType(name string, members []string) {
+	allSingle := true
+	for _, member := range members {
+		p.TypeSystem.AddTransitiveArrow(member, name)
+		allSingle = allSingle && IsSameTypeOrSubtype(p.TypeSystem, member, "single")
+	}
+	if allSingle {
+		p.TypeSystem.AddTransitiveArrow(name, "single")
+	}
+}
+
 func TypeExists(s string, t TypeSystem) bool {
 	_, ok := (*t)[s]
 	return ok
 }
 
 var BaseTypes = []string{"int", "float64", "bool", "string", "error", "type", "list",
-	"pair", "set", "map", "func", "struct", "label", "null"}
+	"pair", "set", "map", "func", "struct", "label", "null", "channel"}
 
 func IsMoreSpecific(typesystem TypeSystem, sigA, sigB signature.Signature) (result bool, ok bool) {
 	if len(sigA) > len(sigB) {
@@ -112,6 +140,52 @@ func IsMoreSpecific(typesystem TypeSystem, sigA, sigB signature.Signature) (resu
 	return
 }
 
+// Whether a value can have the type as its concrete type, as opposed to types such as 'single' or 'struct', unions,
+// and nullable types, which are abstract.
+func (p *Parser) isConcreteType(ty string) bool {
+	if _, ok := p.Enums[ty]; ok || p.Structs.Contains(ty) || ty == "field" {
+		return true
+	}
+	for _, base := range BaseTypes {
+		if ty == base {
+			return ty != "struct" && ty != "label"
+		}
+	}
+	return false
+}
+
+// The concrete types belonging to the type, sorted by name. A concrete type has only itself.
+func (p *Parser) subtypes(ty string) []string {
+	if p.isConcreteType(ty) {
+		return []string{ty}
+	}
+	result := []string{}
+	for candidate := range *p.TypeSystem {
+		// The type system has 'null' pointing to e.g. 'enum' by way of the nullable enum types, but we only want to
+		// count it as belonging to the nullable types.
+		if candidate == "null" && !strings.HasSuffix(ty, "?") {
+			continue
+		}
+		if p.isConcreteType(candidate) && p.TypeSystem.PointsTo(candidate, ty) {
+			result = append(result, candidate)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// The types the type belongs to, other than itself, sorted by name.
+func (p *Parser) supertypes(ty string) []string {
+	result := []string{}
+	for candidate := range (*p.TypeSystem)[ty] {
+		if !strings.Contains(candidate, "*") { // Then it's not one of the types for internal use.
+			result = append(result, candidate)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
 func IsObjectInType(typesystem TypeSystem, obj object.Object, ty string) bool {
 	return IsSameTypeOrSubtype(typesystem, object.InnerType(obj), ty)
 }
@@ -119,7 +193,7 @@ func IsObjectInType(typesystem TypeSystem, obj object.Object, ty string) bool {
 func IsSameTypeOrSubtype(T TypeSystem, maybeSub, maybeSuper string) bool {
 	subLen, ok := GetLengthFromType(maybeSub)
 	if ok {
-		if maybeSuper == "string" || maybeSuper == "single" || maybeSuper == "tuple" {
+		if maybeSuper == "string" || maybeSuper == "single" || maybeSuper == "tuple" || T.PointsTo("string", maybeSuper) {
 			return true
 		}
 		superLen, ok := GetLengthFromType(maybeSuper)
@@ -155,6 +155,11 @@ func (rl *Relexer) NextSemanticToken() token.Token {
 		return rl.burnToken()
 	case token.COMMENT:
 		return rl.burnToken()
+	case token.COMMA: // We allow a trailing comma before a closing bracket, so long as something comes before it.
+		if (rl.nexTok.Type == token.RPAREN && rl.nexTok.Literal == ")" || rl.nexTok.Type == token.RBRACK || rl.nexTok.Type == token.RBRACE) &&
+			!(rl.preTok.Type == token.LPAREN || rl.preTok.Type == token.LBRACK || rl.preTok.Type == token.LBRACE) {
+			return rl.burnToken()
+		}
 
 	case token.NEWLINE:
 
@@ -233,6 +238,11 @@ func (rl *Relexer) NextSemanticToken() token.Token {
 			return token.Token{Type: token.RPAREN, Literal: "<-|", Line: rl.curTok.Line,
 				ChStart: 0, ChEnd: 0, Source: rl.curTok.Source}
 		}
+	case token.LOOP:
+		if rl.nexTok.Type == token.IDENT { // Then it's a label, which we fold into the 'loop' token for the parser to find.
+			rl.curTok.Literal = rl.curTok.Literal + " " + rl.nexTok.Literal
+			return rl.burnNextToken()
+		}
 	case token.GIVEN:
 		if rl.nexTok.Type == token.COLON {
 			return rl.burnNextToken()
@@ -287,6 +297,29 @@ func RelexDump(input string) {
 	fmt.Println()
 }
 
+// Tokenize returns the relexer's token stream for the code, types and positions and all, for the benefit of syntax
+// highlighters and such. The code needn't be valid: we return the tokens regardless of any errors. Note that the
+// parentheses "|->" and "<-|" standing for the beginning and end of an indented block are the relexer's own
+// invention and don't appear in the code, and that the relexer throws away the comments.
+func Tokenize(code string) []token.Token {
+	rl := New("", code)
+	result := []token.Token{}
+	for tok := rl.NextToken(); tok.Type != token.EOF; tok = rl.NextToken() {
+		result = append(result, tok)
+	}
+	return result
+}
+
+// The comments the lexer has found starting at column 0, by line number.
+func (rl *Relexer) Comments() map[int]string {
+	return rl.lexer.Comments
+}
+
+// The lines the lexer has found with nothing but whitespace on them.
+func (rl *Relexer) BlankLines() map[int]bool {
+	return rl.lexer.BlankLines
+}
+
 func (rl *Relexer) Throw(errorID string, tok token.Token, args ...any) {
 	rl.Errors = object.Throw(errorID, rl.Errors, tok, args...)
 }
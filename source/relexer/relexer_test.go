@@ -50,3 +50,100 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestTrailingCommas(t *testing.T) {
+	input := `f([1, 2,], {3,}, g(x,), [,])`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "f"},
+		{token.LPAREN, "("},
+		{token.LBRACK, "["},
+		{token.INT, "1"},
+		{token.COMMA, ","},
+		{token.INT, "2"},
+		{token.RBRACK, "]"},
+		{token.COMMA, ","},
+		{token.LBRACE, "{"},
+		{token.INT, "3"},
+		{token.RBRACE, "}"},
+		{token.COMMA, ","},
+		{token.IDENT, "g"},
+		{token.LPAREN, "("},
+		{token.IDENT, "x"},
+		{token.RPAREN, ")"},
+		{token.COMMA, ","},
+		{token.LBRACK, "["},
+		{token.COMMA, ","},
+		{token.RBRACK, "]"},
+		{token.RPAREN, ")"},
+	}
+
+	rl := New("", input)
+
+	for i, tt := range tests {
+		tok := rl.NextToken()
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q", i, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q", i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	input := "def\n\nx = \"hi\" + 2\n\nfoo(y int) : y > 1.5 and true\n"
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedLine    int
+		expectedChStart int
+	}{
+		{token.DEF, "def", 1, 0},
+		{token.IDENT, "x", 3, 0},
+		{token.ASSIGN, "=", 3, 2},
+		{token.STRING, "hi", 3, 4},
+		{token.IDENT, "+", 3, 9},
+		{token.INT, "2", 3, 11},
+		{token.NEWLINE, ";", 3, 12},
+		{token.IDENT, "foo", 5, 0},
+		{token.LPAREN, "(", 5, 3},
+		{token.IDENT, "y", 5, 4},
+		{token.IDENT, "int", 5, 6},
+		{token.RPAREN, ")", 5, 9},
+		{token.COLON, ":", 5, 11},
+		{token.IDENT, "y", 5, 13},
+		{token.IDENT, ">", 5, 15},
+		{token.FLOAT, "1.5", 5, 17},
+		{token.AND, "and", 5, 21},
+		{token.TRUE, "true", 5, 25},
+		{token.NEWLINE, ";", 5, 29},
+	}
+
+	toks := Tokenize(input)
+	if len(toks) != len(tests) {
+		t.Fatalf("expected %d tokens, got %d", len(tests), len(toks))
+	}
+	for i, tt := range tests {
+		tok := toks[i]
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - expected %q %q, got %q %q", i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+		if tok.Line != tt.expectedLine || tok.ChStart != tt.expectedChStart {
+			t.Fatalf("tests[%d] - position wrong. expected=%d:%d, got=%d:%d", i, tt.expectedLine, tt.expectedChStart, tok.Line, tok.ChStart)
+		}
+	}
+}
+
+func TestTokenizeInvalidCode(t *testing.T) {
+	for _, input := range []string{`foo(x int) : "unterminated`, `)))`, `x = [1, 2`} {
+		toks := Tokenize(input)
+		if len(toks) == 0 {
+			t.Errorf("%q: expected tokens, got none", input)
+		}
+	}
+}
@@ -14,6 +14,9 @@ type sysvar = struct {
 	Validator func(object.Object) string
 }
 
+// The levels the 'log' command can log at, and their order: it only logs at levels at least as high as $logLevel.
+var LogLevels = map[string]int{"debug": 0, "info": 1, "warn": 2, "error": 3}
+
 var Sysvars = map[string]sysvar{
 	"$view": {
 		Dflt: &object.String{Value: "plain"},
@@ -40,6 +43,56 @@ var Sysvars = map[string]sysvar{
 			}
 		},
 	},
+	"$logLevel": {
+		Dflt: &object.String{Value: "info"},
+		Validator: func(obj object.Object) string {
+			switch obj := obj.(type) {
+			case *object.String:
+				if _, ok := LogLevels[obj.Value]; !ok {
+					return "sys/loglevel/vals"
+				}
+				return ""
+			default:
+				return "sys/loglevel/string"
+			}
+		},
+	},
+	"$floatDivision": {
+		Dflt: object.FALSE,
+		Validator: func(obj object.Object) string {
+			switch obj.(type) {
+			case *object.Boolean:
+				return ""
+			default:
+				return "sys/floatdivision/bool"
+			}
+		},
+	},
+	"$showTypes": {
+		Dflt: object.FALSE,
+		Validator: func(obj object.Object) string {
+			switch obj.(type) {
+			case *object.Boolean:
+				return ""
+			default:
+				return "sys/showtypes/bool"
+			}
+		},
+	},
+	"$maxElements": {
+		Dflt: &object.Integer{Value: 100},
+		Validator: func(obj object.Object) string {
+			switch obj := obj.(type) {
+			case *object.Integer:
+				if obj.Value < 0 {
+					return "sys/maxelements/int"
+				}
+				return ""
+			default:
+				return "sys/maxelements/int"
+			}
+		},
+	},
 	"$logPath": {
 		Dflt: &object.String{Value: "stdout"},
 		Validator: func(obj object.Object) string {
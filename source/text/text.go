@@ -4,6 +4,8 @@ package text
 // help messages, error messages, etc.
 
 import (
+	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -20,16 +22,23 @@ const (
 	PROMPT      = "→ "
 )
 
+// Renders a string as a Pipefish string literal which will parse back to the same string. We escape opening
+// braces so that they aren't taken to be interpolations, and control characters so that the literal is all on one
+// line.
 func ToEscapedText(s string) string {
 	result := "\""
 	for _, ch := range s {
-		switch ch {
-		case '\n':
-			result = result + "\n"
-		case '\r':
-			result = result + "\r"
-		case '\t':
-			result = result + "\t"
+		switch {
+		case ch == '\n':
+			result = result + "\\n"
+		case ch == '\r':
+			result = result + "\\r"
+		case ch == '\t':
+			result = result + "\\t"
+		case ch == '"' || ch == '\\' || ch == '{':
+			result = result + "\\" + string(ch)
+		case ch < ' ' || ch == 0x7f:
+			result = result + fmt.Sprintf("\\u%04x", ch)
 		default:
 			result = result + string(ch)
 		}
@@ -74,6 +83,13 @@ func Yellow(s string) string {
 	return YELLOW + s + RESET
 }
 
+var colorCode = regexp.MustCompile("\033\\[[0-9;]*m")
+
+// Removes the color codes from a string, for when we're writing to something that isn't a terminal.
+func StripColor(s string) string {
+	return colorCode.ReplaceAllString(s, "")
+}
+
 func Logo() string {
 	var padding string
 	if len(VERSION)%2 == 1 {
@@ -127,7 +143,7 @@ func DescribeTok(tok token.Token) string {
 		}
 	case token.EOF:
 		return "end of line"
-	case token.STRING:
+	case token.STRING, token.TEMPLATE:
 		return "<string>"
 	case token.INT:
 		return "<int>"
@@ -195,6 +211,7 @@ var (
 	ERROR     = "$Error$"
 	RT_ERROR  = "$Runtime error$"
 	HUB_ERROR = "$Hub error$"
+	WARNING   = "$Warning$"
 	OK        = Green("ok")
 )
 
@@ -0,0 +1,46 @@
+package text
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestStripColor(t *testing.T) {
+	pretty := Pretty(RT_ERROR+"can't divide "+Emph("x")+" by zero at @line 3@.", 0, 80)
+	if !strings.Contains(pretty, "\033") {
+		t.Fatalf("expected the error to be colored, got %q", pretty)
+	}
+	plain := StripColor(pretty)
+	if strings.Contains(plain, "\033") {
+		t.Errorf("expected no escape codes, got %q", plain)
+	}
+	if !strings.Contains(plain, "Runtime error: can't divide 'x' by zero at  line 3 .") {
+		t.Errorf("expected the text of the error to survive, got %q", plain)
+	}
+	if got := StripColor(OK); got != "ok" {
+		t.Errorf("expected %q, got %q", "ok", got)
+	}
+	if got := StripColor(GOOD_BULLET + WAS + GOT); strings.Contains(got, "\033") {
+		t.Errorf("expected no escape codes, got %q", got)
+	}
+}
+
+func TestToEscapedText(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"plain", `"plain"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\new`, `"C:\\new"`},
+		{"a\nb\tc\rd", `"a\nb\tc\rd"`},
+		{"{x}", `"\{x}"`},
+		{"bell\a", `"bell\u0007"`},
+		{"café", `"café"`},
+	}
+	for _, tt := range tests {
+		if got := ToEscapedText(tt.input); got != tt.expected {
+			t.Errorf("%q: expected %s, got %s", tt.input, tt.expected, got)
+		}
+	}
+}
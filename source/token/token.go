@@ -8,13 +8,14 @@ const (
 	BUILTIN = "BUILTIN"
 
 	// Identifiers + literals
-	IDENT   = "IDENT"   // add, foobar, x, y, ...
-	INT     = "int"     // 1343456
-	FLOAT   = "float64" // 1.23
-	STRING  = "string"  // "foo", `bar`
-	TRUE    = "true"
-	FALSE   = "false"
-	COMMENT = "COMMENT" // // foo bar zort troz
+	IDENT    = "IDENT"    // add, foobar, x, y, ...
+	INT      = "int"      // 1343456
+	FLOAT    = "float64"  // 1.23
+	STRING   = "string"   // "foo", `bar`
+	TEMPLATE = "TEMPLATE" // "foo {bar}"
+	TRUE     = "true"
+	FALSE    = "false"
+	COMMENT  = "COMMENT" // // foo bar zort troz
 
 	BEGIN = "BEGIN"
 	END   = "END"
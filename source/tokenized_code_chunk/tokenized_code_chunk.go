@@ -26,6 +26,10 @@ func (tcc *TokenizedCodeChunk) Append(tokenToAppend token.Token) {
 	tcc.code = append(tcc.code, tokenToAppend)
 }
 
+func (tcc *TokenizedCodeChunk) Insert(i int, tokenToInsert token.Token) {
+	tcc.code = append(tcc.code[:i], append([]token.Token{tokenToInsert}, tcc.code[i:]...)...)
+}
+
 func (tcc *TokenizedCodeChunk) Length() int {
 	return len(tcc.code)
 }